@@ -0,0 +1,182 @@
+package tesla
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/bogosj/tesla/internal/protobuf"
+)
+
+// The fields of the vehicle actions sent to the infotainment domain
+const (
+	actionChargingSetLimit  = 5
+	actionChargingStartStop = 6
+	actionHvacAuto          = 10
+	actionFlashLights       = 26
+	actionHonkHorn          = 27
+)
+
+// The fields of the charging start and stop action
+const (
+	chargingStart         = 2
+	chargingStartStandard = 3
+	chargingStartMaxRange = 4
+	chargingStop          = 5
+)
+
+// The remote keyless entry actions sent to the vehicle security domain
+const (
+	rkeActionUnlock = 0
+	rkeActionLock   = 1
+)
+
+// The operation status of a failed infotainment action
+const actionStatusError = 1
+
+// The commands with a signed encoding, by the name of their REST endpoint
+var chargingCommands = map[string]int{
+	"charge_start":     chargingStart,
+	"charge_standard":  chargingStartStandard,
+	"charge_max_range": chargingStartMaxRange,
+	"charge_stop":      chargingStop,
+}
+
+// Encodes the command with the name of its REST endpoint and the JSON body
+// of the REST request as the payload of a signed message. It reports false
+// for commands without a signed encoding.
+func encodeCommand(name string, params []byte) (domain, []byte, bool) {
+	switch name {
+	case "door_unlock":
+		return domainVehicleSecurity, protobuf.Message{}.Varint(2, rkeActionUnlock), true
+	case "door_lock":
+		return domainVehicleSecurity, protobuf.Message{}.Varint(2, rkeActionLock), true
+	}
+	var action protobuf.Message
+	switch name {
+	case "set_charge_limit":
+		p := &struct {
+			Percent int `json:"percent"`
+		}{}
+		if json.Unmarshal(params, p) != nil {
+			return 0, nil, false
+		}
+		action = protobuf.Message{}.Bytes(actionChargingSetLimit, protobuf.Message{}.Varint(1, uint64(p.Percent)))
+	case "charge_start", "charge_standard", "charge_max_range", "charge_stop":
+		action = protobuf.Message{}.Bytes(actionChargingStartStop, protobuf.Message{}.Bytes(chargingCommands[name], nil))
+	case "auto_conditioning_start":
+		action = protobuf.Message{}.Bytes(actionHvacAuto, protobuf.Message{}.Varint(1, 1))
+	case "auto_conditioning_stop":
+		action = protobuf.Message{}.Bytes(actionHvacAuto, protobuf.Message{}.Varint(1, 0))
+	case "flash_lights":
+		action = protobuf.Message{}.Bytes(actionFlashLights, nil)
+	case "honk_horn":
+		action = protobuf.Message{}.Bytes(actionHonkHorn, nil)
+	default:
+		return 0, nil, false
+	}
+	return domainInfotainment, protobuf.Message{}.Bytes(2, action), true
+}
+
+// Decodes the payload of a signed message into the name of the REST endpoint
+// of the command and the JSON body of the REST request
+func decodeCommand(d domain, payload []byte) (string, []byte, error) {
+	fields, err := protobuf.Parse(payload)
+	if err != nil {
+		return "", nil, err
+	}
+	if d == domainVehicleSecurity {
+		rke, ok := fields.Get(2)
+		if !ok {
+			return "", nil, errors.New("unsupported vehicle security message")
+		}
+		switch rke.Value {
+		case rkeActionUnlock:
+			return "door_unlock", nil, nil
+		case rkeActionLock:
+			return "door_lock", nil, nil
+		}
+		return "", nil, errors.New("unsupported RKE action " + strconv.FormatUint(rke.Value, 10))
+	}
+	action, err := fields.Message(2)
+	if err != nil || len(action) == 0 {
+		return "", nil, errors.New("unsupported infotainment message")
+	}
+	f := action[0]
+	sub, err := protobuf.Parse(f.Bytes)
+	if err != nil {
+		return "", nil, err
+	}
+	switch f.Num {
+	case actionChargingSetLimit:
+		return "set_charge_limit", []byte(`{"percent": ` + strconv.FormatUint(sub.Value(1), 10) + `}`), nil
+	case actionChargingStartStop:
+		for name, num := range chargingCommands {
+			if sub.Has(num) {
+				return name, nil, nil
+			}
+		}
+	case actionHvacAuto:
+		if sub.Value(1) != 0 {
+			return "auto_conditioning_start", nil, nil
+		}
+		return "auto_conditioning_stop", nil, nil
+	case actionFlashLights:
+		return "flash_lights", nil, nil
+	case actionHonkHorn:
+		return "honk_horn", nil, nil
+	}
+	return "", nil, errors.New("unsupported vehicle action " + strconv.Itoa(f.Num))
+}
+
+// Encodes the response of the vehicle to a command that returned err
+func encodeCommandResult(d domain, err error) []byte {
+	if d == domainVehicleSecurity {
+		status := protobuf.Message{}
+		if err != nil {
+			status = status.Varint(1, operationStatusError)
+		}
+		return protobuf.Message{}.Bytes(4, status)
+	}
+	status := protobuf.Message{}
+	if err != nil {
+		reason := err.Error()
+		var cmdErr *CommandError
+		if errors.As(err, &cmdErr) {
+			reason = cmdErr.Reason
+		}
+		status = status.Varint(1, actionStatusError).Bytes(2, protobuf.Message{}.Bytes(1, []byte(reason)))
+	}
+	return protobuf.Message{}.Bytes(1, status)
+}
+
+// Decodes the response of the vehicle to a command into the body of the
+// equivalent REST response, or a CommandError
+func commandResult(d domain, payload []byte) ([]byte, error) {
+	fields, err := protobuf.Parse(payload)
+	if err != nil {
+		return nil, err
+	}
+	if d == domainVehicleSecurity {
+		status, err := fields.Message(4)
+		if err != nil {
+			return nil, err
+		}
+		if status.Value(1) == operationStatusError {
+			return nil, &CommandError{Reason: "vehicle security error", Body: payload}
+		}
+	} else {
+		status, err := fields.Message(1)
+		if err != nil {
+			return nil, err
+		}
+		if status.Value(1) == actionStatusError {
+			reason, err := status.Message(2)
+			if err != nil {
+				return nil, err
+			}
+			return nil, &CommandError{Reason: string(reason.Bytes(1)), Body: payload}
+		}
+	}
+	return []byte(`{"response":{"reason":"","result":true}}`), nil
+}
@@ -0,0 +1,48 @@
+package tesla
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestActionsSpec(t *testing.T) {
+	Convey("Should encode and decode the signed commands", t, func() {
+		commands := map[string]string{
+			"door_unlock":             "",
+			"door_lock":               "",
+			"set_charge_limit":        `{"percent": 75}`,
+			"charge_start":            "",
+			"charge_standard":         "",
+			"charge_max_range":        "",
+			"charge_stop":             "",
+			"auto_conditioning_start": "",
+			"auto_conditioning_stop":  "",
+			"flash_lights":            "",
+			"honk_horn":               "",
+		}
+		for name, params := range commands {
+			d, payload, ok := encodeCommand(name, []byte(params))
+			So(ok, ShouldBeTrue)
+			decoded, decodedParams, err := decodeCommand(d, payload)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldEqual, name)
+			So(string(decodedParams), ShouldEqual, params)
+		}
+		_, _, ok := encodeCommand("trigger_homelink", nil)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Should encode and decode the command results", t, func() {
+		for _, d := range []domain{domainVehicleSecurity, domainInfotainment} {
+			body, err := commandResult(d, encodeCommandResult(d, nil))
+			So(err, ShouldBeNil)
+			So(string(body), ShouldEqual, CommandResponseJSON)
+		}
+		_, err := commandResult(domainInfotainment, encodeCommandResult(domainInfotainment, ErrNotCharging))
+		So(errors.Is(err, ErrNotCharging), ShouldBeTrue)
+		_, err = commandResult(domainVehicleSecurity, encodeCommandResult(domainVehicleSecurity, errors.New("jammed")))
+		So(errors.Is(err, ErrCommandFailed), ShouldBeTrue)
+	})
+}
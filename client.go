@@ -2,10 +2,15 @@ package tesla
 
 import (
 	"bytes"
+	"context"
+	"crypto/ecdsa"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,25 +21,91 @@ type Auth struct {
 	ClientSecret string `json:"client_secret"`
 	Email        string `json:"email"`
 	Password     string `json:"password"`
+
+	// Passcode returns the passcode of the MFA device, see TOTPPasscode and
+	// PromptPasscode. It is required for accounts with MFA enabled.
+	Passcode func(factor MFAFactor) (string, error) `json:"-"`
+	// SelectFactor chooses the MFA device to use when several are registered.
+	// The first device is used if it is not set.
+	SelectFactor func(factors []MFAFactor) (MFAFactor, error) `json:"-"`
+	// SolveCaptcha returns the text shown by the captcha image (SVG) when the
+	// login page asks for one
+	SolveCaptcha func(image []byte) (string, error) `json:"-"`
+
+	// RedirectURL is the redirect URI of the application registered for the
+	// Fleet API, see AuthCodeURL
+	RedirectURL string `json:"-"`
+	// Scopes are the scopes requested from the Fleet API. DefaultScopes are
+	// requested if it is empty.
+	Scopes []string `json:"-"`
 }
 
 // The token and related elements returned after a successful auth
 // by the Tesla API
 type Token struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	ExpiresIn   int    `json:"expires_in"`
-	Expires     int64
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	Expires      int64
+	RefreshToken string `json:"refresh_token"`
 }
 
 // Provides the client and associated elements for interacting with the
 // Tesla API
 type Client struct {
-	Auth         *Auth
-	Token        *Token
-	HTTP         *http.Client
-	BaseURL      string
-	StreamingURL string
+	Auth           *Auth
+	Token          *Token
+	HTTP           *http.Client
+	BaseURL        string
+	StreamingURL   string
+	AuthURL        string
+	SSOURL         string
+	SSORedirectURL string
+	FleetAuthURL   string
+	UserAgent      string
+
+	// API is the backend the client sends its requests to, OwnerAPI unless
+	// set by WithFleetAPI
+	API API
+
+	// Region is the region of the account, which is set by WithRegion or
+	// detected from the token, the login redirect or a 421 Misdirected Request
+	// response. The endpoints of a detected region replace the default ones,
+	// but never custom endpoints.
+	Region Region
+
+	// Logger, if set, receives a line for every request sent by the client
+	Logger Logger
+
+	// RateLimiter, if set, limits the requests sent by the client
+	RateLimiter *RateLimiter
+
+	// RetryPolicy, if set, controls the retries of transient failures
+	RetryPolicy *RetryPolicy
+
+	// WakePolicy, if set, wakes asleep vehicles for commands and state reads
+	WakePolicy *WakePolicy
+
+	// TokenStore, if set, receives every token the client obtains by
+	// login or refresh
+	TokenStore TokenStore
+
+	// OnTokenRefresh is called with the newly issued token whenever the
+	// client renews its token, so that it may be persisted
+	OnTokenRefresh func(*Token)
+
+	// CommandKey, if set, signs the commands sent to vehicles which accept
+	// signed commands, see GenerateCommandKey
+	CommandKey *ecdsa.PrivateKey
+
+	mu      sync.Mutex
+	partner bool
+	// endpoints are the endpoints of the regions, regionEndpoints if nil
+	endpoints map[Region]Endpoints
+
+	sessionsMu sync.Mutex
+	sessions   map[string]*commandSession
+	address    []byte
 }
 
 var AuthURL = "https://owner-api.teslamotors.com/oauth/token"
@@ -42,14 +113,9 @@ var AuthURL = "https://owner-api.teslamotors.com/oauth/token"
 const BaseURL = "https://owner-api.teslamotors.com/api/1"
 
 // Generates a new client for the Tesla API
-func NewClient(auth *Auth) (*Client, error) {
-	client := &Client{
-		Auth:         auth,
-		HTTP:         &http.Client{},
-		BaseURL:      BaseURL,
-		StreamingURL: StreamingURL,
-	}
-	token, err := client.authorize(auth)
+func NewClient(auth *Auth, options ...ClientOption) (*Client, error) {
+	client := newClient(auth, options)
+	token, err := client.authorize(context.Background(), auth)
 	if err != nil {
 		return nil, err
 	}
@@ -57,53 +123,119 @@ func NewClient(auth *Auth) (*Client, error) {
 	return client, nil
 }
 
-// NewClientWithToken Generates a new client for the Tesla API using an existing token
-func NewClientWithToken(auth *Auth, token *Token) (*Client, error) {
-	client := &Client{
-		Auth:         auth,
-		HTTP:         &http.Client{},
-		Token:        token,
-		BaseURL:      BaseURL,
-		StreamingURL: StreamingURL,
-	}
-	if client.TokenExpired() {
+// NewClientWithToken Generates a new client for the Tesla API using an existing token.
+// An expired token is accepted if it carries a refresh token, and is renewed
+// on the first request.
+func NewClientWithToken(auth *Auth, token *Token, options ...ClientOption) (*Client, error) {
+	client := newClient(auth, options)
+	client.Token = token
+	if client.TokenExpired() && token.RefreshToken == "" {
 		return nil, errors.New("supplied token is expired")
 	}
+	if region, ok := RegionFromToken(token.AccessToken); ok {
+		client.detectRegion(region)
+	}
 	return client, nil
 }
 
+// NewClientWithTokenStore Generates a new client for the Tesla API using the
+// token held by the store. If the store holds no usable token, the client logs
+// in with the supplied credentials and saves the new token to the store.
+func NewClientWithTokenStore(auth *Auth, store TokenStore, options ...ClientOption) (*Client, error) {
+	token, err := store.Load()
+	if err != nil && err != ErrTokenNotFound {
+		return nil, err
+	}
+	if token != nil {
+		client, err := NewClientWithToken(auth, token, options...)
+		if err == nil {
+			client.TokenStore = store
+			return client, nil
+		}
+	}
+	client, err := NewClient(auth, options...)
+	if err != nil {
+		return nil, err
+	}
+	client.TokenStore = store
+	if err := store.Save(client.Token); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// Creates a client with the default endpoints and applies the options
+func newClient(auth *Auth, options []ClientOption) *Client {
+	client := &Client{
+		Auth:           auth,
+		HTTP:           &http.Client{},
+		BaseURL:        BaseURL,
+		StreamingURL:   StreamingURL,
+		AuthURL:        AuthURL,
+		SSOURL:         SSOURL,
+		SSORedirectURL: SSORedirectURL,
+		FleetAuthURL:   RegionNorthAmerica.Endpoints().FleetAuthURL,
+	}
+	for _, option := range options {
+		option(client)
+	}
+	return client
+}
+
 // TokenExpired indicates whether an existing token is within an hour of expiration
-func (c Client) TokenExpired() bool {
-	exp := time.Unix(c.Token.Expires, 0)
+func (c *Client) TokenExpired() bool {
+	return c.token().expired()
+}
+
+// Returns the current token of the client, which may be renewed concurrently
+func (c *Client) token() *Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Token
+}
+
+// Indicates whether the token is within an hour of expiration
+func (t *Token) expired() bool {
+	exp := time.Unix(t.Expires, 0)
 	return time.Until(exp) < time.Duration(1*time.Hour)
 }
 
-// Authorizes against the Tesla API with the appropriate credentials
-func (c Client) authorize(auth *Auth) (*Token, error) {
-	now := time.Now()
-	auth.GrantType = "password"
-	data, _ := json.Marshal(auth)
-	body, err := c.post(AuthURL, data)
+// Authorizes against the Tesla API with the appropriate credentials by
+// logging in through the SSO service and exchanging the resulting token
+// for an owner API token. The login may reveal the region of the account.
+func (c *Client) authorize(ctx context.Context, auth *Auth) (*Token, error) {
+	if c.API == FleetAPI {
+		return nil, errors.New("the Fleet API does not accept logins, use NewClientWithCode or NewPartnerClient")
+	}
+	session, err := c.newSSOSession(ctx)
 	if err != nil {
 		return nil, err
 	}
-	token := &Token{}
-	if err := json.Unmarshal(body, token); err != nil {
+	code, err := session.login(auth)
+	if err != nil {
 		return nil, err
 	}
-	token.Expires = now.Add(time.Second * time.Duration(token.ExpiresIn)).Unix()
-	return token, nil
+	sso, err := session.exchangeCode(code)
+	if err != nil {
+		return nil, err
+	}
+	if session.redirected {
+		c.detectRegion(session.region)
+	} else if region, ok := RegionFromToken(sso.AccessToken); ok {
+		c.detectRegion(region)
+	}
+	return c.exchangeOwnerToken(ctx, auth, sso)
 }
 
 // Calls an HTTP GET
-func (c Client) get(url string) ([]byte, error) {
-	req, _ := http.NewRequest("GET", url, nil)
+func (c *Client) get(ctx context.Context, url string) ([]byte, error) {
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
 	return c.processRequest(req)
 }
 
 // getJSON performs an HTTP GET and then unmarshals the result into the provided struct.
-func (c Client) getJSON(url string, out interface{}) error {
-	body, err := c.get(url)
+func (c *Client) getJSON(ctx context.Context, url string, out interface{}) error {
+	body, err := c.get(ctx, url)
 	if err != nil {
 		return err
 	}
@@ -114,34 +246,188 @@ func (c Client) getJSON(url string, out interface{}) error {
 }
 
 // Calls an HTTP POST with a JSON body
-func (c Client) post(url string, body []byte) ([]byte, error) {
-	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(body))
+func (c *Client) post(ctx context.Context, url string, body []byte) ([]byte, error) {
+	req, _ := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
 	return c.processRequest(req)
 }
 
-// Processes a HTTP POST/PUT request
-func (c Client) processRequest(req *http.Request) ([]byte, error) {
+// Processes a HTTP POST/PUT request, retrying transient failures according
+// to the RetryPolicy
+func (c *Client) processRequest(req *http.Request) ([]byte, error) {
+	body, err := c.sendRequest(req)
+	if c.RetryPolicy == nil {
+		return body, err
+	}
+	for attempt := 1; ; attempt++ {
+		delay, retry := c.RetryPolicy.retryDelay(req, attempt, body, err)
+		if !retry {
+			return body, err
+		}
+		if err := sleepContext(req.Context(), delay); err != nil {
+			return nil, err
+		}
+		if id, kind, ok := vehicleRequest(req); ok {
+			if err := c.rateLimit(req.Context(), id, kind); err != nil {
+				return nil, err
+			}
+		}
+		retryReq, cloneErr := cloneRequest(req)
+		if cloneErr != nil {
+			return nil, cloneErr
+		}
+		retryReq.Header.Del("Authorization")
+		body, err = c.sendRequest(retryReq)
+	}
+}
+
+// Sends a request, renewing the token when it is about to expire or is
+// rejected by the API, and switching the region when the request is misdirected
+func (c *Client) sendRequest(req *http.Request) ([]byte, error) {
+	if err := c.rateLimit(req.Context(), 0, accountRequest); err != nil {
+		return nil, err
+	}
+	if token := c.token(); c.canRefresh(token) && token.expired() {
+		if err := c.refreshToken(req.Context(), token.AccessToken); err != nil {
+			return nil, err
+		}
+	}
+	body, err := c.doRequest(req)
+	if retry, ok := c.redirectRegion(req, err); ok {
+		req = retry
+		body, err = c.doRequest(req)
+	}
+	if errors.Is(err, ErrUnauthorized) && c.canRefresh(c.token()) && (req.Body == nil || req.GetBody != nil) {
+		rejected := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if err := c.refreshToken(req.Context(), rejected); err != nil {
+			return nil, err
+		}
+		retry, err := cloneRequest(req)
+		if err != nil {
+			return nil, err
+		}
+		retry.Header.Del("Authorization")
+		return c.doRequest(retry)
+	}
+	return body, err
+}
+
+// Performs a single HTTP request and returns the body of a successful response
+func (c *Client) doRequest(req *http.Request) ([]byte, error) {
 	c.setHeaders(req)
 	res, err := c.HTTP.Do(req)
 	if err != nil {
+		if urlErr, ok := err.(*url.Error); ok {
+			urlErr.URL = redactURL(req.URL)
+		}
+		c.logf("%s %s: %v", req.Method, redactURL(req.URL), err)
 		return nil, err
 	}
-	if res.StatusCode != 200 {
-		return nil, errors.New(res.Status)
-	}
 	defer res.Body.Close()
+	c.logf("%s %s: %s", req.Method, redactURL(req.URL), res.Status)
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		return nil, err
 	}
+	if res.StatusCode != 200 {
+		return nil, newAPIError(res, body)
+	}
 	return body, nil
 }
 
+// Returns the URL without its query, which may hold secrets such as the
+// password sent by StartContext
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	redacted.RawQuery = ""
+	redacted.ForceQuery = false
+	return redacted.String()
+}
+
+// Indicates whether the token of the client can be renewed
+func (c *Client) canRefresh(token *Token) bool {
+	return token != nil && (token.RefreshToken != "" || c.partner)
+}
+
+// RefreshToken renews the token of the client using its refresh token, saves
+// it to the TokenStore and passes it to OnTokenRefresh. If another client
+// sharing the TokenStore already renewed the token, that token is used instead.
+func (c *Client) RefreshToken() error {
+	return c.RefreshTokenContext(context.Background())
+}
+
+// RefreshTokenContext is like RefreshToken but uses ctx for the requests to the API
+func (c *Client) RefreshTokenContext(ctx context.Context) error {
+	return c.refreshToken(ctx, "")
+}
+
+// Renews the token unless it is no longer the stale access token, which
+// concurrent requests renewed already. An empty stale token always renews.
+func (c *Client) refreshToken(ctx context.Context, stale string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.canRefresh(c.Token) {
+		return errors.New("no refresh token available")
+	}
+	if stale != "" && c.Token.AccessToken != stale {
+		return nil
+	}
+	if c.TokenStore != nil {
+		stored, err := c.TokenStore.Load()
+		if err == nil && stored.AccessToken != c.Token.AccessToken && !stored.expired() {
+			c.Token = stored
+			return nil
+		}
+	}
+	var token *Token
+	var err error
+	if c.API == FleetAPI {
+		token, err = c.renewFleetToken(ctx)
+	} else {
+		token, err = c.renewOwnerToken(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	c.Token = token
+	if c.TokenStore != nil {
+		if err := c.TokenStore.Save(token); err != nil {
+			return err
+		}
+	}
+	if c.OnTokenRefresh != nil {
+		c.OnTokenRefresh(token)
+	}
+	return nil
+}
+
+// Renews the owner API token by refreshing the SSO token and exchanging it
+func (c *Client) renewOwnerToken(ctx context.Context) (*Token, error) {
+	session, err := c.newSSOSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sso, err := session.refresh(c.Token.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	auth := c.Auth
+	if auth == nil {
+		auth = &Auth{}
+	}
+	return c.exchangeOwnerToken(ctx, auth, sso)
+}
+
 // Sets the required headers for calls to the Tesla API
-func (c Client) setHeaders(req *http.Request) {
-	if c.Token != nil {
-		req.Header.Set("Authorization", "Bearer "+c.Token.AccessToken)
+func (c *Client) setHeaders(req *http.Request) {
+	if req.Header.Get("Authorization") == "" {
+		if token := c.token(); token != nil {
+			req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		}
 	}
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
 }
@@ -4,18 +4,20 @@ import (
 	"bytes"
 	"encoding/json"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
 
+var OwnerTokenJSON = `{"access_token":"ghi789","token_type":"bearer","expires_in":3888000,"refresh_token":"owner123","created_at":1612345678}`
+
 func TestClientSpec(t *testing.T) {
 	ts := serveHTTP(t)
 	defer ts.Close()
-	previousAuthURL := AuthURL
-	AuthURL = ts.URL + "/oauth/token"
 
 	auth := &Auth{
 		GrantType:    "password",
@@ -24,8 +26,7 @@ func TestClientSpec(t *testing.T) {
 		Email:        "elon@tesla.com",
 		Password:     "go",
 	}
-	client, err := NewClient(auth)
-	client.BaseURL = ts.URL + "/api/1"
+	client, err := NewClient(auth, testOptions(ts)...)
 
 	Convey("Should set the HTTP headers", t, func() {
 		req, _ := http.NewRequest("GET", "http://foo.com", nil)
@@ -37,9 +38,9 @@ func TestClientSpec(t *testing.T) {
 	Convey("Should login and get an access token", t, func() {
 		So(err, ShouldBeNil)
 		So(client.Token.AccessToken, ShouldEqual, "ghi789")
+		So(client.Token.RefreshToken, ShouldEqual, "refresh123")
+		So(client.TokenExpired(), ShouldBeFalse)
 	})
-
-	AuthURL = previousAuthURL
 }
 
 func TestTokenExpiredSpec(t *testing.T) {
@@ -75,8 +76,6 @@ func TestTokenExpiredSpec(t *testing.T) {
 func TestClientWithTokenSpec(t *testing.T) {
 	ts := serveHTTP(t)
 	defer ts.Close()
-	previousAuthURL := AuthURL
-	AuthURL = ts.URL + "/oauth/token"
 
 	auth := &Auth{
 		GrantType:    "password",
@@ -93,36 +92,204 @@ func TestClientWithTokenSpec(t *testing.T) {
 		Expires:     99999999999,
 	}
 
-	client, err := NewClientWithToken(auth, validToken)
-	client.BaseURL = ts.URL + "/api/1"
+	client, err := NewClientWithToken(auth, validToken, testOptions(ts)...)
 
 	Convey("Should login with a valid access token", t, func() {
 		So(err, ShouldBeNil)
 		So(client.Token.AccessToken, ShouldEqual, "foo")
 	})
+}
+
+func TestRefreshTokenSpec(t *testing.T) {
+	ts := serveHTTP(t)
+	defer ts.Close()
+
+	auth := &Auth{
+		ClientID:     "abc123",
+		ClientSecret: "def456",
+	}
+
+	Convey("Should refresh the token on request", t, func() {
+		client, err := NewClientWithToken(auth, &Token{
+			AccessToken:  "foo",
+			Expires:      99999999999,
+			RefreshToken: "refresh123",
+		}, testOptions(ts)...)
+		So(err, ShouldBeNil)
+		var refreshed *Token
+		client.OnTokenRefresh = func(token *Token) {
+			refreshed = token
+		}
+		So(client.RefreshToken(), ShouldBeNil)
+		So(client.Token.AccessToken, ShouldEqual, "ghi789")
+		So(refreshed, ShouldEqual, client.Token)
+	})
 
-	AuthURL = previousAuthURL
+	Convey("Should refresh an expired token before a request", t, func() {
+		client, err := NewClientWithToken(auth, &Token{
+			AccessToken:  "foo",
+			Expires:      0,
+			RefreshToken: "refresh123",
+		}, testOptions(ts)...)
+		So(err, ShouldBeNil)
+		refreshes := 0
+		client.OnTokenRefresh = func(token *Token) {
+			refreshes++
+		}
+		_, err = client.Vehicles()
+		So(err, ShouldBeNil)
+		_, err = client.Vehicles()
+		So(err, ShouldBeNil)
+		So(refreshes, ShouldEqual, 1)
+		So(client.Token.AccessToken, ShouldEqual, "ghi789")
+	})
+
+	Convey("Should refresh a token rejected by the API", t, func() {
+		client, err := NewClientWithToken(auth, &Token{
+			AccessToken:  "stale",
+			Expires:      99999999999,
+			RefreshToken: "refresh123",
+		}, testOptions(ts)...)
+		So(err, ShouldBeNil)
+		vehicles, err := client.Vehicles()
+		So(err, ShouldBeNil)
+		So(vehicles[0].DisplayName, ShouldEqual, "Macak")
+		So(client.Token.AccessToken, ShouldEqual, "ghi789")
+	})
+
+	Convey("Should refresh a token rejected by concurrent requests once", t, func() {
+		client, err := NewClientWithToken(auth, &Token{
+			AccessToken:  "stale",
+			Expires:      99999999999,
+			RefreshToken: "refresh123",
+		}, testOptions(ts)...)
+		So(err, ShouldBeNil)
+		refreshes := 0
+		client.OnTokenRefresh = func(token *Token) {
+			refreshes++
+		}
+		errs := make(chan error, 4)
+		for i := 0; i < cap(errs); i++ {
+			go func() {
+				_, err := client.Vehicles()
+				errs <- err
+			}()
+		}
+		for i := 0; i < cap(errs); i++ {
+			So(<-errs, ShouldBeNil)
+		}
+		So(refreshes, ShouldEqual, 1)
+		So(client.TokenExpired(), ShouldBeFalse)
+	})
+
+	Convey("Should reject an expired token without a refresh token", t, func() {
+		_, err := NewClientWithToken(auth, &Token{AccessToken: "foo"}, testOptions(ts)...)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Should fail to refresh with an invalid refresh token", t, func() {
+		client, err := NewClientWithToken(auth, &Token{AccessToken: "foo", RefreshToken: "bad"}, testOptions(ts)...)
+		So(err, ShouldBeNil)
+		So(client.RefreshToken(), ShouldNotBeNil)
+		So(client.Token.AccessToken, ShouldEqual, "foo")
+	})
+}
+
+func TestClientOptionsSpec(t *testing.T) {
+	ts := serveHTTP(t)
+	defer ts.Close()
+
+	Convey("Should apply the client options", t, func() {
+		httpClient := &http.Client{}
+		policy := DefaultRetryPolicy()
+		client, err := NewClientWithToken(&Auth{}, &Token{AccessToken: "foo", Expires: 99999999999},
+			WithHTTPClient(httpClient),
+			WithBaseURL("http://base"),
+			WithAuthURL("http://auth"),
+			WithSSOURL("http://sso"),
+			WithStreamingURL("http://streaming"),
+			WithUserAgent("tesla-test"),
+			WithRetryPolicy(policy),
+		)
+		So(err, ShouldBeNil)
+		So(client.HTTP, ShouldEqual, httpClient)
+		So(client.BaseURL, ShouldEqual, "http://base")
+		So(client.AuthURL, ShouldEqual, "http://auth")
+		So(client.SSOURL, ShouldEqual, "http://sso")
+		So(client.StreamingURL, ShouldEqual, "http://streaming")
+		So(client.RetryPolicy, ShouldEqual, policy)
+
+		req, _ := http.NewRequest("GET", "http://foo.com", nil)
+		client.setHeaders(req)
+		So(req.Header.Get("User-Agent"), ShouldEqual, "tesla-test")
+	})
+
+	Convey("Should use the default endpoints", t, func() {
+		client, err := NewClientWithToken(&Auth{}, &Token{AccessToken: "foo", Expires: 99999999999})
+		So(err, ShouldBeNil)
+		So(client.BaseURL, ShouldEqual, BaseURL)
+		So(client.AuthURL, ShouldEqual, AuthURL)
+		So(client.SSOURL, ShouldEqual, SSOURL)
+		So(client.StreamingURL, ShouldEqual, StreamingURL)
+	})
+
+	Convey("Should log requests", t, func() {
+		out := &bytes.Buffer{}
+		client, err := NewClientWithToken(&Auth{}, &Token{AccessToken: "foo", Expires: 99999999999},
+			append(testOptions(ts), WithLogger(log.New(out, "", 0)))...)
+		So(err, ShouldBeNil)
+		_, err = client.Vehicles()
+		So(err, ShouldBeNil)
+		So(out.String(), ShouldEqual, "GET "+ts.URL+"/api/1/vehicles: 200 OK\n")
+	})
+
+	Convey("Should not log the query of requests", t, func() {
+		out := &bytes.Buffer{}
+		client, err := NewClientWithToken(&Auth{}, &Token{AccessToken: "foo", Expires: 99999999999},
+			append(testOptions(ts), WithLogger(log.New(out, "", 0)))...)
+		So(err, ShouldBeNil)
+		So((&Vehicle{ID: 1234, c: client}).Start("foo"), ShouldBeNil)
+		So(out.String(), ShouldEqual, "POST "+ts.URL+"/api/1/vehicles/1234/command/remote_start_drive: 200 OK\n")
+	})
+}
+
+// Returns the options pointing a client to the test server
+func testOptions(ts *httptest.Server) []ClientOption {
+	return []ClientOption{
+		WithBaseURL(ts.URL + "/api/1"),
+		WithAuthURL(ts.URL + "/oauth/token"),
+		WithSSOURL(ts.URL + "/oauth2/v3"),
+		WithStreamingURL(ts.URL),
+	}
 }
 
 func serveHTTP(t *testing.T) *httptest.Server {
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, "/oauth2/v3/") {
+			serveSSO(t, w, req)
+			return
+		}
 		body, _ := ioutil.ReadAll(req.Body)
 		defer req.Body.Close()
 		switch req.URL.String() {
 		case "/oauth/token":
 			checkHeaders(t, req)
 			Convey("Request body should be set correctly", t, func() {
-				auth := &Auth{}
-				json.Unmarshal(body, auth)
-				So(auth.ClientID, ShouldEqual, "abc123")
-				So(auth.ClientSecret, ShouldEqual, "def456")
-				So(auth.Email, ShouldEqual, "elon@tesla.com")
-				So(auth.Password, ShouldEqual, "go")
+				tokenRequest := &ownerTokenRequest{}
+				json.Unmarshal(body, tokenRequest)
+				So(req.Header.Get("Authorization"), ShouldEqual, "Bearer sso123")
+				So(tokenRequest.GrantType, ShouldEqual, jwtBearerType)
+				So(tokenRequest.ClientID, ShouldEqual, "abc123")
+				So(tokenRequest.ClientSecret, ShouldEqual, "def456")
 			})
 			w.WriteHeader(200)
-			w.Write([]byte("{\"access_token\": \"ghi789\"}"))
+			w.Write([]byte(OwnerTokenJSON))
 		case "/api/1/vehicles":
 			checkHeaders(t, req)
+			if req.Header.Get("Authorization") == "Bearer stale" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
 			w.WriteHeader(200)
 			w.Write([]byte(VehiclesJSON))
 		case "/api/1/vehicles/1234":
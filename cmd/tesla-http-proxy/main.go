@@ -0,0 +1,101 @@
+// Command tesla-http-proxy accepts the REST command requests of the owner
+// API over TLS, signs them with the vehicle command protocol and forwards
+// them to the Fleet API, so that clients unaware of signed commands keep
+// working with vehicles requiring them. Requests other than commands, and
+// commands without a signed encoding, are forwarded unchanged.
+//
+// The proxy uses the bearer token of each request to talk to the Fleet API.
+//
+// Usage:
+//
+//	tesla-http-proxy -command-key command-key.pem [-cert cert.pem -key key.pem] [-listen localhost:4443] [-region na]
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"flag"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/bogosj/tesla"
+)
+
+func main() {
+	listen := flag.String("listen", "localhost:4443", "address to listen on")
+	certFile := flag.String("cert", "", "TLS certificate file, a self-signed certificate is generated if empty")
+	keyFile := flag.String("key", "", "TLS key file")
+	commandKeyFile := flag.String("command-key", "", "private key signing the commands, paired with the vehicles")
+	regionCode := flag.String("region", "na", "Fleet API region: na, eu or cn")
+	upstream := flag.String("upstream", "", "Fleet API base URL, overriding the region")
+	flag.Parse()
+
+	if *commandKeyFile == "" {
+		log.Fatal("-command-key is required")
+	}
+	commandKey, err := tesla.LoadCommandKey(*commandKeyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	region, err := tesla.ParseRegion(*regionCode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	baseURL := region.Endpoints().FleetAPIURL + "/api/1"
+	if *upstream != "" {
+		baseURL = *upstream
+	}
+
+	handler, err := newProxy(baseURL, commandKey, &http.Client{Timeout: 60 * time.Second})
+	if err != nil {
+		log.Fatal(err)
+	}
+	server := &http.Server{
+		Addr:    *listen,
+		Handler: handler,
+	}
+	log.Printf("forwarding to %s on https://%s", baseURL, *listen)
+	if *certFile != "" {
+		log.Fatal(server.ListenAndServeTLS(*certFile, *keyFile))
+	}
+	cert, err := selfSignedCertificate()
+	if err != nil {
+		log.Fatal(err)
+	}
+	server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	log.Fatal(server.ListenAndServeTLS("", ""))
+}
+
+// Generates a certificate for localhost, which clients have to trust explicitly
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "tesla-http-proxy"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bogosj/tesla"
+)
+
+// The number of sessions kept, one for each token. The least recently used
+// session is dropped to make room for a new one.
+const maxSessions = 100
+
+// Signs the command requests passing through and forwards all others
+type proxy struct {
+	baseURL    string
+	commandKey *ecdsa.PrivateKey
+	http       *http.Client
+	forward    *httputil.ReverseProxy
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	// uses counts the uses of the sessions, to order them by their last use
+	uses uint64
+}
+
+// The client of a token and the VINs of the vehicles it was allowed to see,
+// which are not shared with other tokens
+type session struct {
+	client   *tesla.Client
+	vins     map[string]string
+	lastUsed uint64
+}
+
+// Creates a proxy for the Fleet API at baseURL
+func newProxy(baseURL string, commandKey *ecdsa.PrivateKey, httpClient *http.Client) (*proxy, error) {
+	target, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	forward := &httputil.ReverseProxy{
+		Transport: httpClient.Transport,
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.URL.Path = target.Path + strings.TrimPrefix(req.URL.Path, "/api/1")
+			req.Host = target.Host
+		},
+	}
+	return &proxy{
+		baseURL:    baseURL,
+		commandKey: commandKey,
+		http:       httpClient,
+		forward:    forward,
+		sessions:   map[string]*session{},
+	}, nil
+}
+
+// Returns the vehicle ID and the command of a REST command request
+func parseCommandPath(path string) (string, string, bool) {
+	parts := strings.Split(strings.TrimPrefix(path, "/api/1/vehicles/"), "/")
+	if !strings.HasPrefix(path, "/api/1/vehicles/") || len(parts) != 3 || parts[1] != "command" {
+		return "", "", false
+	}
+	return parts[0], parts[2], true
+}
+
+func (p *proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	id, command, ok := parseCommandPath(req.URL.Path)
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || req.Method != "POST" || token == "" {
+		p.forward.ServeHTTP(w, req)
+		return
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s, err := p.session(token)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+	vin, err := p.vin(req, s, id)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	res, err := s.client.SignedCommandContext(req.Context(), vin, command, params(req, body))
+	if errors.Is(err, tesla.ErrUnsupported) {
+		req.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+		p.forward.ServeHTTP(w, req)
+		return
+	}
+	var apiErr *tesla.APIError
+	var cmdErr *tesla.CommandError
+	switch {
+	case errors.As(err, &apiErr):
+		w.WriteHeader(apiErr.StatusCode)
+		w.Write(apiErr.Body)
+		return
+	case errors.As(err, &cmdErr):
+		failed := &tesla.CommandResponse{}
+		failed.Response.Reason = cmdErr.Reason
+		res, _ = json.Marshal(failed)
+	case err != nil:
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(res)
+}
+
+// Returns the parameters of a command, which are sent in the body or, by
+// some clients, in the query
+func params(req *http.Request, body []byte) []byte {
+	if len(body) > 0 || len(req.URL.Query()) == 0 {
+		return body
+	}
+	values := map[string]interface{}{}
+	for k := range req.URL.Query() {
+		v := req.URL.Query().Get(k)
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			values[k] = json.Number(v)
+		} else if b, err := strconv.ParseBool(v); err == nil {
+			values[k] = b
+		} else {
+			values[k] = v
+		}
+	}
+	data, _ := json.Marshal(values)
+	return data
+}
+
+// Returns the session of the token. The proxy does not renew tokens, the
+// API rejects the expired ones.
+func (p *proxy) session(token string) (*session, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.uses++
+	if s, ok := p.sessions[token]; ok {
+		s.lastUsed = p.uses
+		return s, nil
+	}
+	if len(p.sessions) >= maxSessions {
+		p.evictSession()
+	}
+	client, err := tesla.NewClientWithToken(nil, &tesla.Token{
+		AccessToken: token,
+		Expires:     time.Now().Add(24 * time.Hour).Unix(),
+	},
+		tesla.WithFleetAPI(),
+		tesla.WithBaseURL(p.baseURL),
+		tesla.WithHTTPClient(p.http),
+		tesla.WithCommandKey(p.commandKey),
+	)
+	if err != nil {
+		return nil, err
+	}
+	s := &session{client: client, vins: map[string]string{}, lastUsed: p.uses}
+	p.sessions[token] = s
+	return s, nil
+}
+
+// Drops the least recently used session. The caller holds p.mu.
+func (p *proxy) evictSession() {
+	var oldest string
+	for token, s := range p.sessions {
+		if oldest == "" || s.lastUsed < p.sessions[oldest].lastUsed {
+			oldest = token
+		}
+	}
+	delete(p.sessions, oldest)
+}
+
+// Returns the VIN of the vehicle with the ID, which may be the VIN itself.
+// The VIN is looked up with the token of the session, so that tokens only
+// reach the vehicles of their account.
+func (p *proxy) vin(req *http.Request, s *session, id string) (string, error) {
+	vehicleID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return id, nil
+	}
+	p.mu.Lock()
+	vin, ok := s.vins[id]
+	p.mu.Unlock()
+	if ok {
+		return vin, nil
+	}
+	vehicle, err := s.client.VehicleContext(req.Context(), vehicleID)
+	if err != nil {
+		return "", err
+	}
+	p.mu.Lock()
+	s.vins[id] = vehicle.Vin
+	p.mu.Unlock()
+	return vehicle.Vin, nil
+}
+
+// Writes an error in the format of the API
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"response":          nil,
+		"error":             err.Error(),
+		"error_description": "",
+	})
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bogosj/tesla"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProxySpec(t *testing.T) {
+	verifier, err := tesla.NewCommandVerifier("abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var executed []string
+	verifier.Execute = func(command string, params []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		executed = append(executed, command+" "+string(params))
+		if command == "charge_start" {
+			return &tesla.CommandError{Reason: "is_charging"}
+		}
+		return nil
+	}
+	key, err := tesla.GenerateCommandKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier.PairKey(&key.PublicKey)
+
+	var forwarded []string
+	mux := http.NewServeMux()
+	mux.Handle("/api/1/vehicles/abc123/signed_command", verifier)
+	mux.HandleFunc("/api/1/vehicles/1234", func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer foo" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"response":{"id":1234,"vin":"abc123"}}`))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		mu.Lock()
+		forwarded = append(forwarded, req.Method+" "+req.URL.Path+" "+req.Header.Get("Authorization")+" "+string(body))
+		mu.Unlock()
+		w.Write([]byte(`{"response":{"reason":"","result":true}}`))
+	})
+	upstream := httptest.NewServer(mux)
+	defer upstream.Close()
+
+	handler, err := newProxy(upstream.URL+"/api/1", key, &http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewTLSServer(handler)
+	defer ts.Close()
+
+	postAs := func(token, path, body string) (int, string) {
+		req, _ := http.NewRequest("POST", ts.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := ts.Client().Do(req)
+		So(err, ShouldBeNil)
+		defer res.Body.Close()
+		data, _ := ioutil.ReadAll(res.Body)
+		return res.StatusCode, string(data)
+	}
+	post := func(path, body string) (int, string) {
+		return postAs("foo", path, body)
+	}
+
+	Convey("Should sign commands to a vehicle given by its VIN", t, func() {
+		status, body := post("/api/1/vehicles/abc123/command/set_charge_limit", `{"percent": 80}`)
+		So(status, ShouldEqual, 200)
+		So(body, ShouldEqual, `{"response":{"reason":"","result":true}}`)
+		So(executed, ShouldContain, `set_charge_limit {"percent": 80}`)
+	})
+
+	Convey("Should resolve the VIN of a vehicle given by its ID", t, func() {
+		status, _ := post("/api/1/vehicles/1234/command/honk_horn", "")
+		So(status, ShouldEqual, 200)
+		So(executed, ShouldContain, "honk_horn ")
+
+		Convey("Should not resolve the VIN for the tokens of other accounts", func() {
+			status, _ := postAs("bar", "/api/1/vehicles/1234/command/honk_horn", "")
+			So(status, ShouldEqual, http.StatusBadGateway)
+		})
+	})
+
+	Convey("Should read the parameters from the query", t, func() {
+		status, _ := post("/api/1/vehicles/abc123/command/set_charge_limit?percent=70", "")
+		So(status, ShouldEqual, 200)
+		So(executed, ShouldContain, `set_charge_limit {"percent": 70}`)
+	})
+
+	Convey("Should report the reason of a failed command", t, func() {
+		status, body := post("/api/1/vehicles/abc123/command/charge_start", "")
+		So(status, ShouldEqual, 200)
+		So(body, ShouldEqual, `{"response":{"reason":"is_charging","result":false}}`)
+	})
+
+	Convey("Should forward commands without a signed encoding", t, func() {
+		status, _ := post("/api/1/vehicles/abc123/command/set_temps", `{"driver_temp": 21}`)
+		So(status, ShouldEqual, 200)
+		So(forwarded, ShouldContain, `POST /api/1/vehicles/abc123/command/set_temps Bearer foo {"driver_temp": 21}`)
+	})
+
+	Convey("Should forward other requests", t, func() {
+		res, err := ts.Client().Get(ts.URL + "/api/1/vehicles")
+		So(err, ShouldBeNil)
+		res.Body.Close()
+		So(res.StatusCode, ShouldEqual, 200)
+		So(forwarded, ShouldContain, "GET /api/1/vehicles  ")
+	})
+
+	Convey("Should drop the least recently used session when full", t, func() {
+		foo, err := handler.session("foo")
+		So(err, ShouldBeNil)
+		for i := len(handler.sessions); i < maxSessions; i++ {
+			_, err := handler.session(fmt.Sprintf("token%d", i))
+			So(err, ShouldBeNil)
+		}
+		handler.session("foo")
+		_, err = handler.session("new")
+		So(err, ShouldBeNil)
+		So(handler.sessions, ShouldHaveLength, maxSessions)
+		So(handler.sessions["foo"], ShouldEqual, foo)
+		So(foo.vins, ShouldContainKey, "1234")
+		So(handler.sessions, ShouldContainKey, "new")
+	})
+}
+
+func TestParseCommandPathSpec(t *testing.T) {
+	Convey("Should parse the vehicle and the command", t, func() {
+		id, command, ok := parseCommandPath("/api/1/vehicles/1234/command/honk_horn")
+		So(ok, ShouldBeTrue)
+		So(id, ShouldEqual, "1234")
+		So(command, ShouldEqual, "honk_horn")
+	})
+
+	Convey("Should reject other paths", t, func() {
+		for _, path := range []string{"/api/1/vehicles", "/api/1/vehicles/1234/vehicle_data", "/api/1/vehicles/1234/command"} {
+			_, _, ok := parseCommandPath(path)
+			So(ok, ShouldBeFalse)
+		}
+	})
+}
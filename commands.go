@@ -1,9 +1,12 @@
 package tesla
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"net/url"
 	"strconv"
+	"strings"
 )
 
 // Response from the Tesla API after POSTing a command
@@ -29,23 +32,38 @@ type SentryData struct {
 
 // Causes the vehicle to abort the Autopark request
 func (v Vehicle) AutoparkAbort() error {
-	return v.autoPark("abort")
+	return v.AutoparkAbortContext(context.Background())
+}
+
+// AutoparkAbortContext is like AutoparkAbort but uses ctx for the requests to the API
+func (v Vehicle) AutoparkAbortContext(ctx context.Context) error {
+	return v.autoPark(ctx, "abort")
 }
 
 // Causes the vehicle to pull forward
 func (v Vehicle) AutoparkForward() error {
-	return v.autoPark("start_forward")
+	return v.AutoparkForwardContext(context.Background())
+}
+
+// AutoparkForwardContext is like AutoparkForward but uses ctx for the requests to the API
+func (v Vehicle) AutoparkForwardContext(ctx context.Context) error {
+	return v.autoPark(ctx, "start_forward")
 }
 
 // Causes the vehicle to go in reverse
 func (v Vehicle) AutoparkReverse() error {
-	return v.autoPark("start_reverse")
+	return v.AutoparkReverseContext(context.Background())
+}
+
+// AutoparkReverseContext is like AutoparkReverse but uses ctx for the requests to the API
+func (v Vehicle) AutoparkReverseContext(ctx context.Context) error {
+	return v.autoPark(ctx, "start_reverse")
 }
 
 // Performs the actual auto park/summon request for the vehicle
-func (v Vehicle) autoPark(action string) error {
-	apiUrl := v.c.BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/autopark_request"
-	driveState, _ := v.DriveState()
+func (v Vehicle) autoPark(ctx context.Context, action string) error {
+	apiUrl := v.c.baseURL() + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/autopark_request"
+	driveState, _ := v.DriveStateContext(ctx)
 	autoParkRequest := &AutoParkRequest{
 		VehicleID: v.VehicleID,
 		Lat:       driveState.Latitude,
@@ -54,19 +72,24 @@ func (v Vehicle) autoPark(action string) error {
 	}
 	body, _ := json.Marshal(autoParkRequest)
 
-	_, err := v.sendCommand(apiUrl, body)
+	_, err := v.sendCommand(ctx, apiUrl, body)
 	return err
 }
 
 // Enables Sentry Mode
 func (v *Vehicle) EnableSentry() error {
-	apiUrl := v.c.BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/set_sentry_mode"
+	return v.EnableSentryContext(context.Background())
+}
+
+// EnableSentryContext is like EnableSentry but uses ctx for the requests to the API
+func (v *Vehicle) EnableSentryContext(ctx context.Context) error {
+	apiUrl := v.c.baseURL() + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/set_sentry_mode"
 	sentryRequest := &SentryData{
 		Mode: "true",
 	}
 
 	body, _ := json.Marshal(sentryRequest)
-	_, err := v.sendCommand(apiUrl, body)
+	_, err := v.sendCommand(ctx, apiUrl, body)
 	return err
 }
 
@@ -89,22 +112,33 @@ func (v *Vehicle) EnableSentry() error {
 // keep in mind this is a toggle and the garage door state is unknown
 // a major limitation of Homelink
 func (v Vehicle) TriggerHomelink() error {
-	apiUrl := v.c.BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/trigger_homelink"
-	driveState, _ := v.DriveState()
+	return v.TriggerHomelinkContext(context.Background())
+}
+
+// TriggerHomelinkContext is like TriggerHomelink but uses ctx for the requests to the API
+func (v Vehicle) TriggerHomelinkContext(ctx context.Context) error {
+	apiUrl := v.c.baseURL() + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/trigger_homelink"
+	driveState, _ := v.DriveStateContext(ctx)
 	autoParkRequest := &AutoParkRequest{
 		Lat: driveState.Latitude,
 		Lon: driveState.Longitude,
 	}
 	body, _ := json.Marshal(autoParkRequest)
 
-	_, err := v.sendCommand(apiUrl, body)
+	_, err := v.sendCommand(ctx, apiUrl, body)
 	return err
 }
 
-// Wakes up the vehicle when it is powered off
+// Wakes up the vehicle when it is powered off. The returned vehicle is
+// usually not online yet, see WaitForOnline.
 func (v Vehicle) Wakeup() (*Vehicle, error) {
-	apiUrl := v.c.BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/wake_up"
-	body, err := v.sendCommand(apiUrl, nil)
+	return v.WakeupContext(context.Background())
+}
+
+// WakeupContext is like Wakeup but uses ctx for the requests to the API
+func (v Vehicle) WakeupContext(ctx context.Context) (*Vehicle, error) {
+	apiUrl := v.c.baseURL() + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/wake_up"
+	body, err := v.sendCommand(ctx, apiUrl, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -112,141 +146,258 @@ func (v Vehicle) Wakeup() (*Vehicle, error) {
 	if err := json.Unmarshal(body, vehicleResponse); err != nil {
 		return nil, err
 	}
+	if vehicleResponse.Response == nil {
+		return nil, errors.New("wake_up returned no vehicle")
+	}
+	vehicleResponse.Response.c = v.c
 	return vehicleResponse.Response, nil
 }
 
 // Opens the charge port so you may insert your charging cable
 func (v Vehicle) OpenChargePort() error {
-	apiUrl := v.c.BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/charge_port_door_open"
-	_, err := v.sendCommand(apiUrl, nil)
+	return v.OpenChargePortContext(context.Background())
+}
+
+// OpenChargePortContext is like OpenChargePort but uses ctx for the requests to the API
+func (v Vehicle) OpenChargePortContext(ctx context.Context) error {
+	apiUrl := v.c.baseURL() + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/charge_port_door_open"
+	_, err := v.sendCommand(ctx, apiUrl, nil)
 	return err
 }
 
 // Resets the PIN set for valet mode, if set
 func (v Vehicle) ResetValetPIN() error {
-	apiUrl := v.c.BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/reset_valet_pin"
-	_, err := v.sendCommand(apiUrl, nil)
+	return v.ResetValetPINContext(context.Background())
+}
+
+// ResetValetPINContext is like ResetValetPIN but uses ctx for the requests to the API
+func (v Vehicle) ResetValetPINContext(ctx context.Context) error {
+	apiUrl := v.c.baseURL() + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/reset_valet_pin"
+	_, err := v.sendCommand(ctx, apiUrl, nil)
 	return err
 }
 
 // Sets the charge limit to the standard setting
 func (v Vehicle) SetChargeLimitStandard() error {
-	apiUrl := v.c.BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/charge_standard"
-	_, err := v.sendCommand(apiUrl, nil)
+	return v.SetChargeLimitStandardContext(context.Background())
+}
+
+// SetChargeLimitStandardContext is like SetChargeLimitStandard but uses ctx for the requests to the API
+func (v Vehicle) SetChargeLimitStandardContext(ctx context.Context) error {
+	apiUrl := v.c.baseURL() + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/charge_standard"
+	_, err := v.sendCommand(ctx, apiUrl, nil)
 	return err
 }
 
 // Sets the charge limit to the max limit
 func (v Vehicle) SetChargeLimitMax() error {
-	apiUrl := v.c.BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/charge_max_range"
-	_, err := v.sendCommand(apiUrl, nil)
+	return v.SetChargeLimitMaxContext(context.Background())
+}
+
+// SetChargeLimitMaxContext is like SetChargeLimitMax but uses ctx for the requests to the API
+func (v Vehicle) SetChargeLimitMaxContext(ctx context.Context) error {
+	apiUrl := v.c.baseURL() + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/charge_max_range"
+	_, err := v.sendCommand(ctx, apiUrl, nil)
 	return err
 }
 
 // Set the charge limit to a custom percentage
 func (v Vehicle) SetChargeLimit(percent int) error {
-	apiUrl := v.c.BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/set_charge_limit"
+	return v.SetChargeLimitContext(context.Background(), percent)
+}
+
+// SetChargeLimitContext is like SetChargeLimit but uses ctx for the requests to the API
+func (v Vehicle) SetChargeLimitContext(ctx context.Context, percent int) error {
+	apiUrl := v.c.baseURL() + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/set_charge_limit"
 	theJson := `{"percent": ` + strconv.Itoa(percent) + `}`
-	_, err := v.c.post(apiUrl, []byte(theJson))
+	_, err := v.sendCommand(ctx, apiUrl, []byte(theJson))
 	return err
 }
 
 // StartCharging starts the charging of the vehicle after you have inserted the
 // charging cable
 func (v Vehicle) StartCharging() error {
-	apiUrl := v.c.BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/charge_start"
-	_, err := v.sendCommand(apiUrl, nil)
+	return v.StartChargingContext(context.Background())
+}
+
+// StartChargingContext is like StartCharging but uses ctx for the requests to the API
+func (v Vehicle) StartChargingContext(ctx context.Context) error {
+	apiUrl := v.c.baseURL() + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/charge_start"
+	_, err := v.sendCommand(ctx, apiUrl, nil)
 	return err
 }
 
 // Stop the charging of the vehicle
 func (v Vehicle) StopCharging() error {
-	apiUrl := v.c.BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/charge_stop"
-	_, err := v.sendCommand(apiUrl, nil)
+	return v.StopChargingContext(context.Background())
+}
+
+// StopChargingContext is like StopCharging but uses ctx for the requests to the API
+func (v Vehicle) StopChargingContext(ctx context.Context) error {
+	apiUrl := v.c.baseURL() + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/charge_stop"
+	_, err := v.sendCommand(ctx, apiUrl, nil)
 	return err
 }
 
 // Flashes the lights of the vehicle
 func (v Vehicle) FlashLights() error {
-	apiUrl := v.c.BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/flash_lights"
-	_, err := v.sendCommand(apiUrl, nil)
+	return v.FlashLightsContext(context.Background())
+}
+
+// FlashLightsContext is like FlashLights but uses ctx for the requests to the API
+func (v Vehicle) FlashLightsContext(ctx context.Context) error {
+	apiUrl := v.c.baseURL() + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/flash_lights"
+	_, err := v.sendCommand(ctx, apiUrl, nil)
 	return err
 }
 
 // Honks the horn of the vehicle
 func (v *Vehicle) HonkHorn() error {
-	apiUrl := v.c.BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/honk_horn"
-	_, err := v.sendCommand(apiUrl, nil)
+	return v.HonkHornContext(context.Background())
+}
+
+// HonkHornContext is like HonkHorn but uses ctx for the requests to the API
+func (v *Vehicle) HonkHornContext(ctx context.Context) error {
+	apiUrl := v.c.baseURL() + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/honk_horn"
+	_, err := v.sendCommand(ctx, apiUrl, nil)
 	return err
 }
 
 // Unlock the car's doors
 func (v Vehicle) UnlockDoors() error {
-	apiUrl := v.c.BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/door_unlock"
-	_, err := v.sendCommand(apiUrl, nil)
+	return v.UnlockDoorsContext(context.Background())
+}
+
+// UnlockDoorsContext is like UnlockDoors but uses ctx for the requests to the API
+func (v Vehicle) UnlockDoorsContext(ctx context.Context) error {
+	apiUrl := v.c.baseURL() + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/door_unlock"
+	_, err := v.sendCommand(ctx, apiUrl, nil)
 	return err
 }
 
 // Locks the doors of the vehicle
 func (v Vehicle) LockDoors() error {
-	apiUrl := v.c.BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/door_lock"
-	_, err := v.sendCommand(apiUrl, nil)
+	return v.LockDoorsContext(context.Background())
+}
+
+// LockDoorsContext is like LockDoors but uses ctx for the requests to the API
+func (v Vehicle) LockDoorsContext(ctx context.Context) error {
+	apiUrl := v.c.baseURL() + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/door_lock"
+	_, err := v.sendCommand(ctx, apiUrl, nil)
 	return err
 }
 
 // Sets the temprature of the vehicle, where you may set the driver
 // zone and the passenger zone to seperate temperatures
 func (v Vehicle) SetTemprature(driver float64, passenger float64) error {
+	return v.SetTempratureContext(context.Background(), driver, passenger)
+}
+
+// SetTempratureContext is like SetTemprature but uses ctx for the requests to the API
+func (v Vehicle) SetTempratureContext(ctx context.Context, driver float64, passenger float64) error {
 	driveTemp := strconv.FormatFloat(driver, 'f', -1, 32)
 	passengerTemp := strconv.FormatFloat(passenger, 'f', -1, 32)
-	apiUrl := v.c.BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/set_temps"
+	apiUrl := v.c.baseURL() + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/set_temps"
 	theJson := `{"driver_temp": "` + driveTemp + `", "passenger_temp":` + passengerTemp + `}`
-	_, err := v.c.post(apiUrl, []byte(theJson))
+	_, err := v.sendCommand(ctx, apiUrl, []byte(theJson))
 	return err
 }
 
 // StartAirConditioning starts the air conditioning in the car
 func (v Vehicle) StartAirConditioning() error {
-	url := v.c.BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/auto_conditioning_start"
-	_, err := v.sendCommand(url, nil)
+	return v.StartAirConditioningContext(context.Background())
+}
+
+// StartAirConditioningContext is like StartAirConditioning but uses ctx for the requests to the API
+func (v Vehicle) StartAirConditioningContext(ctx context.Context) error {
+	url := v.c.baseURL() + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/auto_conditioning_start"
+	_, err := v.sendCommand(ctx, url, nil)
 	return err
 }
 
 // Stops the air conditioning in the car
 func (v Vehicle) StopAirConditioning() error {
-	apiUrl := v.c.BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/auto_conditioning_stop"
-	_, err := v.sendCommand(apiUrl, nil)
+	return v.StopAirConditioningContext(context.Background())
+}
+
+// StopAirConditioningContext is like StopAirConditioning but uses ctx for the requests to the API
+func (v Vehicle) StopAirConditioningContext(ctx context.Context) error {
+	apiUrl := v.c.baseURL() + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/auto_conditioning_stop"
+	_, err := v.sendCommand(ctx, apiUrl, nil)
 	return err
 }
 
 // The desired state of the panoramic roof. The approximate percent open
 // values for each state are open = 100%, close = 0%, comfort = 80%, vent = %15, move = set %
 func (v Vehicle) MovePanoRoof(state string, percent int) error {
-	apiUrl := v.c.BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/sun_roof_control"
+	return v.MovePanoRoofContext(context.Background(), state, percent)
+}
+
+// MovePanoRoofContext is like MovePanoRoof but uses ctx for the requests to the API
+func (v Vehicle) MovePanoRoofContext(ctx context.Context, state string, percent int) error {
+	apiUrl := v.c.baseURL() + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/sun_roof_control"
 	theJson := `{"state": "` + state + `", "percent":` + strconv.Itoa(percent) + `}`
-	_, err := v.c.post(apiUrl, []byte(theJson))
+	_, err := v.sendCommand(ctx, apiUrl, []byte(theJson))
 	return err
 }
 
 // Start starts the car by turning it on, requires the password to be sent
 // again
 func (v Vehicle) Start(password string) error {
-	apiUrl := v.c.BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/remote_start_drive?password=" + password
-	_, err := v.sendCommand(apiUrl, nil)
+	return v.StartContext(context.Background(), password)
+}
+
+// StartContext is like Start but uses ctx for the requests to the API
+func (v Vehicle) StartContext(ctx context.Context, password string) error {
+	apiUrl := v.c.baseURL() + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/remote_start_drive?password=" + url.QueryEscape(password)
+	_, err := v.sendCommand(ctx, apiUrl, nil)
 	return err
 }
 
 // Opens the trunk, where values may be 'front' or 'rear'
 func (v Vehicle) OpenTrunk(trunk string) error {
-	apiUrl := v.c.BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/trunk_open" // ?which_trunk=" + trunk
+	return v.OpenTrunkContext(context.Background(), trunk)
+}
+
+// OpenTrunkContext is like OpenTrunk but uses ctx for the requests to the API
+func (v Vehicle) OpenTrunkContext(ctx context.Context, trunk string) error {
+	apiUrl := v.c.baseURL() + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/trunk_open" // ?which_trunk=" + trunk
 	theJson := `{"which_trunk": "` + trunk + `"}`
-	_, err := v.c.post(apiUrl, []byte(theJson))
+	_, err := v.sendCommand(ctx, apiUrl, []byte(theJson))
 	return err
 }
 
-// Sends a command to the vehicle
-func (v *Vehicle) sendCommand(url string, reqBody []byte) ([]byte, error) {
-	body, err := v.c.post(url, reqBody)
+// Sends a command to the vehicle, waking it first if it is asleep and the
+// wake policy allows it
+func (v *Vehicle) sendCommand(ctx context.Context, url string, reqBody []byte) ([]byte, error) {
+	var body []byte
+	err := v.withWake(ctx, commandNameFromPath(strings.SplitN(url, "?", 2)[0]), func() (err error) {
+		body, err = v.postCommand(ctx, url, reqBody)
+		return err
+	})
+	return body, err
+}
+
+// Posts a command to the vehicle, as a signed message if the client has a
+// command key and the command has a signed encoding
+func (v *Vehicle) postCommand(ctx context.Context, url string, reqBody []byte) ([]byte, error) {
+	kind := command
+	if strings.HasSuffix(url, "/wake_up") {
+		kind = wakeup
+	}
+	if err := v.c.rateLimit(ctx, v.ID, kind); err != nil {
+		return nil, err
+	}
+	if kind == command {
+		name := commandNameFromPath(strings.SplitN(url, "?", 2)[0])
+		if d, payload, ok := encodeCommand(name, reqBody); ok && v.signsCommands() {
+			return v.sendSignedCommand(ctx, d, payload)
+		}
+		if v.CommandSigning == "required" {
+			return nil, ErrSigningRequired
+		}
+	}
+	body, err := v.c.post(ctx, url, reqBody)
 	if err != nil {
 		return nil, err
 	}
@@ -256,7 +407,7 @@ func (v *Vehicle) sendCommand(url string, reqBody []byte) ([]byte, error) {
 			return nil, err
 		}
 		if !response.Response.Result && response.Response.Reason != "" {
-			return nil, errors.New(response.Response.Reason)
+			return nil, &CommandError{Reason: response.Response.Reason, Body: body}
 		}
 	}
 	return body, nil
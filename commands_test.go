@@ -1,6 +1,8 @@
 package tesla
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -16,8 +18,6 @@ var (
 func TestCommandsSpec(t *testing.T) {
 	ts := serveHTTP(t)
 	defer ts.Close()
-	previousAuthURL := AuthURL
-	AuthURL = ts.URL + "/oauth/token"
 
 	auth := &Auth{
 		GrantType:    "password",
@@ -26,8 +26,7 @@ func TestCommandsSpec(t *testing.T) {
 		Email:        "elon@tesla.com",
 		Password:     "go",
 	}
-	client, _ := NewClient(auth)
-	client.BaseURL = ts.URL + "/api/1"
+	client, _ := NewClient(auth, testOptions(ts)...)
 
 	Convey("Should auto park abort Autopark", t, func() {
 		vehicles, err := client.Vehicles()
@@ -219,5 +218,12 @@ func TestCommandsSpec(t *testing.T) {
 		})
 	})
 
-	AuthURL = previousAuthURL
+	Convey("Should not send a command with a canceled context", t, func() {
+		vehicles, err := client.Vehicles()
+		So(err, ShouldBeNil)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err = vehicles[0].HonkHornContext(ctx)
+		So(errors.Is(err, context.Canceled), ShouldBeTrue)
+	})
 }
@@ -0,0 +1,247 @@
+package tesla
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// OnlineState tells whether a vehicle is online, asleep or offline
+type OnlineState string
+
+const (
+	StateOnline  OnlineState = "online"
+	StateAsleep  OnlineState = "asleep"
+	StateOffline OnlineState = "offline"
+)
+
+func (s OnlineState) String() string { return string(s) }
+
+// UnmarshalJSON keeps unknown values and reads null as empty
+func (s *OnlineState) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum(data, (*string)(s))
+}
+
+// IsOnline indicates whether the vehicle is online
+func (s OnlineState) IsOnline() bool { return s == StateOnline }
+
+// IsAsleep indicates whether the vehicle is asleep
+func (s OnlineState) IsAsleep() bool { return s == StateAsleep }
+
+// ChargingState tells whether a vehicle is plugged in and charging
+type ChargingState string
+
+const (
+	ChargingDisconnected ChargingState = "Disconnected"
+	ChargingNoPower      ChargingState = "NoPower"
+	ChargingStarting     ChargingState = "Starting"
+	ChargingCharging     ChargingState = "Charging"
+	ChargingStopped      ChargingState = "Stopped"
+	ChargingComplete     ChargingState = "Complete"
+)
+
+func (s ChargingState) String() string { return string(s) }
+
+// UnmarshalJSON keeps unknown values and reads null as empty
+func (s *ChargingState) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum(data, (*string)(s))
+}
+
+// IsCharging indicates whether the vehicle is charging or about to
+func (s ChargingState) IsCharging() bool {
+	return s == ChargingCharging || s == ChargingStarting
+}
+
+// IsPluggedIn indicates whether a charge cable is connected to the vehicle
+func (s ChargingState) IsPluggedIn() bool {
+	return s != "" && s != ChargingDisconnected
+}
+
+// IsComplete indicates whether the vehicle charged up to the charge limit
+func (s ChargingState) IsComplete() bool { return s == ChargingComplete }
+
+// ChargePortLatch tells whether the charge port latches the cable
+type ChargePortLatch string
+
+const (
+	LatchEngaged    ChargePortLatch = "Engaged"
+	LatchDisengaged ChargePortLatch = "Disengaged"
+	LatchBlocking   ChargePortLatch = "Blocking"
+	LatchInvalid    ChargePortLatch = "<invalid>"
+)
+
+func (l ChargePortLatch) String() string { return string(l) }
+
+// UnmarshalJSON keeps unknown values and reads null as empty
+func (l *ChargePortLatch) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum(data, (*string)(l))
+}
+
+// IsEngaged indicates whether the charge port latches the cable
+func (l ChargePortLatch) IsEngaged() bool { return l == LatchEngaged }
+
+// FastChargerType is the type of the DC charger a vehicle is connected to
+type FastChargerType string
+
+const (
+	FastChargerSupercharger FastChargerType = "Supercharger"
+	FastChargerCHAdeMO      FastChargerType = "CHAdeMO"
+	FastChargerCombo        FastChargerType = "Combo"
+	FastChargerACSingleWire FastChargerType = "ACSingleWireCAN"
+	FastChargerMCSingleWire FastChargerType = "MCSingleWireCAN"
+	FastChargerInvalid      FastChargerType = "<invalid>"
+)
+
+func (t FastChargerType) String() string { return string(t) }
+
+// UnmarshalJSON keeps unknown values and reads null as empty
+func (t *FastChargerType) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum(data, (*string)(t))
+}
+
+// IsSupercharger indicates whether the vehicle is connected to a Supercharger
+func (t FastChargerType) IsSupercharger() bool { return t == FastChargerSupercharger }
+
+// ChargeCable is the type of the charge cable connected to a vehicle
+type ChargeCable string
+
+const (
+	CableSAE     ChargeCable = "SAE"
+	CableIEC     ChargeCable = "IEC"
+	CableGBAC    ChargeCable = "GB_AC"
+	CableGBDC    ChargeCable = "GB_DC"
+	CableInvalid ChargeCable = "<invalid>"
+)
+
+func (c ChargeCable) String() string { return string(c) }
+
+// UnmarshalJSON keeps unknown values and reads null as empty
+func (c *ChargeCable) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum(data, (*string)(c))
+}
+
+// IsConnected indicates whether a charge cable is connected
+func (c ChargeCable) IsConnected() bool {
+	return c != "" && c != CableInvalid
+}
+
+// ShiftState is the gear a vehicle is in, empty while it is not driven
+type ShiftState string
+
+const (
+	ShiftPark    ShiftState = "P"
+	ShiftReverse ShiftState = "R"
+	ShiftNeutral ShiftState = "N"
+	ShiftDrive   ShiftState = "D"
+)
+
+func (s ShiftState) String() string { return string(s) }
+
+// UnmarshalJSON keeps unknown values and reads null as empty
+func (s *ShiftState) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum(data, (*string)(s))
+}
+
+// IsDriving indicates whether the vehicle is in drive, reverse or neutral
+func (s ShiftState) IsDriving() bool {
+	return s == ShiftDrive || s == ShiftReverse || s == ShiftNeutral
+}
+
+// IsParked indicates whether the vehicle is parked, which it also is while
+// the shift state is not reported
+func (s ShiftState) IsParked() bool {
+	return s == ShiftPark || s == ""
+}
+
+// SunRoofState is the position of the sun roof
+type SunRoofState string
+
+const (
+	SunRoofUnknown     SunRoofState = "unknown"
+	SunRoofOpen        SunRoofState = "open"
+	SunRoofClosed      SunRoofState = "closed"
+	SunRoofVent        SunRoofState = "vent"
+	SunRoofComfort     SunRoofState = "comfort"
+	SunRoofMoving      SunRoofState = "moving"
+	SunRoofCalibrating SunRoofState = "calibrating"
+)
+
+func (s SunRoofState) String() string { return string(s) }
+
+// UnmarshalJSON keeps unknown values and reads null as empty
+func (s *SunRoofState) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum(data, (*string)(s))
+}
+
+// IsOpen indicates whether the sun roof is open, at least partly
+func (s SunRoofState) IsOpen() bool {
+	return s == SunRoofOpen || s == SunRoofVent || s == SunRoofComfort
+}
+
+// ClimateKeeperMode is the mode keeping the cabin conditioned while parked
+type ClimateKeeperMode string
+
+const (
+	ClimateKeeperOff  ClimateKeeperMode = "off"
+	ClimateKeeperOn   ClimateKeeperMode = "on"
+	ClimateKeeperDog  ClimateKeeperMode = "dog"
+	ClimateKeeperCamp ClimateKeeperMode = "camp"
+)
+
+func (m ClimateKeeperMode) String() string { return string(m) }
+
+// UnmarshalJSON keeps unknown values and reads null as empty
+func (m *ClimateKeeperMode) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum(data, (*string)(m))
+}
+
+// IsOn indicates whether the climate keeper conditions the cabin
+func (m ClimateKeeperMode) IsOn() bool {
+	return m != "" && m != ClimateKeeperOff
+}
+
+// SoftwareUpdateStatus is the progress of a software update
+type SoftwareUpdateStatus string
+
+const (
+	UpdateNone             SoftwareUpdateStatus = ""
+	UpdateAvailable        SoftwareUpdateStatus = "available"
+	UpdateScheduled        SoftwareUpdateStatus = "scheduled"
+	UpdateDownloading      SoftwareUpdateStatus = "downloading"
+	UpdateDownloadWifiWait SoftwareUpdateStatus = "downloading_wifi_wait"
+	UpdateInstalling       SoftwareUpdateStatus = "installing"
+)
+
+func (s SoftwareUpdateStatus) String() string { return string(s) }
+
+// UnmarshalJSON keeps unknown values and reads null as empty
+func (s *SoftwareUpdateStatus) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum(data, (*string)(s))
+}
+
+// IsPending indicates whether an update is available, scheduled or downloading
+func (s SoftwareUpdateStatus) IsPending() bool {
+	switch s {
+	case UpdateAvailable, UpdateScheduled, UpdateDownloading, UpdateDownloadWifiWait:
+		return true
+	}
+	return false
+}
+
+// IsInstalling indicates whether an update is being installed
+func (s SoftwareUpdateStatus) IsInstalling() bool { return s == UpdateInstalling }
+
+// Reads an enum from JSON. Null is read as empty and values of other types
+// than strings are kept as their JSON text, so that changes of the API do
+// not fail the decoding of the whole state.
+func unmarshalEnum(data []byte, s *string) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		*s = ""
+		return nil
+	case len(data) > 0 && data[0] == '"':
+		return json.Unmarshal(data, s)
+	}
+	*s = string(data)
+	return nil
+}
@@ -0,0 +1,72 @@
+package tesla
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEnumsSpec(t *testing.T) {
+	Convey("Should decode the known values", t, func() {
+		charge := &ChargeState{}
+		So(json.Unmarshal([]byte(`{"charging_state":"Charging","charge_port_latch":"Engaged","conn_charge_cable":"IEC","fast_charger_type":"Supercharger"}`), charge), ShouldBeNil)
+		So(charge.ChargingState, ShouldEqual, ChargingCharging)
+		So(charge.ChargePortLatch, ShouldEqual, LatchEngaged)
+		So(charge.ConnChargeCable, ShouldEqual, CableIEC)
+		So(charge.FastChargerType.IsSupercharger(), ShouldBeTrue)
+	})
+
+	Convey("Should keep unknown values", t, func() {
+		charge := &ChargeState{}
+		So(json.Unmarshal([]byte(`{"charging_state":"Calibrating","charge_port_latch":7}`), charge), ShouldBeNil)
+		So(charge.ChargingState.String(), ShouldEqual, "Calibrating")
+		So(charge.ChargingState.IsCharging(), ShouldBeFalse)
+		So(charge.ChargePortLatch.String(), ShouldEqual, "7")
+	})
+
+	Convey("Should read null as empty", t, func() {
+		drive := &DriveState{}
+		So(json.Unmarshal([]byte(DriveStateJSON), &struct {
+			Response *DriveState `json:"response"`
+		}{drive}), ShouldBeNil)
+		So(drive.ShiftState, ShouldEqual, "")
+		So(drive.ShiftState.IsParked(), ShouldBeTrue)
+		So(drive.ShiftState.IsDriving(), ShouldBeFalse)
+	})
+
+	Convey("Should tell the state of the vehicle", t, func() {
+		So(ShiftDrive.IsDriving(), ShouldBeTrue)
+		So(ShiftReverse.IsDriving(), ShouldBeTrue)
+		So(ShiftPark.IsDriving(), ShouldBeFalse)
+		So(ChargingStarting.IsCharging(), ShouldBeTrue)
+		So(ChargingComplete.IsPluggedIn(), ShouldBeTrue)
+		So(ChargingComplete.IsComplete(), ShouldBeTrue)
+		So(ChargingDisconnected.IsPluggedIn(), ShouldBeFalse)
+		So(ChargingState("").IsPluggedIn(), ShouldBeFalse)
+		So(CableInvalid.IsConnected(), ShouldBeFalse)
+		So(CableSAE.IsConnected(), ShouldBeTrue)
+		So(StateOnline.IsOnline(), ShouldBeTrue)
+		So(StateAsleep.IsAsleep(), ShouldBeTrue)
+		So(SunRoofVent.IsOpen(), ShouldBeTrue)
+		So(SunRoofClosed.IsOpen(), ShouldBeFalse)
+		So(ClimateKeeperDog.IsOn(), ShouldBeTrue)
+		So(ClimateKeeperOff.IsOn(), ShouldBeFalse)
+		So(UpdateAvailable.IsPending(), ShouldBeTrue)
+		So(UpdateInstalling.IsPending(), ShouldBeFalse)
+		So(UpdateDownloadWifiWait.IsPending(), ShouldBeTrue)
+		So(SoftwareUpdateStatus("failed").IsPending(), ShouldBeFalse)
+		So(UpdateInstalling.IsInstalling(), ShouldBeTrue)
+	})
+
+	Convey("Should encode the values as strings", t, func() {
+		state := &VehicleState{SunRoofState: SunRoofOpen}
+		state.SoftwareUpdate.Status = UpdateScheduled
+		b, err := json.Marshal(state)
+		So(err, ShouldBeNil)
+		decoded := &VehicleState{}
+		So(json.Unmarshal(b, decoded), ShouldBeNil)
+		So(decoded.SunRoofState, ShouldEqual, SunRoofOpen)
+		So(decoded.SoftwareUpdate.Status, ShouldEqual, UpdateScheduled)
+	})
+}
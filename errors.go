@@ -0,0 +1,144 @@
+package tesla
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sentinel errors to be matched with errors.Is against the errors returned
+// by the client
+var (
+	// ErrUnauthorized is matched by responses with status 401, when the
+	// token is invalid or expired
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrVehicleUnavailable is matched by responses with status 408, when
+	// the vehicle is asleep or offline
+	ErrVehicleUnavailable = errors.New("vehicle unavailable")
+	// ErrVehicleAsleep is an alias of ErrVehicleUnavailable, as the API does
+	// not distinguish between sleeping and offline vehicles
+	ErrVehicleAsleep = ErrVehicleUnavailable
+	// ErrVehicleInService is matched by responses rejected because the
+	// vehicle is currently in service
+	ErrVehicleInService = errors.New("vehicle in service")
+	// ErrRateLimited is matched by responses with status 429. The APIError
+	// carries the delay requested by the API in RetryAfter.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrCommandFailed is matched by every CommandError
+	ErrCommandFailed = errors.New("command failed")
+)
+
+// Command errors for well-known reasons returned by the API. They are matched
+// with errors.Is by any CommandError with the same reason.
+var (
+	ErrCouldNotWakeBuses = &CommandError{Reason: "could_not_wake_buses"}
+	ErrIsCharging        = &CommandError{Reason: "is_charging"}
+	ErrNotCharging       = &CommandError{Reason: "not_charging"}
+	ErrComplete          = &CommandError{Reason: "complete"}
+	ErrAlreadyStandard   = &CommandError{Reason: "already_standard"}
+	ErrAlreadyMaxRange   = &CommandError{Reason: "already_max_range"}
+	ErrDisconnected      = &CommandError{Reason: "disconnected"}
+	ErrUserPresent       = &CommandError{Reason: "user_present"}
+)
+
+// The error reported by the API for vehicles in service
+const vehicleInService = "vehicle is currently in service"
+
+// APIError is returned when the Tesla API responds with a status other than 200
+type APIError struct {
+	StatusCode int
+	Status     string
+	// Message is the error reported in the response body, if any
+	Message string
+	// RetryAfter is the delay requested by the Retry-After header, if any
+	RetryAfter time.Duration
+	// Body is the raw response body
+	Body []byte
+}
+
+// The error details contained in the body of a failed response
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Creates the error for a failed response and its body
+func newAPIError(res *http.Response, body []byte) *APIError {
+	e := &APIError{
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		RetryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+		Body:       body,
+	}
+	details := &errorResponse{}
+	if json.Unmarshal(body, details) == nil {
+		e.Message = details.Error
+		if details.ErrorDescription != "" {
+			e.Message += ": " + details.ErrorDescription
+		}
+	}
+	return e
+}
+
+// Parses the Retry-After header, which holds either seconds or an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return e.Status + ": " + e.Message
+	}
+	return e.Status
+}
+
+// Is reports whether the error matches one of the sentinel errors
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrVehicleUnavailable:
+		return e.StatusCode == http.StatusRequestTimeout
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrVehicleInService:
+		return e.Message == vehicleInService || strings.HasPrefix(e.Message, vehicleInService+": ")
+	}
+	return false
+}
+
+// CommandError is returned when the vehicle refuses a command
+type CommandError struct {
+	// Reason is the raw reason reported by the API, e.g. "is_charging"
+	Reason string
+	// Body is the raw response body
+	Body []byte
+}
+
+func (e *CommandError) Error() string {
+	return e.Reason
+}
+
+// Is reports whether the error is ErrCommandFailed or a CommandError with the
+// same reason
+func (e *CommandError) Is(target error) bool {
+	if target == ErrCommandFailed {
+		return true
+	}
+	t, ok := target.(*CommandError)
+	return ok && t.Reason == e.Reason
+}
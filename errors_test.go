@@ -0,0 +1,99 @@
+package tesla
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var (
+	VehicleUnavailableJSON = `{"response":null,"error":"vehicle unavailable: {:error=>\"vehicle unavailable:\"}","error_description":""}`
+	VehicleInServiceJSON   = `{"response":null,"error":"vehicle is currently in service","error_description":""}`
+	IsChargingJSON         = `{"response":{"reason":"is_charging","result":false}}`
+)
+
+func TestErrorsSpec(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/1/vehicles/408":
+			w.WriteHeader(http.StatusRequestTimeout)
+			w.Write([]byte(VehicleUnavailableJSON))
+		case "/api/1/vehicles/405":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte(VehicleInServiceJSON))
+		case "/api/1/vehicles/429":
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/api/1/vehicles/401":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/api/1/vehicles/1234/command/charge_start":
+			w.WriteHeader(200)
+			w.Write([]byte(IsChargingJSON))
+		}
+	}))
+	defer ts.Close()
+
+	client := &Client{
+		HTTP:    &http.Client{},
+		Token:   &Token{AccessToken: "foo", Expires: 99999999999},
+		BaseURL: ts.URL + "/api/1",
+	}
+
+	Convey("Should return an unavailable vehicle error", t, func() {
+		_, err := client.Vehicle(408)
+		So(errors.Is(err, ErrVehicleUnavailable), ShouldBeTrue)
+		So(errors.Is(err, ErrVehicleAsleep), ShouldBeTrue)
+		So(errors.Is(err, ErrUnauthorized), ShouldBeFalse)
+		var apiErr *APIError
+		So(errors.As(err, &apiErr), ShouldBeTrue)
+		So(apiErr.StatusCode, ShouldEqual, 408)
+		So(string(apiErr.Body), ShouldEqual, VehicleUnavailableJSON)
+		So(err.Error(), ShouldStartWith, "408 Request Timeout: vehicle unavailable")
+	})
+
+	Convey("Should return an in service error", t, func() {
+		_, err := client.Vehicle(405)
+		So(errors.Is(err, ErrVehicleInService), ShouldBeTrue)
+	})
+
+	Convey("Should not match other errors mentioning a service", t, func() {
+		err := &APIError{StatusCode: http.StatusBadRequest, Message: "charger not in service"}
+		So(errors.Is(err, ErrVehicleInService), ShouldBeFalse)
+	})
+
+	Convey("Should return a rate limited error with the retry delay", t, func() {
+		_, err := client.Vehicle(429)
+		So(errors.Is(err, ErrRateLimited), ShouldBeTrue)
+		var apiErr *APIError
+		So(errors.As(err, &apiErr), ShouldBeTrue)
+		So(apiErr.RetryAfter, ShouldEqual, 30*time.Second)
+	})
+
+	Convey("Should return an unauthorized error", t, func() {
+		_, err := client.Vehicle(401)
+		So(errors.Is(err, ErrUnauthorized), ShouldBeTrue)
+		So(err.Error(), ShouldEqual, "401 Unauthorized")
+	})
+
+	Convey("Should return a command error with the reason", t, func() {
+		vehicle := &Vehicle{ID: 1234, c: client}
+		err := vehicle.StartCharging()
+		So(errors.Is(err, ErrCommandFailed), ShouldBeTrue)
+		So(errors.Is(err, ErrIsCharging), ShouldBeTrue)
+		So(errors.Is(err, ErrNotCharging), ShouldBeFalse)
+		var cmdErr *CommandError
+		So(errors.As(err, &cmdErr), ShouldBeTrue)
+		So(cmdErr.Reason, ShouldEqual, "is_charging")
+		So(string(cmdErr.Body), ShouldEqual, IsChargingJSON)
+	})
+
+	Convey("Should parse Retry-After dates", t, func() {
+		d := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+		So(d, ShouldBeBetween, 58*time.Second, 61*time.Second)
+		So(parseRetryAfter("garbage"), ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,346 @@
+package tesla
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// API is the backend the client sends its requests to
+type API int
+
+const (
+	// OwnerAPI is the API of the Tesla app, authorized by logging in with
+	// the credentials of the owner
+	OwnerAPI API = iota
+	// FleetAPI is the API for applications registered with the Tesla
+	// developer portal, authorized by partner and third-party tokens
+	FleetAPI
+)
+
+// Scopes a user may grant to an application using the Fleet API
+const (
+	ScopeOpenID              = "openid"
+	ScopeOfflineAccess       = "offline_access"
+	ScopeUserData            = "user_data"
+	ScopeVehicleDeviceData   = "vehicle_device_data"
+	ScopeVehicleLocation     = "vehicle_location"
+	ScopeVehicleCmds         = "vehicle_cmds"
+	ScopeVehicleChargingCmds = "vehicle_charging_cmds"
+	ScopeEnergyDeviceData    = "energy_device_data"
+	ScopeEnergyCmds          = "energy_cmds"
+)
+
+// DefaultScopes are the scopes requested if Auth.Scopes is empty
+var DefaultScopes = []string{
+	ScopeOpenID,
+	ScopeOfflineAccess,
+	ScopeVehicleDeviceData,
+	ScopeVehicleCmds,
+	ScopeVehicleChargingCmds,
+}
+
+// ErrUnsupported is returned by methods the API of the client does not offer,
+// e.g. Stream on the Fleet API
+var ErrUnsupported = errors.New("not supported by the API")
+
+// The partner account of an application, as returned by the Fleet API
+type PartnerAccount struct {
+	ClientID    string `json:"client_id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Domain      string `json:"domain"`
+	PublicKey   string `json:"public_key"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+// NewPartnerClient Generates a new client for the Fleet API authorized by a
+// partner token, which is obtained with the client credentials of the
+// application. The partner token registers the application in a region with
+// RegisterPartnerAccount and is renewed when it expires.
+func NewPartnerClient(auth *Auth, options ...ClientOption) (*Client, error) {
+	client := newClient(auth, append([]ClientOption{WithFleetAPI()}, options...))
+	client.partner = true
+	token, err := client.partnerToken(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	client.Token = token
+	return client, nil
+}
+
+// AuthCodeURL returns the URL of the page where the user grants the scopes
+// of auth to the application. The user is then redirected to auth.RedirectURL
+// with the state and an authorization code for NewClientWithCode.
+func AuthCodeURL(auth *Auth, state string, options ...ClientOption) string {
+	client := newClient(auth, append([]ClientOption{WithFleetAPI()}, options...))
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", auth.ClientID)
+	q.Set("redirect_uri", auth.RedirectURL)
+	q.Set("scope", strings.Join(auth.scopes(), " "))
+	q.Set("state", state)
+	return client.SSOURL + "/authorize?" + q.Encode()
+}
+
+// NewClientWithCode Generates a new client for the Fleet API by exchanging the
+// authorization code obtained through AuthCodeURL for a third-party token
+func NewClientWithCode(auth *Auth, code string, options ...ClientOption) (*Client, error) {
+	client := newClient(auth, append([]ClientOption{WithFleetAPI()}, options...))
+	token, err := client.fleetToken(context.Background(), url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {auth.ClientID},
+		"client_secret": {auth.ClientSecret},
+		"code":          {code},
+		"audience":      {client.audience()},
+		"redirect_uri":  {auth.RedirectURL},
+	})
+	if err != nil {
+		return nil, err
+	}
+	client.Token = token
+	if region, ok := RegionFromToken(token.AccessToken); ok {
+		client.detectRegion(region)
+	}
+	return client, nil
+}
+
+// Returns the requested scopes
+func (a *Auth) scopes() []string {
+	if len(a.Scopes) == 0 {
+		return DefaultScopes
+	}
+	return a.Scopes
+}
+
+// Returns the audience of Fleet API tokens, which is the Fleet API host. It
+// is only called by constructors and while the token is renewed under the lock.
+func (c *Client) audience() string {
+	return strings.TrimSuffix(c.BaseURL, "/api/1")
+}
+
+// Obtains a partner token with the client credentials of the application
+func (c *Client) partnerToken(ctx context.Context) (*Token, error) {
+	return c.fleetToken(ctx, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {c.Auth.ClientID},
+		"client_secret": {c.Auth.ClientSecret},
+		"scope":         {strings.Join(c.Auth.scopes(), " ")},
+		"audience":      {c.audience()},
+	})
+}
+
+// Renews the partner or third-party token of a Fleet API client
+func (c *Client) renewFleetToken(ctx context.Context) (*Token, error) {
+	if c.partner {
+		return c.partnerToken(ctx)
+	}
+	clientID := ""
+	if c.Auth != nil {
+		clientID = c.Auth.ClientID
+	}
+	return c.fleetToken(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {clientID},
+		"refresh_token": {c.Token.RefreshToken},
+	})
+}
+
+// Posts a form to the Fleet API token endpoint
+func (c *Client) fleetToken(ctx context.Context, form url.Values) (*Token, error) {
+	now := time.Now()
+	req, _ := http.NewRequestWithContext(ctx, "POST", c.FleetAuthURL+"/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	c.logf("%s %s: %s", req.Method, redactURL(req.URL), res.Status)
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, newAPIError(res, body)
+	}
+	token := &Token{}
+	if err := json.Unmarshal(body, token); err != nil {
+		return nil, err
+	}
+	token.Expires = now.Add(time.Second * time.Duration(token.ExpiresIn)).Unix()
+	return token, nil
+}
+
+// RegisterPartnerAccount registers the application in the region of the
+// client. The domain must serve the public key of the application at
+// /.well-known/appspecific/com.tesla.3p.public-key.pem. It requires a
+// partner token, see NewPartnerClient.
+func (c *Client) RegisterPartnerAccount(domain string) (*PartnerAccount, error) {
+	return c.RegisterPartnerAccountContext(context.Background(), domain)
+}
+
+// RegisterPartnerAccountContext is like RegisterPartnerAccount but uses ctx for the requests to the API
+func (c *Client) RegisterPartnerAccountContext(ctx context.Context, domain string) (*PartnerAccount, error) {
+	data, _ := json.Marshal(map[string]string{"domain": domain})
+	body, err := c.post(ctx, c.baseURL()+"/partner_accounts", data)
+	if err != nil {
+		return nil, err
+	}
+	resp := &struct {
+		Response *PartnerAccount `json:"response"`
+	}{}
+	if err := json.Unmarshal(body, resp); err != nil {
+		return nil, err
+	}
+	return resp.Response, nil
+}
+
+// PartnerPublicKey returns the public key registered for the domain, hex encoded
+func (c *Client) PartnerPublicKey(domain string) (string, error) {
+	return c.PartnerPublicKeyContext(context.Background(), domain)
+}
+
+// PartnerPublicKeyContext is like PartnerPublicKey but uses ctx for the requests to the API
+func (c *Client) PartnerPublicKeyContext(ctx context.Context, domain string) (string, error) {
+	resp := &struct {
+		Response struct {
+			PublicKey string `json:"public_key"`
+		} `json:"response"`
+	}{}
+	if err := c.getJSON(ctx, c.baseURL()+"/partner_accounts/public_key?domain="+url.QueryEscape(domain), resp); err != nil {
+		return "", err
+	}
+	return resp.Response.PublicKey, nil
+}
+
+// Fetches a state from the Fleet API, which serves the states as part of the
+// vehicle data, except for the service data
+func (c *Client) fetchFleetState(ctx context.Context, resource string, id int64) (*StateRequest, error) {
+	vehicleURL := c.baseURL() + "/vehicles/" + strconv.FormatInt(id, 10)
+	stateRequest := &StateRequest{}
+	if resource == "/service_data" {
+		if err := c.getJSON(ctx, vehicleURL+resource, stateRequest); err != nil {
+			return nil, err
+		}
+		return stateRequest, nil
+	}
+	name := strings.TrimPrefix(resource, "/")
+	endpoints := name
+	if name == "drive_state" {
+		// The location is only included on request
+		endpoints += ";location_data"
+	}
+	data := &struct {
+		Response map[string]json.RawMessage `json:"response"`
+	}{}
+	if err := c.getJSON(ctx, vehicleURL+"/vehicle_data?endpoints="+url.QueryEscape(endpoints), data); err != nil {
+		return nil, err
+	}
+	state, ok := data.Response[name]
+	if !ok {
+		return nil, fmt.Errorf("vehicle data without %s", name)
+	}
+	if err := json.Unmarshal(state, &stateRequest.Response); err != nil {
+		return nil, err
+	}
+	if err := stateRequest.decodeState(resource, state); err != nil {
+		return nil, err
+	}
+	return stateRequest, nil
+}
+
+// FleetTelemetryConfig tells vehicles which fields to stream to a Fleet
+// Telemetry server and how often
+type FleetTelemetryConfig struct {
+	// Hostname is the host of the server, which vehicles connect to over mTLS
+	Hostname string `json:"hostname"`
+	// CA is the PEM encoded certificate chain the server certificate is verified with
+	CA   string `json:"ca"`
+	Port int    `json:"port,omitempty"`
+	// Expires is the Unix time at which vehicles stop streaming
+	Expires int64 `json:"exp,omitempty"`
+	// Fields maps the names of the fields, e.g. "BatteryLevel", to their interval
+	Fields map[string]FleetTelemetryField `json:"fields"`
+	// AlertTypes are the audiences of the alerts streamed, e.g. "service"
+	AlertTypes []string `json:"alert_types,omitempty"`
+}
+
+// FleetTelemetryField is the streaming interval of a field
+type FleetTelemetryField struct {
+	IntervalSeconds int `json:"interval_seconds"`
+}
+
+// FleetTelemetryResult reports the vehicles a configuration was pushed to
+type FleetTelemetryResult struct {
+	UpdatedVehicles int `json:"updated_vehicles"`
+	// SkippedVehicles maps the reasons, e.g. "missing_key", to the VINs skipped
+	SkippedVehicles map[string][]string `json:"skipped_vehicles"`
+}
+
+// ConfigureFleetTelemetry pushes the configuration to the vehicles with the
+// VINs. Vehicles only accept it once the command key of the application is
+// paired with them.
+func (c *Client) ConfigureFleetTelemetry(config *FleetTelemetryConfig, vins ...string) (*FleetTelemetryResult, error) {
+	return c.ConfigureFleetTelemetryContext(context.Background(), config, vins...)
+}
+
+// ConfigureFleetTelemetryContext is like ConfigureFleetTelemetry but uses ctx for the requests to the API
+func (c *Client) ConfigureFleetTelemetryContext(ctx context.Context, config *FleetTelemetryConfig, vins ...string) (*FleetTelemetryResult, error) {
+	if c.API != FleetAPI {
+		return nil, ErrUnsupported
+	}
+	data, err := json.Marshal(&struct {
+		VINs   []string              `json:"vins"`
+		Config *FleetTelemetryConfig `json:"config"`
+	}{vins, config})
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.post(ctx, c.baseURL()+"/vehicles/fleet_telemetry_config", data)
+	if err != nil {
+		return nil, err
+	}
+	resp := &struct {
+		Response *FleetTelemetryResult `json:"response"`
+	}{}
+	if err := json.Unmarshal(body, resp); err != nil {
+		return nil, err
+	}
+	return resp.Response, nil
+}
+
+// FleetTelemetryConfig returns the configuration the vehicle streams with and
+// whether the vehicle has synced it
+func (v *Vehicle) FleetTelemetryConfig() (*FleetTelemetryConfig, bool, error) {
+	return v.FleetTelemetryConfigContext(context.Background())
+}
+
+// FleetTelemetryConfigContext is like FleetTelemetryConfig but uses ctx for the requests to the API
+func (v *Vehicle) FleetTelemetryConfigContext(ctx context.Context) (*FleetTelemetryConfig, bool, error) {
+	if v.c.API != FleetAPI {
+		return nil, false, ErrUnsupported
+	}
+	resp := &struct {
+		Response struct {
+			Synced bool                  `json:"synced"`
+			Config *FleetTelemetryConfig `json:"config"`
+		} `json:"response"`
+	}{}
+	if err := v.c.getJSON(ctx, v.c.baseURL()+"/vehicles/"+v.Vin+"/fleet_telemetry_config", resp); err != nil {
+		return nil, false, err
+	}
+	return resp.Response.Config, resp.Response.Synced, nil
+}
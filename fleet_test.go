@@ -0,0 +1,200 @@
+package tesla
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var (
+	PartnerTokenJSON    = `{"access_token":"partner123","token_type":"Bearer","expires_in":28800}`
+	FleetTokenJSON      = `{"access_token":"fleet123","refresh_token":"fleetrefresh123","id_token":"id123","token_type":"Bearer","expires_in":28800}`
+	PartnerAccountJSON  = `{"response":{"client_id":"abc123","name":"My App","domain":"example.com","public_key":"04abcd"}}`
+	PublicKeyJSON       = `{"response":{"public_key":"04abcd"}}`
+	FleetDriveStateJSON = `{"response":{"id":1234,"drive_state":{"latitude":35.1,"longitude":20.2,"shift_state":null,"speed":null}}}`
+	TelemetryResultJSON = `{"response":{"updated_vehicles":1,"skipped_vehicles":{"missing_key":["def456"],"unsupported_hardware":[],"unsupported_firmware":[]}}}`
+	TelemetryConfigJSON = `{"response":{"synced":true,"config":{"hostname":"telemetry.example.com","ca":"","port":443,"exp":1700000000,"fields":{"BatteryLevel":{"interval_seconds":60}}}}}`
+)
+
+// Serves a stand-in for the Fleet API and its token endpoint
+func serveFleet(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/oauth2/v3/token":
+			req.ParseForm()
+			Convey("Token request should be a form of the application", t, func() {
+				So(req.Header.Get("Content-Type"), ShouldEqual, "application/x-www-form-urlencoded")
+				So(req.PostForm.Get("client_id"), ShouldEqual, "abc123")
+			})
+			switch req.PostForm.Get("grant_type") {
+			case "client_credentials":
+				Convey("Partner token request should carry the credentials", t, func() {
+					So(req.PostForm.Get("client_secret"), ShouldEqual, "def456")
+					So(req.PostForm.Get("scope"), ShouldEqual, "openid vehicle_device_data")
+					So(req.PostForm.Get("audience"), ShouldStartWith, "http://127.0.0.1")
+				})
+				w.Write([]byte(PartnerTokenJSON))
+			case "authorization_code":
+				if req.PostForm.Get("code") != "code123" || req.PostForm.Get("redirect_uri") != "https://example.com/callback" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				w.Write([]byte(FleetTokenJSON))
+			case "refresh_token":
+				if req.PostForm.Get("refresh_token") != "fleetrefresh123" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.Write([]byte(strings.Replace(FleetTokenJSON, "fleet123", "fleet456", 1)))
+			}
+		case "/api/1/partner_accounts":
+			if req.Header.Get("Authorization") != "Bearer partner123" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(PartnerAccountJSON))
+		case "/api/1/partner_accounts/public_key":
+			w.Write([]byte(PublicKeyJSON))
+		case "/api/1/vehicles":
+			if req.Header.Get("Authorization") == "Bearer fleet123" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(VehiclesJSON))
+		case "/api/1/vehicles/1234/vehicle_data":
+			switch req.URL.Query().Get("endpoints") {
+			case "charge_state":
+				w.Write([]byte(`{"response":{"id":1234,"charge_state":` + strings.TrimSuffix(strings.TrimPrefix(ChargeStateJSON, `{"response":`), "}") + `}}`))
+			case "drive_state;location_data":
+				w.Write([]byte(FleetDriveStateJSON))
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		case "/api/1/vehicles/1234/command/door_lock":
+			w.Write([]byte(CommandResponseJSON))
+		case "/api/1/vehicles/fleet_telemetry_config":
+			body, _ := ioutil.ReadAll(req.Body)
+			Convey("Telemetry config request should carry the VINs and the config", t, func() {
+				So(req.Method, ShouldEqual, "POST")
+				So(string(body), ShouldEqual, `{"vins":["abc123","def456"],"config":{"hostname":"telemetry.example.com","ca":"","port":443,"fields":{"BatteryLevel":{"interval_seconds":60}}}}`)
+			})
+			w.Write([]byte(TelemetryResultJSON))
+		case "/api/1/vehicles/abc123/fleet_telemetry_config":
+			w.Write([]byte(TelemetryConfigJSON))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestFleetSpec(t *testing.T) {
+	ts := serveFleet(t)
+	defer ts.Close()
+
+	auth := &Auth{
+		ClientID:     "abc123",
+		ClientSecret: "def456",
+		RedirectURL:  "https://example.com/callback",
+		Scopes:       []string{ScopeOpenID, ScopeVehicleDeviceData},
+	}
+	options := []ClientOption{
+		WithFleetAuthURL(ts.URL + "/oauth2/v3"),
+		WithBaseURL(ts.URL + "/api/1"),
+	}
+
+	Convey("Should use the Fleet API of the region", t, func() {
+		client, err := NewClientWithToken(auth, &Token{AccessToken: "foo", Expires: 99999999999}, WithRegion(RegionEurope), WithFleetAPI())
+		So(err, ShouldBeNil)
+		So(client.API, ShouldEqual, FleetAPI)
+		So(client.BaseURL, ShouldEqual, "https://fleet-api.prd.eu.vn.cloud.tesla.com/api/1")
+		So(client.FleetAuthURL, ShouldEqual, "https://fleet-auth.prd.vn.cloud.tesla.com/oauth2/v3")
+		client, _ = NewClientWithToken(auth, &Token{AccessToken: "foo", Expires: 99999999999}, WithFleetAPI(), WithRegion(RegionChina))
+		So(client.BaseURL, ShouldEqual, "https://fleet-api.prd.cn.vn.cloud.tesla.cn/api/1")
+	})
+
+	Convey("Should register a partner account", t, func() {
+		client, err := NewPartnerClient(auth, options...)
+		So(err, ShouldBeNil)
+		So(client.Token.AccessToken, ShouldEqual, "partner123")
+		account, err := client.RegisterPartnerAccount("example.com")
+		So(err, ShouldBeNil)
+		So(account.Domain, ShouldEqual, "example.com")
+		key, err := client.PartnerPublicKey("example.com")
+		So(err, ShouldBeNil)
+		So(key, ShouldEqual, "04abcd")
+
+		Convey("Should renew the partner token", func() {
+			client.Token.AccessToken = "expired"
+			So(client.RefreshToken(), ShouldBeNil)
+			So(client.Token.AccessToken, ShouldEqual, "partner123")
+		})
+	})
+
+	Convey("Should build the authorization URL", t, func() {
+		u := AuthCodeURL(auth, "state123")
+		So(u, ShouldStartWith, "https://auth.tesla.com/oauth2/v3/authorize?")
+		So(u, ShouldContainSubstring, "scope=openid+vehicle_device_data")
+		So(u, ShouldContainSubstring, "redirect_uri=https%3A%2F%2Fexample.com%2Fcallback")
+		So(u, ShouldContainSubstring, "state=state123")
+	})
+
+	Convey("Should exchange the authorization code and use the Fleet API", t, func() {
+		_, err := NewClientWithCode(auth, "wrong", options...)
+		So(err, ShouldNotBeNil)
+		client, err := NewClientWithCode(auth, "code123", options...)
+		So(err, ShouldBeNil)
+		So(client.Token.RefreshToken, ShouldEqual, "fleetrefresh123")
+
+		vehicles, err := client.Vehicles()
+		So(err, ShouldBeNil)
+		So(client.Token.AccessToken, ShouldEqual, "fleet456")
+		vehicle := vehicles[0]
+
+		state, err := vehicle.ChargeState()
+		So(err, ShouldBeNil)
+		So(state.BatteryLevel, ShouldEqual, 90)
+		So(string(state.Raw()), ShouldContainSubstring, `"charge_limit_soc_std":90`)
+		drive, err := vehicle.DriveState()
+		So(err, ShouldBeNil)
+		So(drive.Latitude, ShouldEqual, 35.1)
+		So(vehicle.LockDoors(), ShouldBeNil)
+
+		_, _, err = vehicle.Stream()
+		So(errors.Is(err, ErrUnsupported), ShouldBeTrue)
+	})
+
+	Convey("Should configure Fleet Telemetry", t, func() {
+		client, err := NewClientWithToken(auth, &Token{AccessToken: "foo", Expires: 99999999999}, append(options, WithFleetAPI())...)
+		So(err, ShouldBeNil)
+		client.BaseURL = ts.URL + "/api/1"
+		config := &FleetTelemetryConfig{
+			Hostname: "telemetry.example.com",
+			Port:     443,
+			Fields:   map[string]FleetTelemetryField{"BatteryLevel": {IntervalSeconds: 60}},
+		}
+		result, err := client.ConfigureFleetTelemetry(config, "abc123", "def456")
+		So(err, ShouldBeNil)
+		So(result.UpdatedVehicles, ShouldEqual, 1)
+		So(result.SkippedVehicles["missing_key"], ShouldResemble, []string{"def456"})
+
+		vehicle := &Vehicle{Vin: "abc123", c: client}
+		config, synced, err := vehicle.FleetTelemetryConfig()
+		So(err, ShouldBeNil)
+		So(synced, ShouldBeTrue)
+		So(config.Fields["BatteryLevel"].IntervalSeconds, ShouldEqual, 60)
+
+		client.API = OwnerAPI
+		_, err = client.ConfigureFleetTelemetry(config, "abc123")
+		So(errors.Is(err, ErrUnsupported), ShouldBeTrue)
+	})
+
+	Convey("Should not login to the Fleet API", t, func() {
+		_, err := NewClient(auth, WithFleetAPI())
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,174 @@
+// Package protobuf is a minimal protocol buffers codec for the messages of
+// the vehicle command protocol and of Fleet Telemetry, which are encoded and
+// decoded field by field rather than from generated code.
+package protobuf
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// The wire types of the protocol buffers encoding
+const (
+	WireVarint  = 0
+	WireFixed64 = 1
+	WireBytes   = 2
+	WireFixed32 = 5
+)
+
+// ErrTruncated is returned when decoding a message that ends within a field
+var ErrTruncated = errors.New("protobuf: truncated message")
+
+// Message is a protocol buffers message built field by field. Fields are
+// written in the order they are appended, so the encoding is deterministic.
+type Message []byte
+
+// Uvarint appends an unsigned varint
+func (m Message) Uvarint(v uint64) Message {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(m, buf[:n]...)
+}
+
+// Key appends the key of a field
+func (m Message) Key(field, wire int) Message {
+	return m.Uvarint(uint64(field)<<3 | uint64(wire))
+}
+
+// Varint appends a varint field, e.g. an integer, bool or enum
+func (m Message) Varint(field int, v uint64) Message {
+	return m.Key(field, WireVarint).Uvarint(v)
+}
+
+// Fixed32 appends a fixed32 field, e.g. a float
+func (m Message) Fixed32(field int, v uint32) Message {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(m.Key(field, WireFixed32), buf[:]...)
+}
+
+// Fixed64 appends a fixed64 field, e.g. a double
+func (m Message) Fixed64(field int, v uint64) Message {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(m.Key(field, WireFixed64), buf[:]...)
+}
+
+// Bytes appends a length-delimited field, e.g. bytes, a string or a message
+func (m Message) Bytes(field int, b []byte) Message {
+	return append(m.Key(field, WireBytes).Uvarint(uint64(len(b))), b...)
+}
+
+// Field is a decoded field of a message. Value holds the varint and fixed
+// values, Bytes the length-delimited ones.
+type Field struct {
+	Num   int
+	Wire  int
+	Value uint64
+	Bytes []byte
+}
+
+// Float returns the value of a float or double field
+func (f Field) Float() float64 {
+	if f.Wire == WireFixed32 {
+		return float64(math.Float32frombits(uint32(f.Value)))
+	}
+	return math.Float64frombits(f.Value)
+}
+
+// Fields are the decoded fields of a message, in the order of their encoding
+type Fields []Field
+
+// Parse decodes the fields of a message
+func Parse(b []byte) (Fields, error) {
+	var fields Fields
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, ErrTruncated
+		}
+		b = b[n:]
+		f := Field{Num: int(key >> 3), Wire: int(key & 7)}
+		switch f.Wire {
+		case WireVarint:
+			f.Value, n = binary.Uvarint(b)
+			if n <= 0 {
+				return nil, ErrTruncated
+			}
+			b = b[n:]
+		case WireFixed64:
+			if len(b) < 8 {
+				return nil, ErrTruncated
+			}
+			f.Value = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case WireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return nil, ErrTruncated
+			}
+			f.Bytes = b[n : n+int(l)]
+			b = b[n+int(l):]
+		case WireFixed32:
+			if len(b) < 4 {
+				return nil, ErrTruncated
+			}
+			f.Value = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		default:
+			return nil, errors.New("protobuf: unsupported wire type")
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// Get returns the last occurrence of a field, as protocol buffers merge
+// repeated occurrences of singular fields
+func (fs Fields) Get(num int) (Field, bool) {
+	for i := len(fs) - 1; i >= 0; i-- {
+		if fs[i].Num == num {
+			return fs[i], true
+		}
+	}
+	return Field{}, false
+}
+
+// All returns every occurrence of a repeated field
+func (fs Fields) All(num int) []Field {
+	var all []Field
+	for _, f := range fs {
+		if f.Num == num {
+			all = append(all, f)
+		}
+	}
+	return all
+}
+
+// Bytes returns the bytes of a length-delimited field, or nil
+func (fs Fields) Bytes(num int) []byte {
+	f, _ := fs.Get(num)
+	return f.Bytes
+}
+
+// Value returns the value of a numeric field, or 0
+func (fs Fields) Value(num int) uint64 {
+	f, _ := fs.Get(num)
+	return f.Value
+}
+
+// Message decodes the message held by a field, returning nil if it is missing
+func (fs Fields) Message(num int) (Fields, error) {
+	f, ok := fs.Get(num)
+	if !ok {
+		return nil, nil
+	}
+	return Parse(f.Bytes)
+}
+
+// Has indicates whether a field is present
+func (fs Fields) Has(num int) bool {
+	_, ok := fs.Get(num)
+	return ok
+}
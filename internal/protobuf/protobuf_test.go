@@ -0,0 +1,49 @@
+package protobuf
+
+import (
+	"encoding/hex"
+	"math"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProtobufSpec(t *testing.T) {
+	Convey("Should encode fields", t, func() {
+		// Examples from the protocol buffers encoding guide
+		So(hex.EncodeToString(Message{}.Varint(1, 150)), ShouldEqual, "089601")
+		So(hex.EncodeToString(Message{}.Bytes(2, []byte("testing"))), ShouldEqual, "120774657374696e67")
+		So(hex.EncodeToString(Message{}.Fixed32(3, 1)), ShouldEqual, "1d01000000")
+	})
+
+	Convey("Should decode fields", t, func() {
+		b := Message{}.Varint(1, 150).Bytes(2, Message{}.Varint(1, 7)).Fixed32(3, 42).Varint(1, 151)
+		fields, err := Parse(b)
+		So(err, ShouldBeNil)
+		So(fields.Value(1), ShouldEqual, 151)
+		So(fields.Value(3), ShouldEqual, 42)
+		sub, err := fields.Message(2)
+		So(err, ShouldBeNil)
+		So(sub.Value(1), ShouldEqual, 7)
+		So(fields.Has(4), ShouldBeFalse)
+	})
+
+	Convey("Should decode repeated and floating point fields", t, func() {
+		b := Message{}.Bytes(1, []byte("a")).Fixed64(2, math.Float64bits(1.5)).Bytes(1, []byte("b")).Fixed32(3, math.Float32bits(-2.25))
+		fields, err := Parse(b)
+		So(err, ShouldBeNil)
+		all := fields.All(1)
+		So(len(all), ShouldEqual, 2)
+		So(string(all[0].Bytes), ShouldEqual, "a")
+		So(string(all[1].Bytes), ShouldEqual, "b")
+		f, _ := fields.Get(2)
+		So(f.Float(), ShouldEqual, 1.5)
+		f, _ = fields.Get(3)
+		So(f.Float(), ShouldEqual, -2.25)
+	})
+
+	Convey("Should reject truncated messages", t, func() {
+		_, err := Parse([]byte{0x12, 0x07, 0x74})
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,188 @@
+package tesla
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// A device registered for multi-factor authentication on the Tesla account
+type MFAFactor struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	FactorType string `json:"factorType"`
+}
+
+// The response listing the MFA devices of the account
+type mfaFactorsResponse struct {
+	Data []MFAFactor `json:"data"`
+}
+
+// The request that verifies an MFA passcode during login
+type mfaVerifyRequest struct {
+	TransactionID string `json:"transaction_id"`
+	FactorID      string `json:"factor_id"`
+	Passcode      string `json:"passcode"`
+}
+
+// The response to an MFA passcode verification
+type mfaVerifyResponse struct {
+	Data struct {
+		Approved bool `json:"approved"`
+		Valid    bool `json:"valid"`
+		Flagged  bool `json:"flagged"`
+	} `json:"data"`
+}
+
+// TOTPPasscode returns an Auth.Passcode callback that generates time based
+// one-time passwords (RFC 6238) from the base32 encoded secret shown when the
+// authenticator app was registered
+func TOTPPasscode(secret string) func(MFAFactor) (string, error) {
+	return func(MFAFactor) (string, error) {
+		return totp(secret, time.Now())
+	}
+}
+
+// PromptPasscode returns an Auth.Passcode callback that asks for the passcode
+// on out and reads it from in
+func PromptPasscode(in io.Reader, out io.Writer) func(MFAFactor) (string, error) {
+	reader := bufio.NewReader(in)
+	return func(factor MFAFactor) (string, error) {
+		fmt.Fprintf(out, "Passcode for %s: ", factor.Name)
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimSpace(line), nil
+	}
+}
+
+// Generates the six digit TOTP for the secret at time t
+func totp(secret string, t time.Time) (string, error) {
+	secret = strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha1.New, key)
+	binary.Write(mac, binary.BigEndian, uint64(t.Unix()/30))
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0xf
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", code%1000000), nil
+}
+
+// Indicates whether the login page asks for a captcha
+func requiresCaptcha(page []byte) bool {
+	return bytes.Contains(page, []byte(`name="captcha"`))
+}
+
+// Indicates whether the response to the credentials asks for an MFA passcode
+func requiresMFA(page []byte) bool {
+	return bytes.Contains(page, []byte("/authorize/mfa/verify"))
+}
+
+// Fetches the captcha image and has it solved by the captcha callback
+func (s *ssoSession) solveCaptcha(auth *Auth) (string, error) {
+	if auth.SolveCaptcha == nil {
+		return "", errors.New("login failed: captcha required but no captcha solver configured")
+	}
+	res, err := s.get(s.baseURL + "/captcha")
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	image, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", newAPIError(res, image)
+	}
+	return auth.SolveCaptcha(image)
+}
+
+// Completes the MFA challenge of the login transaction and returns the
+// authorization code
+func (s *ssoSession) verifyMFA(auth *Auth, transactionID string) (string, error) {
+	if auth.Passcode == nil {
+		return "", errors.New("login failed: MFA required but no passcode provider configured")
+	}
+	factor, err := s.selectFactor(auth, transactionID)
+	if err != nil {
+		return "", err
+	}
+	passcode, err := auth.Passcode(factor)
+	if err != nil {
+		return "", err
+	}
+
+	data, _ := json.Marshal(&mfaVerifyRequest{
+		TransactionID: transactionID,
+		FactorID:      factor.ID,
+		Passcode:      passcode,
+	})
+	req, _ := http.NewRequestWithContext(s.ctx, "POST", s.baseURL+"/authorize/mfa/verify", bytes.NewBuffer(data))
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	verify := &mfaVerifyResponse{}
+	if err := s.doJSON(req, verify); err != nil {
+		return "", err
+	}
+	if !verify.Data.Valid || !verify.Data.Approved {
+		return "", errors.New("login failed: invalid MFA passcode")
+	}
+
+	res, err := s.postForm(s.authorizeURL(), url.Values{"transaction_id": {transactionID}})
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+	return s.authorizationCode(res)
+}
+
+// Lists the MFA devices of the account and picks the one to use
+func (s *ssoSession) selectFactor(auth *Auth, transactionID string) (MFAFactor, error) {
+	req, _ := http.NewRequestWithContext(s.ctx, "GET", s.baseURL+"/authorize/mfa/factors?transaction_id="+url.QueryEscape(transactionID), nil)
+	req.Header.Set("Accept", "application/json")
+	factors := &mfaFactorsResponse{}
+	if err := s.doJSON(req, factors); err != nil {
+		return MFAFactor{}, err
+	}
+	switch {
+	case len(factors.Data) == 0:
+		return MFAFactor{}, errors.New("login failed: no MFA devices registered")
+	case len(factors.Data) == 1 || auth.SelectFactor == nil:
+		return factors.Data[0], nil
+	}
+	return auth.SelectFactor(factors.Data)
+}
+
+// Performs a request against the SSO service and decodes the JSON response
+func (s *ssoSession) doJSON(req *http.Request, out interface{}) error {
+	res, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return newAPIError(res, body)
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,156 @@
+package tesla
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var (
+	SSOCaptchaPageHTML = strings.Replace(SSOLoginPageHTML, `<input type="text" name="identity"`, `<input type="text" name="captcha" value="" /><input type="text" name="identity"`, 1)
+	SSOMFAPageHTML     = `<html><body><script>fetch("/oauth2/v3/authorize/mfa/verify")</script></body></html>`
+	MFAFactorsJSON     = `{"data":[{"id":"factor1","name":"Phone","factorType":"token:software"},{"id":"factor2","name":"Watch","factorType":"token:software"}]}`
+)
+
+func TestMFASpec(t *testing.T) {
+	ts := serveMFA(t)
+	defer ts.Close()
+
+	newAuth := func() *Auth {
+		return &Auth{
+			ClientID:     "abc123",
+			ClientSecret: "def456",
+			Email:        "elon@tesla.com",
+			Password:     "go",
+			SolveCaptcha: func(image []byte) (string, error) {
+				return strings.TrimSuffix(strings.TrimPrefix(string(image), "<svg>"), "</svg>"), nil
+			},
+			SelectFactor: func(factors []MFAFactor) (MFAFactor, error) {
+				return factors[1], nil
+			},
+			Passcode: func(factor MFAFactor) (string, error) {
+				return "123456", nil
+			},
+		}
+	}
+
+	Convey("Should login with captcha and MFA", t, func() {
+		client, err := NewClient(newAuth(), testOptions(ts)...)
+		So(err, ShouldBeNil)
+		So(client.Token.AccessToken, ShouldEqual, "ghi789")
+	})
+
+	Convey("Should fail with an invalid passcode", t, func() {
+		auth := newAuth()
+		auth.Passcode = func(factor MFAFactor) (string, error) {
+			return "000000", nil
+		}
+		_, err := NewClient(auth, testOptions(ts)...)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "login failed: invalid MFA passcode")
+	})
+
+	Convey("Should fail without a passcode provider", t, func() {
+		auth := newAuth()
+		auth.Passcode = nil
+		_, err := NewClient(auth, testOptions(ts)...)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Should fail without a captcha solver", t, func() {
+		auth := newAuth()
+		auth.SolveCaptcha = nil
+		_, err := NewClient(auth, testOptions(ts)...)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestPasscodeSpec(t *testing.T) {
+	Convey("Should generate TOTP codes", t, func() {
+		// Test vectors from RFC 6238, appendix B, truncated to six digits
+		secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+		code, err := totp(secret, time.Unix(59, 0))
+		So(err, ShouldBeNil)
+		So(code, ShouldEqual, "287082")
+		code, err = totp(secret, time.Unix(1111111109, 0))
+		So(err, ShouldBeNil)
+		So(code, ShouldEqual, "081804")
+	})
+
+	Convey("Should reject invalid TOTP secrets", t, func() {
+		_, err := TOTPPasscode("not base32!")(MFAFactor{})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Should prompt for a passcode", t, func() {
+		out := &strings.Builder{}
+		passcode, err := PromptPasscode(strings.NewReader("123456\n"), out)(MFAFactor{Name: "Phone"})
+		So(err, ShouldBeNil)
+		So(passcode, ShouldEqual, "123456")
+		So(out.String(), ShouldEqual, "Passcode for Phone: ")
+	})
+}
+
+// Serves a stand-in for the SSO service of an account with MFA enabled, whose
+// login page asks for a captcha
+func serveMFA(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == "GET" && req.URL.Path == "/oauth2/v3/authorize":
+			w.WriteHeader(200)
+			w.Write([]byte(SSOCaptchaPageHTML))
+		case req.URL.Path == "/oauth2/v3/captcha":
+			w.WriteHeader(200)
+			w.Write([]byte("<svg>abcd</svg>"))
+		case req.Method == "POST" && req.URL.Path == "/oauth2/v3/authorize":
+			req.ParseForm()
+			if req.PostForm.Get("identity") != "" {
+				Convey("Login form should carry the solved captcha", t, func() {
+					So(req.PostForm.Get("captcha"), ShouldEqual, "abcd")
+				})
+				w.WriteHeader(200)
+				w.Write([]byte(SSOMFAPageHTML))
+				return
+			}
+			Convey("Login should be resumed with the transaction", t, func() {
+				So(req.PostForm.Get("transaction_id"), ShouldEqual, "tx123")
+			})
+			q := url.Values{}
+			q.Set("code", "code-"+req.URL.Query().Get("code_challenge"))
+			q.Set("state", req.URL.Query().Get("state"))
+			w.Header().Set("Location", SSORedirectURL+"?"+q.Encode())
+			w.WriteHeader(http.StatusFound)
+		case req.URL.Path == "/oauth2/v3/authorize/mfa/factors":
+			Convey("Devices should be listed for the transaction", t, func() {
+				So(req.URL.Query().Get("transaction_id"), ShouldEqual, "tx123")
+			})
+			w.WriteHeader(200)
+			w.Write([]byte(MFAFactorsJSON))
+		case req.URL.Path == "/oauth2/v3/authorize/mfa/verify":
+			verify := &mfaVerifyRequest{}
+			json.NewDecoder(req.Body).Decode(verify)
+			Convey("Passcode should be verified for the selected device", t, func() {
+				So(verify.TransactionID, ShouldEqual, "tx123")
+				So(verify.FactorID, ShouldEqual, "factor2")
+			})
+			valid := verify.Passcode == "123456"
+			w.WriteHeader(200)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]bool{"approved": valid, "valid": valid, "flagged": false},
+			})
+		case req.URL.Path == "/oauth2/v3/token":
+			serveSSO(t, w, req)
+		case req.URL.Path == "/oauth/token":
+			w.WriteHeader(200)
+			w.Write([]byte(OwnerTokenJSON))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
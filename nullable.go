@@ -0,0 +1,218 @@
+package tesla
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+)
+
+// The JSON of values that are not reported
+var jsonNull = []byte("null")
+
+// NullFloat is a number that may not be reported, in which case Valid is
+// false and it is encoded as null
+type NullFloat struct {
+	Float64 float64
+	Valid   bool
+}
+
+// NewNullFloat returns a valid NullFloat of f
+func NewNullFloat(f float64) NullFloat {
+	return NullFloat{Float64: f, Valid: true}
+}
+
+// ValueOr returns the number, or def if it is not reported
+func (n NullFloat) ValueOr(def float64) float64 {
+	if !n.Valid {
+		return def
+	}
+	return n.Float64
+}
+
+func (n NullFloat) String() string {
+	if !n.Valid {
+		return "null"
+	}
+	return strconv.FormatFloat(n.Float64, 'f', -1, 64)
+}
+
+func (n NullFloat) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return jsonNull, nil
+	}
+	return json.Marshal(n.Float64)
+}
+
+func (n *NullFloat) UnmarshalJSON(data []byte) error {
+	f, ok, err := unmarshalNumber(data)
+	*n = NullFloat{Float64: f, Valid: ok}
+	return err
+}
+
+// NullInt is an integer that may not be reported, in which case Valid is
+// false and it is encoded as null
+type NullInt struct {
+	Int   int
+	Valid bool
+}
+
+// NewNullInt returns a valid NullInt of i
+func NewNullInt(i int) NullInt {
+	return NullInt{Int: i, Valid: true}
+}
+
+// ValueOr returns the integer, or def if it is not reported
+func (n NullInt) ValueOr(def int) int {
+	if !n.Valid {
+		return def
+	}
+	return n.Int
+}
+
+func (n NullInt) String() string {
+	if !n.Valid {
+		return "null"
+	}
+	return strconv.Itoa(n.Int)
+}
+
+func (n NullInt) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return jsonNull, nil
+	}
+	return json.Marshal(n.Int)
+}
+
+// UnmarshalJSON rounds numbers with a fraction to the nearest integer
+func (n *NullInt) UnmarshalJSON(data []byte) error {
+	f, ok, err := unmarshalNumber(data)
+	*n = NullInt{Int: int(math.Round(f)), Valid: ok}
+	return err
+}
+
+// NullTime is a time that may not be reported, in which case Valid is false
+// and it is encoded as null. It is encoded as Unix seconds like the API does.
+type NullTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+// NewNullTime returns a valid NullTime of t
+func NewNullTime(t time.Time) NullTime {
+	return NullTime{Time: t, Valid: true}
+}
+
+// ValueOr returns the time, or def if it is not reported
+func (n NullTime) ValueOr(def time.Time) time.Time {
+	if !n.Valid {
+		return def
+	}
+	return n.Time
+}
+
+func (n NullTime) String() string {
+	if !n.Valid {
+		return "null"
+	}
+	return n.Time.String()
+}
+
+func (n NullTime) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return jsonNull, nil
+	}
+	return json.Marshal(n.Time.Unix())
+}
+
+// UnmarshalJSON reads Unix seconds as well as RFC 3339 strings
+func (n *NullTime) UnmarshalJSON(data []byte) error {
+	*n = NullTime{}
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			*n = NewNullTime(t)
+			return nil
+		}
+	}
+	secs, ok, err := unmarshalNumber(data)
+	if ok {
+		*n = NewNullTime(time.Unix(int64(secs), 0))
+	}
+	return err
+}
+
+// NullBool is a flag that may not be reported, in which case Valid is false
+// and it is encoded as null
+type NullBool struct {
+	Bool  bool
+	Valid bool
+}
+
+// NewNullBool returns a valid NullBool of b
+func NewNullBool(b bool) NullBool {
+	return NullBool{Bool: b, Valid: true}
+}
+
+// ValueOr returns the flag, or def if it is not reported
+func (n NullBool) ValueOr(def bool) bool {
+	if !n.Valid {
+		return def
+	}
+	return n.Bool
+}
+
+func (n NullBool) String() string {
+	if !n.Valid {
+		return "null"
+	}
+	return strconv.FormatBool(n.Bool)
+}
+
+func (n NullBool) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return jsonNull, nil
+	}
+	return json.Marshal(n.Bool)
+}
+
+func (n *NullBool) UnmarshalJSON(data []byte) error {
+	*n = NullBool{}
+	if bytes.Equal(bytes.TrimSpace(data), jsonNull) {
+		return nil
+	}
+	if err := json.Unmarshal(data, &n.Bool); err != nil {
+		return err
+	}
+	n.Valid = true
+	return nil
+}
+
+// Reads a number from JSON, returning false for null. Numbers sent as
+// strings are read as well, empty strings as null.
+func unmarshalNumber(data []byte) (float64, bool, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, jsonNull) {
+		return 0, false, nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return 0, false, err
+		}
+		if s == "" {
+			return 0, false, nil
+		}
+		data = []byte(s)
+	}
+	f, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return f, true, nil
+}
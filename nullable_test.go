@@ -0,0 +1,61 @@
+package tesla
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNullableSpec(t *testing.T) {
+	Convey("Should tell values not reported from zero", t, func() {
+		resp := &StateRequest{}
+		So(json.Unmarshal([]byte(ChargeStateJSON), resp), ShouldBeNil)
+		charge := resp.Response.ChargeState
+		So(charge.ChargerPower.Valid, ShouldBeFalse)
+		So(charge.ChargerPower.ValueOr(-1), ShouldEqual, -1)
+		So(charge.ScheduledChargingStartTime.Valid, ShouldBeFalse)
+
+		So(json.Unmarshal([]byte(`{"charger_power":0,"charger_voltage":241.6,"battery_current":-0.4,"charger_phases":"3","scheduled_charging_start_time":1700000000}`), charge), ShouldBeNil)
+		So(charge.ChargerPower, ShouldResemble, NewNullFloat(0))
+		So(charge.ChargerVoltage, ShouldResemble, NewNullInt(242))
+		So(charge.BatteryCurrent.Float64, ShouldEqual, -0.4)
+		So(charge.ChargerPhases.ValueOr(1), ShouldEqual, 3)
+		So(charge.ScheduledChargingStartTime.Time.Equal(time.Unix(1700000000, 0)), ShouldBeTrue)
+	})
+
+	Convey("Should read flags and times in other formats", t, func() {
+		climate := &ClimateState{}
+		So(json.Unmarshal([]byte(`{"fan_status":null,"battery_heater_no_power":false}`), climate), ShouldBeNil)
+		So(climate.FanStatus.Valid, ShouldBeFalse)
+		So(climate.BatteryHeaterNoPower, ShouldResemble, NewNullBool(false))
+		var at NullTime
+		So(json.Unmarshal([]byte(`"2023-11-14T22:13:20Z"`), &at), ShouldBeNil)
+		So(at.Time.Unix(), ShouldEqual, 1700000000)
+	})
+
+	Convey("Should round-trip the states", t, func() {
+		charge := &ChargeState{
+			ChargerPower:             NewNullFloat(11.5),
+			ChargerPhases:            NewNullInt(3),
+			ManagedChargingStartTime: NewNullTime(time.Unix(1700000000, 0)),
+		}
+		b, err := json.Marshal(charge)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldContainSubstring, `"charger_power":11.5`)
+		So(string(b), ShouldContainSubstring, `"charger_voltage":null`)
+		So(string(b), ShouldContainSubstring, `"managed_charging_start_time":1700000000`)
+		decoded := &ChargeState{}
+		So(json.Unmarshal(b, decoded), ShouldBeNil)
+		So(decoded.ChargerPower, ShouldResemble, charge.ChargerPower)
+		So(decoded.ChargerVoltage.Valid, ShouldBeFalse)
+		So(decoded.ManagedChargingStartTime.Time.Equal(charge.ManagedChargingStartTime.Time), ShouldBeTrue)
+	})
+
+	Convey("Should fail on values that are not numbers", t, func() {
+		var n NullInt
+		So(json.Unmarshal([]byte(`"fast"`), &n), ShouldNotBeNil)
+		So(n.Valid, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,140 @@
+package tesla
+
+import (
+	"crypto/ecdsa"
+	"net/http"
+)
+
+// Logger is the interface of the logger used by the client, which is
+// satisfied by *log.Logger
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// ClientOption configures a client created by NewClient, NewClientWithToken
+// or NewClientWithTokenStore
+type ClientOption func(*Client)
+
+// WithHTTPClient sets the HTTP client used for all requests
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) {
+		c.HTTP = httpClient
+	}
+}
+
+// WithBaseURL sets the base URL of the owner API
+func WithBaseURL(url string) ClientOption {
+	return func(c *Client) {
+		c.BaseURL = url
+	}
+}
+
+// WithAuthURL sets the URL of the owner API token endpoint
+func WithAuthURL(url string) ClientOption {
+	return func(c *Client) {
+		c.AuthURL = url
+	}
+}
+
+// WithSSOURL sets the base URL of the SSO OAuth2 endpoints
+func WithSSOURL(url string) ClientOption {
+	return func(c *Client) {
+		c.SSOURL = url
+	}
+}
+
+// WithStreamingURL sets the base URL of the streaming API
+func WithStreamingURL(url string) ClientOption {
+	return func(c *Client) {
+		c.StreamingURL = url
+	}
+}
+
+// WithRegion sets the region of the account and uses its endpoints. Options
+// setting individual endpoints may follow to override them.
+func WithRegion(region Region) ClientOption {
+	return func(c *Client) {
+		c.Region = region
+		c.setEndpoints(c.regionEndpoints(region))
+	}
+}
+
+// WithFleetAPI sends the requests of the client to the Fleet API of its
+// region instead of the owner API
+func WithFleetAPI() ClientOption {
+	return func(c *Client) {
+		c.API = FleetAPI
+		c.BaseURL = c.apiBaseURL(c.regionEndpoints(c.Region))
+	}
+}
+
+// WithFleetAuthURL sets the base URL of the Fleet API token endpoint
+func WithFleetAuthURL(url string) ClientOption {
+	return func(c *Client) {
+		c.FleetAuthURL = url
+	}
+}
+
+// WithSSORedirectURL sets the redirect URI of the SSO login
+func WithSSORedirectURL(url string) ClientOption {
+	return func(c *Client) {
+		c.SSORedirectURL = url
+	}
+}
+
+// WithCommandKey sets the key signing the commands sent to vehicles, which
+// must be paired with the vehicles
+func WithCommandKey(key *ecdsa.PrivateKey) ClientOption {
+	return func(c *Client) {
+		c.CommandKey = key
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with all requests
+func WithUserAgent(userAgent string) ClientOption {
+	return func(c *Client) {
+		c.UserAgent = userAgent
+	}
+}
+
+// WithLogger sets the logger receiving a line for every request
+func WithLogger(logger Logger) ClientOption {
+	return func(c *Client) {
+		c.Logger = logger
+	}
+}
+
+// WithRetryPolicy sets the policy for retrying transient failures
+func WithRetryPolicy(policy *RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.RetryPolicy = policy
+	}
+}
+
+// WithWakePolicy sets the policy waking asleep vehicles for requests
+func WithWakePolicy(policy *WakePolicy) ClientOption {
+	return func(c *Client) {
+		c.WakePolicy = policy
+	}
+}
+
+// WithRateLimiter sets the rate limiter of the client
+func WithRateLimiter(limiter *RateLimiter) ClientOption {
+	return func(c *Client) {
+		c.RateLimiter = limiter
+	}
+}
+
+// WithTokenRefreshCallback sets the function called with every renewed token
+func WithTokenRefreshCallback(callback func(*Token)) ClientOption {
+	return func(c *Client) {
+		c.OnTokenRefresh = callback
+	}
+}
+
+// Logs a line to the logger of the client, if any
+func (c *Client) logf(format string, v ...interface{}) {
+	if c.Logger != nil {
+		c.Logger.Printf(format, v...)
+	}
+}
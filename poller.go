@@ -0,0 +1,231 @@
+package tesla
+
+import (
+	"context"
+	"time"
+)
+
+// Snapshot is the state of a vehicle observed by a Poller
+type Snapshot struct {
+	Time time.Time
+	// Vehicle is the vehicle as listed by the API, nil if listing failed
+	Vehicle *Vehicle
+	// The states read from the vehicle, nil unless it was online and active
+	// enough to be read
+	ChargeState  *ChargeState
+	ClimateState *ClimateState
+	DriveState   *DriveState
+	GuiSettings  *GuiSettings
+	VehicleState *VehicleState
+	// Err is the error listing the vehicles or reading the states, if any
+	Err error
+}
+
+// Poller polls vehicles without keeping them awake. It observes the state of
+// the vehicles by listing them, which does not wake them, and only reads
+// their states while they are online. Once a vehicle is parked and idle, the
+// poller leaves it alone for a while so that it can fall asleep.
+type Poller struct {
+	// VehicleIDs are the IDs of the vehicles polled, all vehicles if empty
+	VehicleIDs []int64
+	// States are the names of the states read, e.g. "charge_state"
+	States []string
+	// ActiveInterval is the interval between polls of a vehicle which is
+	// driving, charging or conditioning
+	ActiveInterval time.Duration
+	// IdleInterval is the interval between polls of an online vehicle which
+	// is parked and idle
+	IdleInterval time.Duration
+	// AsleepInterval is the interval between polls of vehicles which are
+	// asleep, offline or left alone, which are only listed
+	AsleepInterval time.Duration
+	// IdleTimeout is the time a vehicle is polled after it became idle
+	IdleTimeout time.Duration
+	// SleepWindow is the time a vehicle is left alone to fall asleep, after
+	// which it is read once more if it is still online
+	SleepWindow time.Duration
+	// OnSnapshot is called with the snapshot of every vehicle polled
+	OnSnapshot func(*Snapshot)
+
+	c *Client
+}
+
+// The state of a vehicle kept by the poller between polls
+type pollState struct {
+	state     OnlineState
+	idleSince time.Time
+	// leftAlone is the start of the sleep window, zero while reading the states
+	leftAlone time.Time
+	// next is the time the vehicle is polled next
+	next time.Time
+}
+
+// NewPoller returns a poller of the vehicles of the account with intervals
+// suiting most applications
+func (c *Client) NewPoller() *Poller {
+	return &Poller{
+		States:         []string{"charge_state", "climate_state", "drive_state", "vehicle_state"},
+		ActiveInterval: 30 * time.Second,
+		IdleInterval:   2 * time.Minute,
+		AsleepInterval: time.Minute,
+		IdleTimeout:    10 * time.Minute,
+		SleepWindow:    20 * time.Minute,
+		c:              c,
+	}
+}
+
+// Run polls the vehicles and passes the snapshots to OnSnapshot until ctx is
+// done, returning its error
+func (p *Poller) Run(ctx context.Context) error {
+	return p.run(ctx, func(s *Snapshot) {
+		if p.OnSnapshot != nil {
+			p.OnSnapshot(s)
+		}
+	})
+}
+
+// Snapshots polls the vehicles until ctx is done and returns the channel
+// receiving the snapshots, which is closed once ctx is done
+func (p *Poller) Snapshots(ctx context.Context) <-chan *Snapshot {
+	snapshots := make(chan *Snapshot)
+	go func() {
+		defer close(snapshots)
+		p.run(ctx, func(s *Snapshot) {
+			select {
+			case snapshots <- s:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return snapshots
+}
+
+func (p *Poller) run(ctx context.Context, emit func(*Snapshot)) error {
+	polls := map[int64]*pollState{}
+	for {
+		delay := p.poll(ctx, polls, time.Now(), emit)
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// Lists the vehicles and polls those whose interval has passed or whose
+// state changed, returning the delay before the next poll of any vehicle
+func (p *Poller) poll(ctx context.Context, polls map[int64]*pollState, now time.Time, emit func(*Snapshot)) time.Duration {
+	vehicles, err := p.c.VehiclesContext(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			emit(&Snapshot{Time: now, Err: err})
+		}
+		return p.AsleepInterval
+	}
+	var next time.Time
+	for _, v := range vehicles {
+		if !p.polls(v.ID) {
+			continue
+		}
+		ps, ok := polls[v.ID]
+		if !ok {
+			ps = &pollState{}
+			polls[v.ID] = ps
+		}
+		if !now.Before(ps.next) || v.State != ps.state {
+			snapshot := &Snapshot{Time: now, Vehicle: v}
+			ps.next = now.Add(p.pollVehicle(ctx, v, ps, snapshot, now))
+			if ctx.Err() != nil {
+				break
+			}
+			emit(snapshot)
+		}
+		if next.IsZero() || ps.next.Before(next) {
+			next = ps.next
+		}
+	}
+	if next.IsZero() {
+		return p.AsleepInterval
+	}
+	return next.Sub(now)
+}
+
+// Indicates whether the vehicle with the ID is polled
+func (p *Poller) polls(id int64) bool {
+	if len(p.VehicleIDs) == 0 {
+		return true
+	}
+	for _, vid := range p.VehicleIDs {
+		if vid == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Reads the states of an online vehicle into the snapshot unless it is left
+// alone, returning the delay before the next poll of the vehicle
+func (p *Poller) pollVehicle(ctx context.Context, v *Vehicle, ps *pollState, s *Snapshot, now time.Time) time.Duration {
+	previous := ps.state
+	ps.state = v.State
+	if v.State != StateOnline {
+		ps.leftAlone = time.Time{}
+		return p.AsleepInterval
+	}
+	if previous != StateOnline {
+		ps.idleSince = now
+	}
+	if !ps.leftAlone.IsZero() {
+		if now.Sub(ps.leftAlone) < p.SleepWindow {
+			return p.AsleepInterval
+		}
+		// The vehicle stayed online, so check whether it is in use
+		ps.leftAlone = time.Time{}
+	}
+	if s.Err = p.readStates(ctx, v, s); s.Err != nil {
+		return p.AsleepInterval
+	}
+	if s.active() {
+		ps.idleSince = now
+		return p.ActiveInterval
+	}
+	if now.Sub(ps.idleSince) >= p.IdleTimeout {
+		ps.leftAlone = now
+		return p.AsleepInterval
+	}
+	return p.IdleInterval
+}
+
+// Reads the states of the vehicle into the snapshot, without waking it
+func (p *Poller) readStates(ctx context.Context, v *Vehicle, s *Snapshot) error {
+	for _, name := range p.States {
+		stateRequest, err := p.c.fetchState(ctx, "/"+name, v.ID)
+		if err != nil {
+			return err
+		}
+		switch name {
+		case "charge_state":
+			s.ChargeState = stateRequest.Response.ChargeState
+		case "climate_state":
+			s.ClimateState = stateRequest.Response.ClimateState
+		case "drive_state":
+			s.DriveState = stateRequest.Response.DriveState
+		case "gui_settings":
+			s.GuiSettings = stateRequest.Response.GuiSettings
+		case "vehicle_state":
+			s.VehicleState = stateRequest.Response.VehicleState
+		}
+	}
+	return nil
+}
+
+// Indicates whether the vehicle is driving, charging or conditioning
+func (s *Snapshot) active() bool {
+	if d := s.DriveState; d != nil {
+		if d.ShiftState.IsDriving() || d.Speed > 0 {
+			return true
+		}
+	}
+	if c := s.ChargeState; c != nil && c.ChargingState.IsCharging() {
+		return true
+	}
+	return s.ClimateState != nil && s.ClimateState.IsClimateOn
+}
@@ -0,0 +1,188 @@
+package tesla
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPollerSpec(t *testing.T) {
+	var mu sync.Mutex
+	state, charging := "asleep", "Disconnected"
+	var reads []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case req.URL.Path == "/api/1/vehicles":
+			fmt.Fprintf(w, `{"response":[{"id":1234,"state":%q},{"id":5678,"state":"asleep"}],"count":2}`, state)
+		case strings.HasPrefix(req.URL.Path, "/api/1/vehicles/1234/data_request/"):
+			name := strings.TrimPrefix(req.URL.Path, "/api/1/vehicles/1234/data_request/")
+			reads = append(reads, name)
+			switch name {
+			case "charge_state":
+				fmt.Fprintf(w, `{"response":{"charging_state":%q,"battery_level":80}}`, charging)
+			case "drive_state":
+				w.Write([]byte(`{"response":{"shift_state":null,"speed":0}}`))
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client := &Client{
+		HTTP:    &http.Client{},
+		Token:   &Token{AccessToken: "foo", Expires: 99999999999},
+		BaseURL: ts.URL + "/api/1",
+	}
+	set := func(s, c string) {
+		mu.Lock()
+		defer mu.Unlock()
+		state, charging, reads = s, c, nil
+	}
+	read := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return reads
+	}
+	poller := client.NewPoller()
+	poller.States = []string{"charge_state", "drive_state"}
+	poller.VehicleIDs = []int64{1234}
+	ctx := context.Background()
+	start := time.Unix(1600000000, 0)
+	var snapshots []*Snapshot
+	emit := func(s *Snapshot) { snapshots = append(snapshots, s) }
+
+	Convey("Should only list asleep vehicles", t, func() {
+		set("asleep", "Disconnected")
+		snapshots = nil
+		polls := map[int64]*pollState{}
+		So(poller.poll(ctx, polls, start, emit), ShouldEqual, poller.AsleepInterval)
+		So(read(), ShouldBeEmpty)
+		So(snapshots, ShouldHaveLength, 1)
+		So(snapshots[0].Vehicle.ID, ShouldEqual, 1234)
+		So(snapshots[0].Vehicle.State, ShouldEqual, "asleep")
+		So(snapshots[0].ChargeState, ShouldBeNil)
+	})
+
+	Convey("Should read active vehicles often", t, func() {
+		set("online", "Charging")
+		snapshots = nil
+		polls := map[int64]*pollState{}
+		for i := 0; i < 60; i++ {
+			So(poller.poll(ctx, polls, start.Add(time.Duration(i)*time.Minute), emit), ShouldEqual, poller.ActiveInterval)
+		}
+		So(read(), ShouldHaveLength, 120)
+		So(snapshots[59].ChargeState.ChargingState, ShouldEqual, "Charging")
+		So(snapshots[59].DriveState, ShouldNotBeNil)
+	})
+
+	Convey("Should leave idle vehicles alone to fall asleep", t, func() {
+		set("online", "Complete")
+		snapshots = nil
+		polls := map[int64]*pollState{}
+		now := start
+		for now.Before(start.Add(poller.IdleTimeout)) {
+			So(poller.poll(ctx, polls, now, emit), ShouldEqual, poller.IdleInterval)
+			now = now.Add(poller.IdleInterval)
+		}
+		So(poller.poll(ctx, polls, now, emit), ShouldEqual, poller.AsleepInterval)
+		n := len(read())
+		So(n, ShouldEqual, 2*len(snapshots))
+
+		// Only listed while left alone
+		for i := 0; i < 19; i++ {
+			now = now.Add(poller.AsleepInterval)
+			So(poller.poll(ctx, polls, now, emit), ShouldEqual, poller.AsleepInterval)
+		}
+		So(read(), ShouldHaveLength, n)
+		So(snapshots[len(snapshots)-1].ChargeState, ShouldBeNil)
+
+		// Still online after the sleep window, so read once more
+		now = now.Add(poller.AsleepInterval)
+		So(poller.poll(ctx, polls, now, emit), ShouldEqual, poller.AsleepInterval)
+		So(read(), ShouldHaveLength, n+2)
+
+		// Read again once woken up
+		set("asleep", "Complete")
+		now = now.Add(poller.AsleepInterval)
+		poller.poll(ctx, polls, now, emit)
+		set("online", "Charging")
+		now = now.Add(poller.AsleepInterval)
+		So(poller.poll(ctx, polls, now, emit), ShouldEqual, poller.ActiveInterval)
+		So(read(), ShouldHaveLength, 2)
+	})
+
+	Convey("Should poll each vehicle at its own interval", t, func() {
+		set("online", "Charging")
+		snapshots = nil
+		p := client.NewPoller()
+		p.States = []string{"charge_state"}
+		polls := map[int64]*pollState{}
+		for i := 0; i < 4; i++ {
+			So(p.poll(ctx, polls, start.Add(time.Duration(i)*p.ActiveInterval), emit), ShouldEqual, p.ActiveInterval)
+		}
+		So(read(), ShouldHaveLength, 4)
+		polled := map[int64]int{}
+		for _, s := range snapshots {
+			polled[s.Vehicle.ID]++
+		}
+		So(polled[1234], ShouldEqual, 4)
+		So(polled[5678], ShouldEqual, 2)
+
+		// Polled before its interval once its state changes, while the other
+		// vehicle keeps its schedule
+		set("asleep", "Charging")
+		n := len(snapshots)
+		So(p.poll(ctx, polls, start.Add(100*time.Second), emit), ShouldEqual, 20*time.Second)
+		So(snapshots, ShouldHaveLength, n+1)
+		So(snapshots[n].Vehicle.ID, ShouldEqual, 1234)
+		So(snapshots[n].Vehicle.State, ShouldEqual, "asleep")
+	})
+
+	Convey("Should emit snapshots on a channel until done", t, func() {
+		set("online", "Charging")
+		p := client.NewPoller()
+		p.States = []string{"charge_state"}
+		p.ActiveInterval = time.Millisecond
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		snapshots := p.Snapshots(ctx)
+		count := 0
+		for s := range snapshots {
+			So(s.Err, ShouldBeNil)
+			if s.Vehicle.ID == 1234 {
+				So(s.ChargeState.BatteryLevel, ShouldEqual, 80)
+				if count++; count == 3 {
+					cancel()
+				}
+			}
+		}
+		So(count, ShouldEqual, 3)
+	})
+
+	Convey("Should pass snapshots to the callback until done", t, func() {
+		set("asleep", "Disconnected")
+		p := client.NewPoller()
+		p.AsleepInterval = time.Millisecond
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		count := 0
+		p.OnSnapshot = func(s *Snapshot) {
+			if count++; count == 4 {
+				cancel()
+			}
+		}
+		So(p.Run(ctx), ShouldEqual, context.Canceled)
+		So(count, ShouldEqual, 4)
+		So(read(), ShouldBeEmpty)
+	})
+}
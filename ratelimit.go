@@ -0,0 +1,221 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRateLimitExceeded is returned instead of waiting when a request exceeds
+// the budget of a RateLimiter configured to fail fast
+var ErrRateLimitExceeded = errors.New("client rate limit exceeded")
+
+// RateLimit is a token bucket budget allowing Rate requests per second on
+// average, with bursts of up to Burst requests. The zero value is unlimited.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// Returns the size of the bucket, which holds at least one token
+func (l RateLimit) burst() float64 {
+	if l.Burst < 1 {
+		return 1
+	}
+	return float64(l.Burst)
+}
+
+// Every returns a budget of one request per interval with bursts of burst requests
+func Every(interval time.Duration, burst int) RateLimit {
+	return RateLimit{Rate: float64(time.Second) / float64(interval), Burst: burst}
+}
+
+// RateLimits are the budgets of a single vehicle
+type RateLimits struct {
+	// StateReads limits the data requests, e.g. ChargeState
+	StateReads RateLimit
+	// Commands limits the commands sent to the vehicle
+	Commands RateLimit
+	// Wakeups limits the wake up requests
+	Wakeups RateLimit
+}
+
+// RateLimiter limits the requests of a client to the budgets of the account
+// and of each vehicle
+type RateLimiter struct {
+	// Account limits all requests sent by the client
+	Account RateLimit
+	// Vehicle are the budgets of every vehicle not listed in Vehicles
+	Vehicle RateLimits
+	// Vehicles are the budgets of individual vehicles by ID
+	Vehicles map[int64]RateLimits
+	// FailFast returns ErrRateLimitExceeded instead of waiting for the budget
+	FailFast bool
+
+	mu      sync.Mutex
+	buckets map[bucketKey]*bucket
+}
+
+// The kinds of requests with separate budgets per vehicle
+type requestKind int
+
+const (
+	accountRequest requestKind = iota
+	stateRead
+	command
+	wakeup
+)
+
+type bucketKey struct {
+	vehicleID int64
+	kind      requestKind
+}
+
+// A token bucket
+type bucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+// Takes a token from the bucket, returning how long the caller has to wait
+// for it. If wait is false, no token is taken if the caller would have to wait.
+func (b *bucket) take(now time.Time, wait bool) time.Duration {
+	burst := b.limit.burst()
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	delay := time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+	if wait {
+		b.tokens--
+	}
+	return delay
+}
+
+// Indicates whether a token can be taken without waiting
+func (b *bucket) available(now time.Time) bool {
+	tokens := b.tokens + now.Sub(b.last).Seconds()*b.limit.Rate
+	return tokens >= 1
+}
+
+// Returns a token taken by a caller that stopped waiting for it
+func (b *bucket) giveBack() {
+	b.tokens++
+	if burst := b.limit.burst(); b.tokens > burst {
+		b.tokens = burst
+	}
+}
+
+// Returns the budget of the vehicle for the kind of request
+func (l *RateLimiter) limitFor(vehicleID int64, kind requestKind) RateLimit {
+	if kind == accountRequest {
+		return l.Account
+	}
+	limits, ok := l.Vehicles[vehicleID]
+	if !ok {
+		limits = l.Vehicle
+	}
+	switch kind {
+	case stateRead:
+		return limits.StateReads
+	case command:
+		return limits.Commands
+	}
+	return limits.Wakeups
+}
+
+// Waits until the budget allows the request, or fails if FailFast is set
+func (l *RateLimiter) wait(ctx context.Context, vehicleID int64, kind requestKind) error {
+	limit := l.limitFor(vehicleID, kind)
+	if limit.Rate <= 0 {
+		return nil
+	}
+	key := bucketKey{vehicleID, kind}
+	now := time.Now()
+
+	l.mu.Lock()
+	if l.buckets == nil {
+		l.buckets = map[bucketKey]*bucket{}
+	}
+	b, ok := l.buckets[key]
+	if !ok || b.limit != limit {
+		b = &bucket{limit: limit, tokens: limit.burst(), last: now}
+		l.buckets[key] = b
+	}
+	delay := b.take(now, !l.FailFast)
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	if l.FailFast {
+		return ErrRateLimitExceeded
+	}
+	if err := sleepContext(ctx, delay); err != nil {
+		l.mu.Lock()
+		b.giveBack()
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Indicates whether the budget allows the request without waiting, without
+// taking a token
+func (l *RateLimiter) allows(vehicleID int64, kind requestKind) bool {
+	limit := l.limitFor(vehicleID, kind)
+	if limit.Rate <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[bucketKey{vehicleID, kind}]
+	return !ok || b.limit != limit || b.available(time.Now())
+}
+
+// Returns the vehicle and the budget of a request to a vehicle, so that its
+// retries are limited like the first attempt
+func vehicleRequest(req *http.Request) (int64, requestKind, bool) {
+	i := strings.Index(req.URL.Path, "/vehicles/")
+	if i < 0 {
+		return 0, 0, false
+	}
+	parts := strings.SplitN(req.URL.Path[i+len("/vehicles/"):], "/", 2)
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || len(parts) < 2 {
+		return 0, 0, false
+	}
+	switch {
+	case parts[1] == "wake_up":
+		return id, wakeup, true
+	case strings.HasPrefix(parts[1], "command/"):
+		return id, command, true
+	case strings.HasPrefix(parts[1], "data_request/") || parts[1] == "vehicle_data":
+		return id, stateRead, true
+	}
+	return 0, 0, false
+}
+
+// Waits for the rate limiter of the client, if any
+func (c *Client) rateLimit(ctx context.Context, vehicleID int64, kind requestKind) error {
+	if c.RateLimiter == nil {
+		return nil
+	}
+	return c.RateLimiter.wait(ctx, vehicleID, kind)
+}
+
+// Indicates whether a wake-up of the vehicle is sent without waiting for the
+// rate limiter of the client
+func (c *Client) wakeAllowed(vehicleID int64) bool {
+	return c.RateLimiter == nil || c.RateLimiter.allows(vehicleID, wakeup)
+}
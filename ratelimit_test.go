@@ -0,0 +1,133 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRateLimiterSpec(t *testing.T) {
+	ts := serveHTTP(t)
+	defer ts.Close()
+
+	newClient := func(limiter *RateLimiter) (*Client, *Vehicle) {
+		client := &Client{
+			HTTP:        &http.Client{},
+			Token:       &Token{AccessToken: "foo", Expires: 99999999999},
+			BaseURL:     ts.URL + "/api/1",
+			RateLimiter: limiter,
+		}
+		return client, &Vehicle{ID: 1234, c: client}
+	}
+
+	Convey("Should fail fast once the budget is spent", t, func() {
+		_, vehicle := newClient(&RateLimiter{
+			Vehicle:  RateLimits{StateReads: Every(time.Hour, 2)},
+			FailFast: true,
+		})
+		_, err := vehicle.ChargeState()
+		So(err, ShouldBeNil)
+		_, err = vehicle.ClimateState()
+		So(err, ShouldBeNil)
+		_, err = vehicle.DriveState()
+		So(errors.Is(err, ErrRateLimitExceeded), ShouldBeTrue)
+
+		Convey("Commands should have a separate budget", func() {
+			So(vehicle.FlashLights(), ShouldBeNil)
+		})
+	})
+
+	Convey("Should apply the budget of the vehicle", t, func() {
+		_, vehicle := newClient(&RateLimiter{
+			Vehicle:  RateLimits{Commands: Every(time.Hour, 1)},
+			Vehicles: map[int64]RateLimits{1234: {Wakeups: Every(time.Hour, 1)}},
+			FailFast: true,
+		})
+		So(vehicle.FlashLights(), ShouldBeNil)
+		So(vehicle.FlashLights(), ShouldBeNil)
+		_, err := vehicle.Wakeup()
+		So(err, ShouldBeNil)
+		_, err = vehicle.Wakeup()
+		So(errors.Is(err, ErrRateLimitExceeded), ShouldBeTrue)
+	})
+
+	Convey("Should limit all requests of the account", t, func() {
+		client, _ := newClient(&RateLimiter{
+			Account:  Every(time.Hour, 1),
+			FailFast: true,
+		})
+		_, err := client.Vehicles()
+		So(err, ShouldBeNil)
+		_, err = client.Vehicles()
+		So(errors.Is(err, ErrRateLimitExceeded), ShouldBeTrue)
+	})
+
+	Convey("Should wait for the budget", t, func() {
+		_, vehicle := newClient(&RateLimiter{
+			Vehicle: RateLimits{StateReads: Every(30*time.Millisecond, 1)},
+		})
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			_, err := vehicle.ChargeState()
+			So(err, ShouldBeNil)
+		}
+		So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 55*time.Millisecond)
+
+		Convey("Should stop waiting when the context is done", func() {
+			limited := &Vehicle{ID: 1234, c: &Client{RateLimiter: &RateLimiter{
+				Vehicle: RateLimits{StateReads: Every(time.Hour, 1)},
+			}}}
+			limited.c.RateLimiter.wait(context.Background(), 1234, stateRead)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			_, err := limited.ChargeStateContext(ctx)
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+		})
+
+		Convey("Should give the token back when the wait is cancelled", func() {
+			limiter := &RateLimiter{Vehicle: RateLimits{StateReads: Every(time.Hour, 1)}}
+			limiter.wait(context.Background(), 1234, stateRead)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			So(limiter.wait(ctx, 1234, stateRead), ShouldEqual, context.Canceled)
+			b := limiter.buckets[bucketKey{1234, stateRead}]
+			So(b.tokens, ShouldBeBetween, -0.01, 0.01)
+		})
+	})
+
+	Convey("Should refill the bucket over time", t, func() {
+		now := time.Now()
+		b := &bucket{limit: RateLimit{Rate: 1, Burst: 2}, tokens: 2, last: now}
+		So(b.take(now, false), ShouldEqual, 0)
+		So(b.take(now, false), ShouldEqual, 0)
+		So(b.take(now, false), ShouldEqual, time.Second)
+		So(b.take(now.Add(500*time.Millisecond), true), ShouldEqual, 500*time.Millisecond)
+		So(b.take(now.Add(time.Second), false), ShouldEqual, time.Second)
+		So(b.take(now.Add(2*time.Second), false), ShouldEqual, 0)
+	})
+}
+
+// Ensures the rate limiter is not consulted when none is configured
+func TestNoRateLimiterSpec(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(200)
+		w.Write([]byte(ChargeStateJSON))
+	}))
+	defer ts.Close()
+
+	Convey("Should not limit requests without a rate limiter", t, func() {
+		vehicle := &Vehicle{ID: 1234, c: &Client{
+			HTTP:    &http.Client{},
+			BaseURL: ts.URL + "/api/1",
+		}}
+		for i := 0; i < 10; i++ {
+			_, err := vehicle.ChargeState()
+			So(err, ShouldBeNil)
+		}
+	})
+}
@@ -0,0 +1,184 @@
+package tesla
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// RawJSON keeps the JSON a state was decoded from, so that fields added by
+// new firmware can be read before the library knows them:
+//
+//	pressure, ok := vehicleState.RawFloat("tpms_pressure_fl")
+type RawJSON struct {
+	raw   json.RawMessage
+	known map[string]bool
+}
+
+// The names of the JSON fields of the state types, by type
+var knownFields sync.Map
+
+// Keeps the JSON of a state decoded into v, a pointer to a struct
+func (r *RawJSON) keep(data []byte, v interface{}) {
+	t := reflect.TypeOf(v).Elem()
+	known, ok := knownFields.Load(t)
+	if !ok {
+		known, _ = knownFields.LoadOrStore(t, jsonFields(t))
+	}
+	*r = RawJSON{raw: append(json.RawMessage(nil), data...), known: known.(map[string]bool)}
+}
+
+// Returns the lower cased JSON names of the fields of a struct type
+func jsonFields(t reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(strings.TrimSpace(f.Tag.Get("json")), ",")[0]
+		if name == "-" || f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names[strings.ToLower(name)] = true
+	}
+	return names
+}
+
+// Decodes a state into v and keeps its JSON. v is of a type without the
+// UnmarshalJSON method of the state, so that it is not called again.
+func unmarshalState(data []byte, v interface{}, raw *RawJSON) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	raw.keep(data, v)
+	return nil
+}
+
+// Raw returns the JSON the state was decoded from, nil if it was not decoded
+func (r *RawJSON) Raw() json.RawMessage {
+	return r.raw
+}
+
+// Returns the fields of the JSON, which is decoded on every call so that
+// states can be read concurrently
+func (r *RawJSON) object() map[string]json.RawMessage {
+	fields := map[string]json.RawMessage{}
+	json.Unmarshal(r.raw, &fields)
+	return fields
+}
+
+// RawField returns the JSON of the named field, if the state has it
+func (r *RawJSON) RawField(name string) (json.RawMessage, bool) {
+	value, ok := r.object()[name]
+	return value, ok
+}
+
+// ExtraFields returns the fields of the JSON that are not decoded into the state
+func (r *RawJSON) ExtraFields() map[string]json.RawMessage {
+	extra := map[string]json.RawMessage{}
+	for name, value := range r.object() {
+		if !r.known[strings.ToLower(name)] {
+			extra[name] = value
+		}
+	}
+	return extra
+}
+
+// DecodeField decodes the named field into v, returning false if the state
+// does not have it or it is null
+func (r *RawJSON) DecodeField(name string, v interface{}) (bool, error) {
+	value, ok := r.RawField(name)
+	if !ok || string(value) == "null" {
+		return false, nil
+	}
+	return true, json.Unmarshal(value, v)
+}
+
+// RawString returns the named field if it is a string
+func (r *RawJSON) RawString(name string) (string, bool) {
+	var s string
+	ok, err := r.DecodeField(name, &s)
+	return s, ok && err == nil
+}
+
+// RawFloat returns the named field if it is a number
+func (r *RawJSON) RawFloat(name string) (float64, bool) {
+	var f float64
+	ok, err := r.DecodeField(name, &f)
+	return f, ok && err == nil
+}
+
+// RawInt returns the named field if it is an integer
+func (r *RawJSON) RawInt(name string) (int, bool) {
+	var i int
+	ok, err := r.DecodeField(name, &i)
+	return i, ok && err == nil
+}
+
+// RawBool returns the named field if it is a boolean
+func (r *RawJSON) RawBool(name string) (bool, bool) {
+	var b bool
+	ok, err := r.DecodeField(name, &b)
+	return b, ok && err == nil
+}
+
+func (s *ChargeState) UnmarshalJSON(data []byte) error {
+	type plain ChargeState
+	return unmarshalState(data, (*plain)(s), &s.RawJSON)
+}
+
+func (s *ClimateState) UnmarshalJSON(data []byte) error {
+	type plain ClimateState
+	return unmarshalState(data, (*plain)(s), &s.RawJSON)
+}
+
+func (s *DriveState) UnmarshalJSON(data []byte) error {
+	type plain DriveState
+	return unmarshalState(data, (*plain)(s), &s.RawJSON)
+}
+
+func (s *GuiSettings) UnmarshalJSON(data []byte) error {
+	type plain GuiSettings
+	return unmarshalState(data, (*plain)(s), &s.RawJSON)
+}
+
+func (s *VehicleState) UnmarshalJSON(data []byte) error {
+	type plain VehicleState
+	return unmarshalState(data, (*plain)(s), &s.RawJSON)
+}
+
+func (c *VehicleConfig) UnmarshalJSON(data []byte) error {
+	type plain VehicleConfig
+	return unmarshalState(data, (*plain)(c), &c.RawJSON)
+}
+
+// Decodes the state named by the resource from its JSON, as the states
+// embedded in the response are decoded field by field, which loses their JSON
+func (r *StateRequest) decodeState(resource string, data json.RawMessage) error {
+	if len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+	var state interface{}
+	switch strings.TrimPrefix(resource, "/") {
+	case "charge_state":
+		r.Response.ChargeState = &ChargeState{}
+		state = r.Response.ChargeState
+	case "climate_state":
+		r.Response.ClimateState = &ClimateState{}
+		state = r.Response.ClimateState
+	case "drive_state":
+		r.Response.DriveState = &DriveState{}
+		state = r.Response.DriveState
+	case "gui_settings":
+		r.Response.GuiSettings = &GuiSettings{}
+		state = r.Response.GuiSettings
+	case "vehicle_state":
+		r.Response.VehicleState = &VehicleState{}
+		state = r.Response.VehicleState
+	default:
+		return nil
+	}
+	return json.Unmarshal(data, state)
+}
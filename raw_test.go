@@ -0,0 +1,87 @@
+package tesla
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var VehicleStateExtraJSON = `{"response":{"locked":true,"odometer":3738.84633,"tpms_pressure_fl":2.9,"vehicle_self_test_progress":0,"tpms_hard_warning_fl":false,"center_display_state":2,"sentry_mode_state":"Aware"}}`
+
+func TestRawSpec(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/1/vehicles/1234/data_request/vehicle_state":
+			w.Write([]byte(VehicleStateExtraJSON))
+		case "/api/1/vehicles/1234/vehicle_data":
+			w.Write([]byte(`{"response":{"id":1234,"state":"online","charge_state":{"battery_level":58,"preconditioning_enabled":true},"vehicle_config":{"car_type":"modely","cabin_overheat_protection":"On"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client := &Client{
+		HTTP:    &http.Client{},
+		Token:   &Token{AccessToken: "foo", Expires: 99999999999},
+		BaseURL: ts.URL + "/api/1",
+	}
+	vehicle := &Vehicle{ID: 1234, c: client}
+
+	Convey("Should keep the fields of the states it does not know", t, func() {
+		state, err := vehicle.VehicleState()
+		So(err, ShouldBeNil)
+		So(state.Locked, ShouldBeTrue)
+		pressure, ok := state.RawFloat("tpms_pressure_fl")
+		So(ok, ShouldBeTrue)
+		So(pressure, ShouldEqual, 2.9)
+		progress, ok := state.RawInt("vehicle_self_test_progress")
+		So(ok, ShouldBeTrue)
+		So(progress, ShouldEqual, 0)
+		warning, ok := state.RawBool("tpms_hard_warning_fl")
+		So(ok, ShouldBeTrue)
+		So(warning, ShouldBeFalse)
+		sentry, ok := state.RawString("sentry_mode_state")
+		So(ok, ShouldBeTrue)
+		So(sentry, ShouldEqual, "Aware")
+		_, ok = state.RawString("tpms_pressure_fl")
+		So(ok, ShouldBeFalse)
+		_, ok = state.RawFloat("tpms_pressure_rr")
+		So(ok, ShouldBeFalse)
+
+		extra := state.ExtraFields()
+		So(extra, ShouldContainKey, "tpms_pressure_fl")
+		So(extra, ShouldContainKey, "sentry_mode_state")
+		So(extra, ShouldNotContainKey, "locked")
+		So(extra, ShouldNotContainKey, "center_display_state")
+		So(string(state.Raw()), ShouldContainSubstring, `"vehicle_self_test_progress":0`)
+	})
+
+	Convey("Should keep the JSON of the vehicle data", t, func() {
+		data, err := vehicle.VehicleData(nil)
+		So(err, ShouldBeNil)
+		So(data.ChargeState.BatteryLevel, ShouldEqual, 58)
+		enabled, ok := data.ChargeState.RawBool("preconditioning_enabled")
+		So(ok && enabled, ShouldBeTrue)
+		protection, ok := data.VehicleConfig.RawString("cabin_overheat_protection")
+		So(ok, ShouldBeTrue)
+		So(protection, ShouldEqual, "On")
+	})
+
+	Convey("Should encode the known fields only", t, func() {
+		state, err := vehicle.VehicleState()
+		So(err, ShouldBeNil)
+		b, err := json.Marshal(state)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldNotContainSubstring, "tpms_pressure_fl")
+		var decoded struct {
+			Response *DriveState `json:"response"`
+		}
+		So(json.Unmarshal([]byte(`{"response":null}`), &decoded), ShouldBeNil)
+		So(decoded.Response, ShouldBeNil)
+		So((&DriveState{}).Raw(), ShouldBeNil)
+	})
+}
@@ -0,0 +1,268 @@
+package tesla
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Region is the region a Tesla account is registered in, which determines
+// the endpoints of the API
+type Region string
+
+const (
+	// RegionNorthAmerica is the region of accounts in North America and
+	// Asia-Pacific, and the default region of the client
+	RegionNorthAmerica Region = "na"
+	// RegionEurope is the region of accounts in Europe, the Middle East and
+	// Africa. It shares the owner API endpoints of RegionNorthAmerica, but
+	// not those of the Fleet API.
+	RegionEurope Region = "eu"
+	// RegionChina is the region of accounts in mainland China
+	RegionChina Region = "cn"
+)
+
+// Endpoints are the URLs of the Tesla services of a region
+type Endpoints struct {
+	SSOURL         string
+	SSORedirectURL string
+	AuthURL        string
+	BaseURL        string
+	StreamingURL   string
+	FleetAuthURL   string
+	FleetAPIURL    string
+}
+
+// The regions in the order they are considered when detecting the region
+var regions = []Region{RegionNorthAmerica, RegionEurope, RegionChina}
+
+var regionEndpoints = map[Region]Endpoints{
+	RegionNorthAmerica: {
+		SSOURL:         "https://auth.tesla.com/oauth2/v3",
+		SSORedirectURL: "https://auth.tesla.com/void/callback",
+		AuthURL:        "https://owner-api.teslamotors.com/oauth/token",
+		BaseURL:        "https://owner-api.teslamotors.com/api/1",
+		StreamingURL:   "https://streaming.vn.teslamotors.com",
+		FleetAuthURL:   "https://fleet-auth.prd.vn.cloud.tesla.com/oauth2/v3",
+		FleetAPIURL:    "https://fleet-api.prd.na.vn.cloud.tesla.com",
+	},
+	RegionEurope: {
+		SSOURL:         "https://auth.tesla.com/oauth2/v3",
+		SSORedirectURL: "https://auth.tesla.com/void/callback",
+		AuthURL:        "https://owner-api.teslamotors.com/oauth/token",
+		BaseURL:        "https://owner-api.teslamotors.com/api/1",
+		StreamingURL:   "https://streaming.vn.teslamotors.com",
+		FleetAuthURL:   "https://fleet-auth.prd.vn.cloud.tesla.com/oauth2/v3",
+		FleetAPIURL:    "https://fleet-api.prd.eu.vn.cloud.tesla.com",
+	},
+	RegionChina: {
+		SSOURL:         "https://auth.tesla.cn/oauth2/v3",
+		SSORedirectURL: "https://auth.tesla.cn/void/callback",
+		AuthURL:        "https://owner-api.vn.cloud.tesla.cn/oauth/token",
+		BaseURL:        "https://owner-api.vn.cloud.tesla.cn/api/1",
+		StreamingURL:   "https://streaming.vn.cloud.tesla.cn",
+		FleetAuthURL:   "https://auth.tesla.cn/oauth2/v3",
+		FleetAPIURL:    "https://fleet-api.prd.cn.vn.cloud.tesla.cn",
+	},
+}
+
+// ParseRegion returns the region with the given code, e.g. "eu"
+func ParseRegion(code string) (Region, error) {
+	region := Region(strings.ToLower(code))
+	if _, ok := regionEndpoints[region]; !ok {
+		return "", fmt.Errorf("unknown region %q", code)
+	}
+	return region, nil
+}
+
+// Endpoints returns the endpoints of the region. Unknown regions use the
+// endpoints of RegionNorthAmerica.
+func (r Region) Endpoints() Endpoints {
+	if endpoints, ok := regionEndpoints[r]; ok {
+		return endpoints
+	}
+	return regionEndpoints[RegionNorthAmerica]
+}
+
+// The claims of an access token used to detect the region
+type tokenClaims struct {
+	Issuer string `json:"iss"`
+	OUCode string `json:"ou_code"`
+}
+
+// RegionFromToken detects the region of the account from the claims of a
+// JWT access token, as issued by the SSO service. It reports false for
+// opaque tokens and tokens that do not reveal the region.
+func RegionFromToken(accessToken string) (Region, bool) {
+	parts := strings.Split(accessToken, ".")
+	if len(parts) != 3 {
+		return "", false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return "", false
+	}
+	claims := &tokenClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return "", false
+	}
+	if region, err := ParseRegion(claims.OUCode); err == nil {
+		return region, true
+	}
+	return regionForSSOURL(claims.Issuer)
+}
+
+// Returns the region whose SSO service is at the URL
+func regionForSSOURL(ssoURL string) (Region, bool) {
+	for _, region := range regions {
+		if strings.HasPrefix(ssoURL, regionEndpoints[region].SSOURL) {
+			return region, true
+		}
+	}
+	return "", false
+}
+
+// Returns the endpoints of the region used by the client, which are those
+// of regionEndpoints unless the client was pointed elsewhere
+func (c *Client) endpointsOf(region Region) (Endpoints, bool) {
+	all := c.endpoints
+	if all == nil {
+		all = regionEndpoints
+	}
+	endpoints, ok := all[region]
+	return endpoints, ok
+}
+
+// Returns the endpoints of the region, or those of RegionNorthAmerica for
+// unknown regions, like Region.Endpoints
+func (c *Client) regionEndpoints(region Region) Endpoints {
+	if endpoints, ok := c.endpointsOf(region); ok {
+		return endpoints
+	}
+	endpoints, _ := c.endpointsOf(RegionNorthAmerica)
+	return endpoints
+}
+
+// Returns the region whose API host is mentioned in the body of a
+// misdirected request response
+func (c *Client) regionFromBody(body []byte) (Region, bool) {
+	for _, region := range regions {
+		endpoints, _ := c.endpointsOf(region)
+		u, err := url.Parse(c.apiBaseURL(endpoints))
+		if err == nil && u.Host != "" && strings.Contains(string(body), u.Host) {
+			return region, true
+		}
+	}
+	return "", false
+}
+
+// Returns the base URL of the API of the client among the endpoints
+func (c *Client) apiBaseURL(endpoints Endpoints) string {
+	if c.API == FleetAPI {
+		return endpoints.FleetAPIURL + "/api/1"
+	}
+	return endpoints.BaseURL
+}
+
+// Sets the endpoints of the client
+func (c *Client) setEndpoints(endpoints Endpoints) {
+	c.SSOURL = endpoints.SSOURL
+	c.SSORedirectURL = endpoints.SSORedirectURL
+	c.AuthURL = endpoints.AuthURL
+	c.BaseURL = c.apiBaseURL(endpoints)
+	c.StreamingURL = endpoints.StreamingURL
+	c.FleetAuthURL = endpoints.FleetAuthURL
+}
+
+// Returns the base URL of the API, which a misdirected request may switch
+// while other requests are sent
+func (c *Client) baseURL() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.BaseURL
+}
+
+// Returns the URL of the streaming API, see baseURL
+func (c *Client) streamingURL() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.StreamingURL
+}
+
+// Indicates whether the client uses the endpoints of a known region, rather
+// than custom ones
+func (c *Client) knownEndpoints() bool {
+	for _, region := range regions {
+		endpoints, _ := c.endpointsOf(region)
+		if c.SSOURL == endpoints.SSOURL &&
+			c.SSORedirectURL == endpoints.SSORedirectURL &&
+			c.AuthURL == endpoints.AuthURL &&
+			c.BaseURL == c.apiBaseURL(endpoints) &&
+			c.StreamingURL == endpoints.StreamingURL &&
+			c.FleetAuthURL == endpoints.FleetAuthURL {
+			return true
+		}
+	}
+	return false
+}
+
+// Switches the client to the endpoints of the detected region. The endpoints
+// are kept if the region is already set or the client uses custom endpoints.
+func (c *Client) detectRegion(region Region) bool {
+	endpoints, ok := c.endpointsOf(region)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !ok || c.Region != "" || !c.knownEndpoints() {
+		return false
+	}
+	c.Region = region
+	if c.apiBaseURL(endpoints) != c.BaseURL {
+		c.logf("switching to the endpoints of region %s", region)
+	}
+	c.setEndpoints(endpoints)
+	return true
+}
+
+// Returns the request to send instead of one rejected with 421 Misdirected
+// Request, after switching the client to the region of the account. The
+// region is only switched if the response or the token names it, as a 421
+// may also come from a proxy in between.
+func (c *Client) redirectRegion(req *http.Request, err error) (*http.Request, bool) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusMisdirectedRequest {
+		return nil, false
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return nil, false
+	}
+	previous := c.baseURL()
+	if !strings.HasPrefix(req.URL.String(), previous) {
+		return nil, false
+	}
+	region, ok := c.regionFromBody(apiErr.Body)
+	if !ok {
+		region, ok = RegionFromToken(c.token().AccessToken)
+	}
+	if ok {
+		c.detectRegion(region)
+	}
+	// The endpoints are kept if the region was set explicitly or detected before
+	current := c.baseURL()
+	if current == previous {
+		return nil, false
+	}
+	retry, err := cloneRequest(req)
+	if err != nil {
+		return nil, false
+	}
+	retry.URL, err = url.Parse(current + strings.TrimPrefix(req.URL.String(), previous))
+	if err != nil {
+		return nil, false
+	}
+	retry.Host = retry.URL.Host
+	return retry, true
+}
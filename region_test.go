@@ -0,0 +1,190 @@
+package tesla
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// Returns an unsigned JWT carrying the claims
+func testJWT(claims string) string {
+	return "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".sig"
+}
+
+// Points the clients at the first server for the global regions and at the
+// second one for the China region
+func withTestRegions(global, china *httptest.Server) ClientOption {
+	endpoints := func(ts *httptest.Server) Endpoints {
+		return Endpoints{
+			SSOURL:         ts.URL + "/oauth2/v3",
+			SSORedirectURL: SSORedirectURL,
+			AuthURL:        ts.URL + "/oauth/token",
+			BaseURL:        ts.URL + "/api/1",
+			StreamingURL:   ts.URL,
+		}
+	}
+	return func(c *Client) {
+		c.endpoints = map[Region]Endpoints{
+			RegionNorthAmerica: endpoints(global),
+			RegionEurope:       endpoints(global),
+			RegionChina:        endpoints(china),
+		}
+		c.setEndpoints(c.regionEndpoints(RegionNorthAmerica))
+	}
+}
+
+func TestRegionSpec(t *testing.T) {
+	Convey("Should parse region codes", t, func() {
+		region, err := ParseRegion("CN")
+		So(err, ShouldBeNil)
+		So(region, ShouldEqual, RegionChina)
+		_, err = ParseRegion("mars")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Should select the endpoints of the region", t, func() {
+		So(RegionChina.Endpoints().BaseURL, ShouldEqual, "https://owner-api.vn.cloud.tesla.cn/api/1")
+		So(RegionEurope.Endpoints().BaseURL, ShouldEqual, BaseURL)
+		So(Region("mars").Endpoints(), ShouldResemble, RegionNorthAmerica.Endpoints())
+
+		client, err := NewClientWithToken(nil, &Token{AccessToken: "foo", Expires: 99999999999}, WithRegion(RegionChina))
+		So(err, ShouldBeNil)
+		So(client.Region, ShouldEqual, RegionChina)
+		So(client.SSOURL, ShouldEqual, "https://auth.tesla.cn/oauth2/v3")
+		So(client.SSORedirectURL, ShouldEqual, "https://auth.tesla.cn/void/callback")
+		So(client.StreamingURL, ShouldEqual, "https://streaming.vn.cloud.tesla.cn")
+	})
+
+	Convey("Should detect the region from the token", t, func() {
+		region, ok := RegionFromToken(testJWT(`{"iss":"https://auth.tesla.cn/oauth2/v3/nts","ou_code":""}`))
+		So(ok, ShouldBeTrue)
+		So(region, ShouldEqual, RegionChina)
+		region, ok = RegionFromToken(testJWT(`{"iss":"https://auth.tesla.com/oauth2/v3/nts","ou_code":"EU"}`))
+		So(ok, ShouldBeTrue)
+		So(region, ShouldEqual, RegionEurope)
+		_, ok = RegionFromToken("qts-123")
+		So(ok, ShouldBeFalse)
+		_, ok = RegionFromToken(testJWT(`{"iss":"https://example.com"}`))
+		So(ok, ShouldBeFalse)
+
+		token := &Token{AccessToken: testJWT(`{"iss":"https://auth.tesla.cn/oauth2/v3/nts"}`), Expires: 99999999999}
+		client, err := NewClientWithToken(nil, token)
+		So(err, ShouldBeNil)
+		So(client.Region, ShouldEqual, RegionChina)
+		So(client.BaseURL, ShouldEqual, "https://owner-api.vn.cloud.tesla.cn/api/1")
+
+		Convey("Should keep custom endpoints", func() {
+			client, err := NewClientWithToken(nil, token, WithBaseURL("http://localhost/api/1"))
+			So(err, ShouldBeNil)
+			So(client.Region, ShouldEqual, "")
+			So(client.BaseURL, ShouldEqual, "http://localhost/api/1")
+		})
+
+		Convey("Should keep an explicit region", func() {
+			client, err := NewClientWithToken(nil, token, WithRegion(RegionEurope))
+			So(err, ShouldBeNil)
+			So(client.Region, ShouldEqual, RegionEurope)
+			So(client.BaseURL, ShouldEqual, BaseURL)
+		})
+	})
+
+	china := serveHTTP(t)
+	defer china.Close()
+	global := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == "POST" && req.URL.Path == "/oauth2/v3/authorize":
+			w.Header().Set("Location", china.URL+req.URL.RequestURI())
+			w.WriteHeader(http.StatusSeeOther)
+		case strings.HasPrefix(req.URL.Path, "/oauth2/v3/"):
+			serveSSO(t, w, req)
+		case req.URL.Path == "/api/1/vehicles" && req.Header.Get("Authorization") == "Bearer foo":
+			w.WriteHeader(http.StatusMisdirectedRequest)
+			w.Write([]byte(`{"response":null,"error":"user out of region, use ` + china.URL + `"}`))
+		case req.URL.Path == "/api/1/vehicles":
+			w.WriteHeader(http.StatusMisdirectedRequest)
+			w.Write([]byte(`{"response":null,"error":"user out of region"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer global.Close()
+	newTestClient := func(accessToken string) *Client {
+		client := &Client{
+			HTTP:  &http.Client{},
+			Token: &Token{AccessToken: accessToken, Expires: 99999999999},
+		}
+		withTestRegions(global, china)(client)
+		return client
+	}
+
+	Convey("Should switch to the region named by a misdirected request", t, func() {
+		client := newTestClient("foo")
+		vehicles, err := client.Vehicles()
+		So(err, ShouldBeNil)
+		So(len(vehicles), ShouldEqual, 1)
+		So(client.Region, ShouldEqual, RegionChina)
+		So(client.BaseURL, ShouldEqual, china.URL+"/api/1")
+
+		Convey("Should not switch an explicit region", func() {
+			client := newTestClient("foo")
+			client.Region = RegionNorthAmerica
+			_, err := client.Vehicles()
+			So(err, ShouldNotBeNil)
+			So(client.BaseURL, ShouldEqual, global.URL+"/api/1")
+		})
+	})
+
+	Convey("Should switch to the region named by the token on a misdirected request", t, func() {
+		client := newTestClient(testJWT(`{"iss":"https://auth.tesla.cn/oauth2/v3/nts"}`))
+		_, err := client.Vehicles()
+		So(err, ShouldBeNil)
+		So(client.Region, ShouldEqual, RegionChina)
+		So(client.BaseURL, ShouldEqual, china.URL+"/api/1")
+	})
+
+	Convey("Should not guess the region of a misdirected request", t, func() {
+		client := newTestClient("bar")
+		_, err := client.Vehicles()
+		var apiErr *APIError
+		So(errors.As(err, &apiErr), ShouldBeTrue)
+		So(apiErr.StatusCode, ShouldEqual, http.StatusMisdirectedRequest)
+		So(client.Region, ShouldEqual, "")
+		So(client.BaseURL, ShouldEqual, global.URL+"/api/1")
+	})
+
+	Convey("Should follow the login to the SSO service of the region", t, func() {
+		client, err := NewClient(&Auth{
+			ClientID:     "abc123",
+			ClientSecret: "def456",
+			Email:        "elon@tesla.com",
+			Password:     "go",
+		}, withTestRegions(global, china))
+		So(err, ShouldBeNil)
+		So(client.Token.AccessToken, ShouldEqual, "ghi789")
+		So(client.Region, ShouldEqual, RegionChina)
+		So(client.AuthURL, ShouldEqual, china.URL+"/oauth/token")
+	})
+
+	Convey("Should only follow the login to the SSO services of the regions", t, func() {
+		client := &Client{}
+		withTestRegions(global, china)(client)
+		session := &ssoSession{baseURL: global.URL + "/oauth2/v3", endpoints: client.endpointsOf}
+		redirect := func(location string) (Region, bool) {
+			res := &http.Response{StatusCode: http.StatusSeeOther, Header: http.Header{}}
+			res.Header.Set("Location", location)
+			return session.regionRedirect(res)
+		}
+		region, ok := redirect(china.URL + "/oauth2/v3/authorize?client_id=ownerapi")
+		So(ok, ShouldBeTrue)
+		So(region, ShouldEqual, RegionChina)
+		_, ok = redirect("https://example.com/oauth2/v3/authorize")
+		So(ok, ShouldBeFalse)
+		_, ok = redirect(global.URL + "/oauth2/v3/authorize")
+		So(ok, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,194 @@
+package tesla
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RetryPolicy controls how the client retries requests failing with transient
+// errors. State reads are retried, commands only if listed in IdempotentCommands.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts
+	MaxBackoff time.Duration
+	// Multiplier is the factor by which the delay grows with every attempt
+	Multiplier float64
+	// Jitter randomizes the delay by up to this fraction in either direction
+	Jitter float64
+	// RetryableStatusCodes are the HTTP status codes that are retried
+	RetryableStatusCodes []int
+	// RetryableReasons are the command failure reasons that are retried
+	RetryableReasons []string
+	// IdempotentCommands are the commands that may be sent more than once,
+	// e.g. "door_lock" or "wake_up". Commands like "charge_start" repeat
+	// safely on the vehicle but fail the repeat with a reason such as
+	// "is_charging", so a retry after a lost response would report a failure.
+	IdempotentCommands []string
+}
+
+// DefaultRetryPolicy returns a policy retrying gateway errors, timeouts and
+// rate limiting three times, and commands which are safe to repeat
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		RetryableStatusCodes: []int{
+			http.StatusRequestTimeout,
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+		RetryableReasons: []string{"could_not_wake_buses"},
+		IdempotentCommands: []string{
+			"wake_up",
+			"door_lock",
+			"door_unlock",
+			"charge_port_door_open",
+			"auto_conditioning_start",
+			"auto_conditioning_stop",
+			"set_temps",
+			"set_sentry_mode",
+		},
+	}
+}
+
+// Returns the delay before the given retry attempt, starting at 1
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// Indicates whether the request may be sent again without side effects
+func (p *RetryPolicy) idempotent(req *http.Request) bool {
+	if req.Method == "GET" {
+		return true
+	}
+	command := commandName(req)
+	for _, c := range p.IdempotentCommands {
+		if c == command {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the delay before retrying a request that returned body and err,
+// and whether it should be retried at all
+func (p *RetryPolicy) retryDelay(req *http.Request, attempt int, body []byte, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts || !p.idempotent(req) {
+		return 0, false
+	}
+	if err == nil {
+		return p.backoff(attempt), p.retryableReason(req, body)
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if !p.retryableStatus(apiErr.StatusCode) {
+			return 0, false
+		}
+		if apiErr.RetryAfter > 0 {
+			if p.MaxBackoff > 0 && apiErr.RetryAfter > p.MaxBackoff {
+				return p.MaxBackoff, true
+			}
+			return apiErr.RetryAfter, true
+		}
+		return p.backoff(attempt), true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return 0, false
+	}
+	// Network errors
+	return p.backoff(attempt), true
+}
+
+// Indicates whether the status code is retryable
+func (p *RetryPolicy) retryableStatus(code int) bool {
+	for _, c := range p.RetryableStatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Indicates whether the body is a failed command response with a retryable reason
+func (p *RetryPolicy) retryableReason(req *http.Request, body []byte) bool {
+	if commandName(req) == "" || len(p.RetryableReasons) == 0 {
+		return false
+	}
+	response := &CommandResponse{}
+	if json.Unmarshal(body, response) != nil || response.Response.Result {
+		return false
+	}
+	for _, r := range p.RetryableReasons {
+		if r == response.Response.Reason {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the name of the vehicle command sent by the request, if any
+func commandName(req *http.Request) string {
+	return commandNameFromPath(req.URL.Path)
+}
+
+// Returns the name of the vehicle command with the URL path, if any
+func commandNameFromPath(path string) string {
+	if strings.HasSuffix(path, "/wake_up") {
+		return "wake_up"
+	}
+	i := strings.LastIndex(path, "/command/")
+	if i < 0 {
+		return ""
+	}
+	return path[i+len("/command/"):]
+}
+
+// Waits for the delay to pass or the context to be done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Returns a copy of the request that can be sent again
+func cloneRequest(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		clone.Body = body
+	}
+	return clone, nil
+}
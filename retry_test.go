@@ -0,0 +1,155 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var CouldNotWakeBusesJSON = `{"response":{"reason":"could_not_wake_buses","result":false}}`
+
+func TestRetrySpec(t *testing.T) {
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		attempts[req.URL.Path]++
+		n := attempts[req.URL.Path]
+		mu.Unlock()
+		switch req.URL.Path {
+		case "/api/1/vehicles/1234":
+			if n < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(200)
+			w.Write([]byte(VehicleJSON))
+		case "/api/1/vehicles/429":
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/api/1/vehicles/404":
+			w.WriteHeader(http.StatusNotFound)
+		case "/api/1/vehicles/1234/command/door_lock":
+			w.WriteHeader(200)
+			if n < 2 {
+				w.Write([]byte(CouldNotWakeBusesJSON))
+				return
+			}
+			w.Write([]byte(CommandResponseJSON))
+		case "/api/1/vehicles/1234/command/charge_start":
+			if n < 2 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.WriteHeader(200)
+			w.Write([]byte(`{"response":{"reason":"is_charging","result":false}}`))
+		case "/api/1/vehicles/1234/command/honk_horn":
+			w.WriteHeader(http.StatusBadGateway)
+		case "/api/1/vehicles/1234/data_request/charge_state":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	policy := DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	policy.MaxBackoff = 5 * time.Millisecond
+	client := &Client{
+		HTTP:        &http.Client{},
+		Token:       &Token{AccessToken: "foo", Expires: 99999999999},
+		BaseURL:     ts.URL + "/api/1",
+		RetryPolicy: policy,
+	}
+	vehicle := &Vehicle{ID: 1234, c: client}
+
+	Convey("Should retry state reads on gateway errors", t, func() {
+		v, err := client.Vehicle(1234)
+		So(err, ShouldBeNil)
+		So(v.DisplayName, ShouldEqual, "Macak")
+		So(attempts["/api/1/vehicles/1234"], ShouldEqual, 3)
+	})
+
+	Convey("Should give up after the maximum attempts", t, func() {
+		_, err := client.Vehicle(429)
+		So(errors.Is(err, ErrRateLimited), ShouldBeTrue)
+		So(attempts["/api/1/vehicles/429"], ShouldEqual, 3)
+	})
+
+	Convey("Should not retry other errors", t, func() {
+		_, err := client.Vehicle(404)
+		So(err, ShouldNotBeNil)
+		So(attempts["/api/1/vehicles/404"], ShouldEqual, 1)
+	})
+
+	Convey("Should retry idempotent commands on retryable reasons", t, func() {
+		So(vehicle.LockDoors(), ShouldBeNil)
+		So(attempts["/api/1/vehicles/1234/command/door_lock"], ShouldEqual, 2)
+	})
+
+	Convey("Should not retry other commands", t, func() {
+		So(vehicle.HonkHorn(), ShouldNotBeNil)
+		So(attempts["/api/1/vehicles/1234/command/honk_horn"], ShouldEqual, 1)
+	})
+
+	Convey("Should not retry commands failing when repeated", t, func() {
+		var apiErr *APIError
+		So(errors.As(vehicle.StartCharging(), &apiErr), ShouldBeTrue)
+		So(apiErr.StatusCode, ShouldEqual, http.StatusBadGateway)
+		So(attempts["/api/1/vehicles/1234/command/charge_start"], ShouldEqual, 1)
+	})
+
+	Convey("Should stop retrying when the context is done", t, func() {
+		policy.InitialBackoff = time.Hour
+		policy.MaxBackoff = time.Hour
+		defer func() {
+			policy.InitialBackoff = time.Millisecond
+			policy.MaxBackoff = 5 * time.Millisecond
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		delete(attempts, "/api/1/vehicles/1234")
+		_, err := client.VehicleContext(ctx, 1234)
+		So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+	})
+
+	Convey("Should limit retries with the budget of the vehicle", t, func() {
+		limited := &Client{
+			HTTP:        &http.Client{},
+			Token:       &Token{AccessToken: "foo", Expires: 99999999999},
+			BaseURL:     ts.URL + "/api/1",
+			RetryPolicy: policy,
+			RateLimiter: &RateLimiter{
+				Vehicle:  RateLimits{StateReads: Every(time.Hour, 1)},
+				FailFast: true,
+			},
+		}
+		_, err := (&Vehicle{ID: 1234, c: limited}).ChargeState()
+		So(errors.Is(err, ErrRateLimitExceeded), ShouldBeTrue)
+		So(attempts["/api/1/vehicles/1234/data_request/charge_state"], ShouldEqual, 1)
+	})
+
+	Convey("Should cap the delay requested by the API", t, func() {
+		p := &RetryPolicy{MaxAttempts: 3, MaxBackoff: 5 * time.Second, RetryableStatusCodes: []int{http.StatusTooManyRequests}}
+		req, _ := http.NewRequest("GET", "http://foo.com", nil)
+		err := &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour}
+		delay, retry := p.retryDelay(req, 1, nil, err)
+		So(retry, ShouldBeTrue)
+		So(delay, ShouldEqual, 5*time.Second)
+	})
+
+	Convey("Should back off exponentially", t, func() {
+		p := &RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 2}
+		So(p.backoff(1), ShouldEqual, time.Second)
+		So(p.backoff(2), ShouldEqual, 2*time.Second)
+		So(p.backoff(3), ShouldEqual, 4*time.Second)
+		So(p.backoff(4), ShouldEqual, 5*time.Second)
+		p.Jitter = 0.5
+		So(p.backoff(1), ShouldBeBetweenOrEqual, 500*time.Millisecond, 1500*time.Millisecond)
+	})
+}
@@ -0,0 +1,139 @@
+package tesla
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// A vehicle executing signed commands, which records the commands and the
+// last message it received
+type signingVehicle struct {
+	*CommandVerifier
+	mu       sync.Mutex
+	commands []string
+	params   []string
+	last     []byte
+	fail     error
+}
+
+func newSigningVehicle(t *testing.T, vin string) *signingVehicle {
+	verifier, err := NewCommandVerifier(vin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &signingVehicle{CommandVerifier: verifier}
+	verifier.Execute = func(command string, params []byte) error {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		v.commands = append(v.commands, command)
+		v.params = append(v.params, string(params))
+		return v.fail
+	}
+	return v
+}
+
+func (v *signingVehicle) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	request := &struct {
+		RoutableMessage string `json:"routable_message"`
+	}{}
+	json.Unmarshal(body, request)
+	v.mu.Lock()
+	v.last, _ = base64.StdEncoding.DecodeString(request.RoutableMessage)
+	v.mu.Unlock()
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	v.CommandVerifier.ServeHTTP(w, req)
+}
+
+func TestSigningSpec(t *testing.T) {
+	vehicleSim := newSigningVehicle(t, "abc123")
+	mux := http.NewServeMux()
+	mux.Handle("/api/1/vehicles/abc123/signed_command", vehicleSim)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	key, err := GenerateCommandKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &Client{
+		HTTP:       &http.Client{},
+		Token:      &Token{AccessToken: "foo", Expires: 99999999999},
+		BaseURL:    ts.URL + "/api/1",
+		CommandKey: key,
+	}
+	vehicle := &Vehicle{ID: 1234, Vin: "abc123", CommandSigning: "required", c: client}
+
+	Convey("Should fail with a key that is not paired", t, func() {
+		err := vehicle.HonkHorn()
+		So(errors.Is(err, ErrKeyNotPaired), ShouldBeTrue)
+	})
+
+	vehicleSim.PairKey(&key.PublicKey)
+
+	Convey("Should send signed commands", t, func() {
+		So(vehicle.SetChargeLimit(80), ShouldBeNil)
+		So(vehicle.LockDoors(), ShouldBeNil)
+		So(vehicle.FlashLights(), ShouldBeNil)
+		So(vehicleSim.commands[len(vehicleSim.commands)-3:], ShouldResemble, []string{"set_charge_limit", "door_lock", "flash_lights"})
+		So(vehicleSim.params[len(vehicleSim.params)-3], ShouldEqual, `{"percent": 80}`)
+	})
+
+	Convey("Should return the reason of a failed command", t, func() {
+		vehicleSim.fail = &CommandError{Reason: "is_charging"}
+		defer func() { vehicleSim.fail = nil }()
+		err := vehicle.StartCharging()
+		So(errors.Is(err, ErrIsCharging), ShouldBeTrue)
+	})
+
+	Convey("Should reject a replayed command", t, func() {
+		So(vehicle.StopCharging(), ShouldBeNil)
+		res, err := vehicleSim.Handle(vehicleSim.last)
+		So(err, ShouldBeNil)
+		message, err := decodeRoutableMessage(res)
+		So(err, ShouldBeNil)
+		So(message.fault, ShouldEqual, MessageFaultInvalidTokenOrCounter)
+	})
+
+	Convey("Should resynchronize the session when the clocks drift", t, func() {
+		vehicleSim.Now = func() time.Time {
+			return time.Now().Add(time.Hour)
+		}
+		defer func() { vehicleSim.Now = nil }()
+		n := len(vehicleSim.commands)
+		So(vehicle.StopAirConditioning(), ShouldBeNil)
+		So(len(vehicleSim.commands), ShouldEqual, n+1)
+		So(vehicle.StartAirConditioning(), ShouldBeNil)
+		So(vehicleSim.commands[n:], ShouldResemble, []string{"auto_conditioning_stop", "auto_conditioning_start"})
+	})
+
+	Convey("Should not send unsigned commands to vehicles requiring signatures", t, func() {
+		So(vehicle.ResetValetPIN(), ShouldEqual, ErrSigningRequired)
+		unsigned := &Client{HTTP: &http.Client{}, BaseURL: ts.URL + "/api/1"}
+		So((&Vehicle{Vin: "abc123", CommandSigning: "required", c: unsigned}).HonkHorn(), ShouldEqual, ErrSigningRequired)
+	})
+
+	Convey("Should save and load command keys", t, func() {
+		dir, err := ioutil.TempDir("", "tesla")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "key.pem")
+		So(SaveCommandKey(path, key), ShouldBeNil)
+		loaded, err := LoadCommandKey(path)
+		So(err, ShouldBeNil)
+		So(loaded.D.Cmp(key.D), ShouldEqual, 0)
+		So(PublicKeyBytes(&loaded.PublicKey), ShouldHaveLength, 65)
+	})
+}
@@ -0,0 +1,332 @@
+package tesla
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// SSOURL is the base of Tesla's single sign-on OAuth2 endpoints
+	SSOURL = "https://auth.tesla.com/oauth2/v3"
+	// SSORedirectURL is the default redirect URI registered for the owner API client
+	SSORedirectURL = "https://auth.tesla.com/void/callback"
+)
+
+const (
+	ssoClientID   = "ownerapi"
+	ssoScope      = "openid email offline_access"
+	jwtBearerType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+)
+
+// The token returned by the SSO service, which is exchanged for an owner API token
+type ssoToken struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// The request that exchanges an SSO access token for an owner API token
+type ownerTokenRequest struct {
+	GrantType    string `json:"grant_type"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// Holds the state of a single SSO login attempt
+type ssoSession struct {
+	ctx         context.Context
+	baseURL     string
+	redirectURL string
+	userAgent   string
+	http        *http.Client
+	verifier    string
+	challenge   string
+	state       string
+	redirected  bool
+	// region is the region whose SSO service the login was redirected to
+	region    Region
+	endpoints func(Region) (Endpoints, bool)
+}
+
+var hiddenInputRegexp = regexp.MustCompile(`<input[^>]+type="hidden"[^>]*>`)
+var inputNameRegexp = regexp.MustCompile(`name="([^"]*)"`)
+var inputValueRegexp = regexp.MustCompile(`value="([^"]*)"`)
+
+// Creates a new SSO session with a fresh PKCE code verifier and a cookie jar,
+// sharing the transport of the client. All requests of the session use ctx.
+func (c *Client) newSSOSession(ctx context.Context) (*ssoSession, error) {
+	verifier, err := randomString(64)
+	if err != nil {
+		return nil, err
+	}
+	state, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+	jar, _ := cookiejar.New(nil)
+	return &ssoSession{
+		ctx:         ctx,
+		baseURL:     c.SSOURL,
+		redirectURL: c.SSORedirectURL,
+		userAgent:   c.UserAgent,
+		endpoints:   c.endpointsOf,
+		http: &http.Client{
+			Transport: c.HTTP.Transport,
+			Jar:       jar,
+			Timeout:   c.HTTP.Timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		verifier:  verifier,
+		challenge: codeChallenge(verifier),
+		state:     state,
+	}, nil
+}
+
+// Returns a URL-safe random string generated from n random bytes
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Computes the S256 PKCE code challenge for a code verifier
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Returns the URL of the SSO authorize page including the PKCE parameters
+func (s *ssoSession) authorizeURL() string {
+	q := url.Values{}
+	q.Set("client_id", ssoClientID)
+	q.Set("code_challenge", s.challenge)
+	q.Set("code_challenge_method", "S256")
+	q.Set("redirect_uri", s.redirectURL)
+	q.Set("response_type", "code")
+	q.Set("scope", ssoScope)
+	q.Set("state", s.state)
+	return s.baseURL + "/authorize?" + q.Encode()
+}
+
+// Performs a GET request within the session
+func (s *ssoSession) get(url string) (*http.Response, error) {
+	req, _ := http.NewRequestWithContext(s.ctx, "GET", url, nil)
+	return s.do(req)
+}
+
+// Posts a form within the session
+func (s *ssoSession) postForm(url string, form url.Values) (*http.Response, error) {
+	req, _ := http.NewRequestWithContext(s.ctx, "POST", url, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return s.do(req)
+}
+
+// Performs a request within the session
+func (s *ssoSession) do(req *http.Request) (*http.Response, error) {
+	if s.userAgent != "" {
+		req.Header.Set("User-Agent", s.userAgent)
+	}
+	return s.http.Do(req)
+}
+
+// Extracts the hidden form inputs from the SSO login page
+func parseHiddenInputs(page []byte) url.Values {
+	form := url.Values{}
+	for _, input := range hiddenInputRegexp.FindAll(page, -1) {
+		name := inputNameRegexp.FindSubmatch(input)
+		if name == nil {
+			continue
+		}
+		value := ""
+		if m := inputValueRegexp.FindSubmatch(input); m != nil {
+			value = string(m[1])
+		}
+		form.Set(string(name[1]), value)
+	}
+	return form
+}
+
+// Performs the SSO login, returning the authorization code from the redirect.
+// If the account belongs to the SSO service of another region, the login is
+// repeated there.
+func (s *ssoSession) login(auth *Auth) (string, error) {
+	res, err := s.get(s.authorizeURL())
+	if err != nil {
+		return "", err
+	}
+	page, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", newAPIError(res, page)
+	}
+
+	form := parseHiddenInputs(page)
+	form.Set("identity", auth.Email)
+	form.Set("credential", auth.Password)
+	if requiresCaptcha(page) {
+		captcha, err := s.solveCaptcha(auth)
+		if err != nil {
+			return "", err
+		}
+		form.Set("captcha", captcha)
+	}
+	res, err = s.postForm(s.authorizeURL(), form)
+	if err != nil {
+		return "", err
+	}
+	page, err = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode == http.StatusOK && requiresMFA(page) {
+		return s.verifyMFA(auth, form.Get("transaction_id"))
+	}
+	if region, ok := s.regionRedirect(res); ok && !s.redirected {
+		endpoints, _ := s.endpoints(region)
+		s.baseURL = endpoints.SSOURL
+		s.redirectURL = endpoints.SSORedirectURL
+		s.redirected = true
+		s.region = region
+		return s.login(auth)
+	}
+	return s.authorizationCode(res)
+}
+
+// Returns the region whose SSO service the login was redirected to, if it
+// was redirected to the authorize page of another region. Redirects to hosts
+// which are not SSO services of a region are not followed, so that the
+// credentials are not sent there.
+func (s *ssoSession) regionRedirect(res *http.Response) (Region, bool) {
+	if res.StatusCode < 300 || res.StatusCode >= 400 {
+		return "", false
+	}
+	location, err := res.Location()
+	if err != nil || !strings.HasSuffix(location.Path, "/authorize") {
+		return "", false
+	}
+	baseURL := location.Scheme + "://" + location.Host + strings.TrimSuffix(location.Path, "/authorize")
+	if baseURL == s.baseURL {
+		return "", false
+	}
+	for _, region := range regions {
+		if endpoints, ok := s.endpoints(region); ok && endpoints.SSOURL == baseURL {
+			return region, true
+		}
+	}
+	return "", false
+}
+
+// Extracts the authorization code from the redirect issued after a successful login
+func (s *ssoSession) authorizationCode(res *http.Response) (string, error) {
+	if res.StatusCode != http.StatusFound {
+		return "", errors.New("login failed: " + res.Status)
+	}
+	location, err := res.Location()
+	if err != nil {
+		return "", err
+	}
+	q := location.Query()
+	if q.Get("state") != s.state {
+		return "", errors.New("login failed: state mismatch")
+	}
+	code := q.Get("code")
+	if code == "" {
+		return "", errors.New("login failed: no authorization code returned")
+	}
+	return code, nil
+}
+
+// Exchanges the authorization code for an SSO token
+func (s *ssoSession) exchangeCode(code string) (*ssoToken, error) {
+	return s.token(map[string]string{
+		"grant_type":    "authorization_code",
+		"client_id":     ssoClientID,
+		"code":          code,
+		"code_verifier": s.verifier,
+		"redirect_uri":  s.redirectURL,
+	})
+}
+
+// Exchanges a refresh token for a new SSO token
+func (s *ssoSession) refresh(refreshToken string) (*ssoToken, error) {
+	return s.token(map[string]string{
+		"grant_type":    "refresh_token",
+		"client_id":     ssoClientID,
+		"refresh_token": refreshToken,
+		"scope":         ssoScope,
+	})
+}
+
+// Posts a request to the SSO token endpoint
+func (s *ssoSession) token(params map[string]string) (*ssoToken, error) {
+	data, _ := json.Marshal(params)
+	req, _ := http.NewRequestWithContext(s.ctx, "POST", s.baseURL+"/token", bytes.NewBuffer(data))
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	res, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, newAPIError(res, body)
+	}
+	token := &ssoToken{}
+	if err := json.Unmarshal(body, token); err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("login failed: no access token returned")
+	}
+	return token, nil
+}
+
+// Exchanges an SSO access token for a token accepted by the owner API
+func (c *Client) exchangeOwnerToken(ctx context.Context, auth *Auth, sso *ssoToken) (*Token, error) {
+	now := time.Now()
+	data, _ := json.Marshal(&ownerTokenRequest{
+		GrantType:    jwtBearerType,
+		ClientID:     auth.ClientID,
+		ClientSecret: auth.ClientSecret,
+	})
+	req, _ := http.NewRequestWithContext(ctx, "POST", c.AuthURL, bytes.NewBuffer(data))
+	req.Header.Set("Authorization", "Bearer "+sso.AccessToken)
+	body, err := c.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	token := &Token{}
+	if err := json.Unmarshal(body, token); err != nil {
+		return nil, err
+	}
+	// The owner API token is renewed through SSO, so keep the SSO refresh token
+	token.RefreshToken = sso.RefreshToken
+	token.Expires = now.Add(time.Second * time.Duration(token.ExpiresIn)).Unix()
+	return token, nil
+}
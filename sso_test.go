@@ -0,0 +1,112 @@
+package tesla
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var (
+	SSOLoginPageHTML = `<html><body><form method="post">
+<input type="hidden" name="_csrf" value="csrf123" />
+<input type="hidden" name="_phase" value="authenticate" />
+<input type="hidden" name="_process" value="1" />
+<input type="hidden" name="transaction_id" value="tx123" />
+<input type="hidden" name="cancel" value="" />
+<input type="text" name="identity" value="" />
+</form></body></html>`
+	SSOTokenJSON = `{"access_token":"sso123","refresh_token":"refresh123","id_token":"id123","token_type":"Bearer","expires_in":300}`
+)
+
+func TestSSOSpec(t *testing.T) {
+	ts := serveHTTP(t)
+	defer ts.Close()
+
+	Convey("Should compute the S256 code challenge", t, func() {
+		// Test vector from RFC 7636, appendix B
+		So(codeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"), ShouldEqual, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM")
+	})
+
+	Convey("Should parse the hidden login form inputs", t, func() {
+		form := parseHiddenInputs([]byte(SSOLoginPageHTML))
+		So(form.Get("_csrf"), ShouldEqual, "csrf123")
+		So(form.Get("transaction_id"), ShouldEqual, "tx123")
+		So(form, ShouldContainKey, "cancel")
+		So(form, ShouldNotContainKey, "identity")
+	})
+
+	Convey("Should fail to login with bad credentials", t, func() {
+		_, err := NewClient(&Auth{
+			ClientID:     "abc123",
+			ClientSecret: "def456",
+			Email:        "elon@tesla.com",
+			Password:     "wrong",
+		}, testOptions(ts)...)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "login failed")
+	})
+}
+
+// Serves a stand-in for the SSO service. The authorization code encodes the
+// PKCE code challenge, so that the token endpoint can verify the code verifier.
+func serveSSO(t *testing.T, w http.ResponseWriter, req *http.Request) {
+	switch {
+	case req.Method == "GET" && req.URL.Path == "/oauth2/v3/authorize":
+		q := req.URL.Query()
+		Convey("Authorize request should carry the PKCE parameters", t, func() {
+			So(q.Get("client_id"), ShouldEqual, ssoClientID)
+			So(q.Get("code_challenge_method"), ShouldEqual, "S256")
+			So(q.Get("code_challenge"), ShouldNotBeEmpty)
+			So(q.Get("state"), ShouldNotBeEmpty)
+		})
+		http.SetCookie(w, &http.Cookie{Name: "tesla-auth.sid", Value: "session123"})
+		w.WriteHeader(200)
+		w.Write([]byte(SSOLoginPageHTML))
+	case req.Method == "POST" && req.URL.Path == "/oauth2/v3/authorize":
+		req.ParseForm()
+		Convey("Login form should be posted with the session", t, func() {
+			cookie, err := req.Cookie("tesla-auth.sid")
+			So(err, ShouldBeNil)
+			So(cookie.Value, ShouldEqual, "session123")
+			So(req.PostForm.Get("_csrf"), ShouldEqual, "csrf123")
+			So(req.PostForm.Get("transaction_id"), ShouldEqual, "tx123")
+			So(req.PostForm.Get("identity"), ShouldEqual, "elon@tesla.com")
+		})
+		if req.PostForm.Get("credential") != "go" {
+			w.WriteHeader(200)
+			w.Write([]byte(SSOLoginPageHTML))
+			return
+		}
+		q := url.Values{}
+		q.Set("code", "code-"+req.URL.Query().Get("code_challenge"))
+		q.Set("state", req.URL.Query().Get("state"))
+		w.Header().Set("Location", SSORedirectURL+"?"+q.Encode())
+		w.WriteHeader(http.StatusFound)
+	case req.Method == "POST" && req.URL.Path == "/oauth2/v3/token":
+		params := map[string]string{}
+		json.NewDecoder(req.Body).Decode(&params)
+		Convey("Token request should identify the owner API client", t, func() {
+			So(params["client_id"], ShouldEqual, ssoClientID)
+		})
+		switch params["grant_type"] {
+		case "authorization_code":
+			if "code-"+codeChallenge(params["code_verifier"]) != params["code"] ||
+				params["redirect_uri"] != SSORedirectURL {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		case "refresh_token":
+			if params["refresh_token"] != "refresh123" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+		w.WriteHeader(200)
+		w.Write([]byte(SSOTokenJSON))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
@@ -1,111 +1,121 @@
 package tesla
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"log"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // Contains the current charge states that exist within the vehicle
 type ChargeState struct {
-	ChargingState               string      `json:"charging_state"`
-	ChargeLimitSoc              int         `json:"charge_limit_soc"`
-	ChargeLimitSocStd           int         `json:"charge_limit_soc_std"`
-	ChargeLimitSocMin           int         `json:"charge_limit_soc_min"`
-	ChargeLimitSocMax           int         `json:"charge_limit_soc_max"`
-	ChargeToMaxRange            bool        `json:"charge_to_max_range"`
-	BatteryHeaterOn             bool        `json:"battery_heater_on"`
-	NotEnoughPowerToHeat        bool        `json:"not_enough_power_to_heat"`
-	MaxRangeChargeCounter       int         `json:"max_range_charge_counter"`
-	FastChargerPresent          bool        `json:"fast_charger_present"`
-	FastChargerType             string      `json:"fast_charger_type"`
-	BatteryRange                float64     `json:"battery_range"`
-	EstBatteryRange             float64     `json:"est_battery_range"`
-	IdealBatteryRange           float64     `json:"ideal_battery_range"`
-	BatteryLevel                int         `json:"battery_level"`
-	UsableBatteryLevel          int         `json:"usable_battery_level"`
-	BatteryCurrent              interface{} `json:"battery_current"`
-	ChargeEnergyAdded           float64     `json:"charge_energy_added"`
-	ChargeMilesAddedRated       float64     `json:"charge_miles_added_rated"`
-	ChargeMilesAddedIdeal       float64     `json:"charge_miles_added_ideal"`
-	ChargerVoltage              interface{} `json:"charger_voltage"`
-	ChargerPilotCurrent         interface{} `json:"charger_pilot_current"`
-	ChargerActualCurrent        interface{} `json:"charger_actual_current"`
-	ChargerPower                interface{} `json:"charger_power"`
-	TimeToFullCharge            float64     `json:"time_to_full_charge"`
-	TripCharging                interface{} `json:"trip_charging"`
-	ChargeRate                  float64     `json:"charge_rate"`
-	ChargePortDoorOpen          bool        `json:"charge_port_door_open"`
-	MotorizedChargePort         bool        `json:"motorized_charge_port"`
-	ScheduledChargingStartTime  interface{} `json:"scheduled_charging_start_time"`
-	ScheduledChargingPending    bool        `json:"scheduled_charging_pending"`
-	UserChargeEnableRequest     interface{} `json:"user_charge_enable_request"`
-	ChargeEnableRequest         bool        `json:"charge_enable_request"`
-	EuVehicle                   bool        `json:"eu_vehicle"`
-	ChargerPhases               interface{} `json:"charger_phases"`
-	ChargePortLatch             string      `json:"charge_port_latch"`
-	ChargeCurrentRequest        int         `json:"charge_current_request"`
-	ChargeCurrentRequestMax     int         `json:"charge_current_request_max"`
-	ManagedChargingActive       bool        `json:"managed_charging_active"`
-	ManagedChargingUserCanceled bool        `json:"managed_charging_user_canceled"`
-	ManagedChargingStartTime    interface{} `json:"managed_charging_start_time"`
-	ChargePortcoldWeatherMode   bool        `json:"charge_port_cold_weather_mode"`
-	ConnChargeCable             string      `json:"conn_charge_cable"`
-	FastChargerBrand            string      `json:"fast_charger_brand"`
-	MinutesToFullCharge         int         `json:"minutes_to_full_charge"`
+	RawJSON
+
+	ChargingState               ChargingState   `json:"charging_state"`
+	ChargeLimitSoc              int             `json:"charge_limit_soc"`
+	ChargeLimitSocStd           int             `json:"charge_limit_soc_std"`
+	ChargeLimitSocMin           int             `json:"charge_limit_soc_min"`
+	ChargeLimitSocMax           int             `json:"charge_limit_soc_max"`
+	ChargeToMaxRange            bool            `json:"charge_to_max_range"`
+	BatteryHeaterOn             bool            `json:"battery_heater_on"`
+	NotEnoughPowerToHeat        bool            `json:"not_enough_power_to_heat"`
+	MaxRangeChargeCounter       int             `json:"max_range_charge_counter"`
+	FastChargerPresent          bool            `json:"fast_charger_present"`
+	FastChargerType             FastChargerType `json:"fast_charger_type"`
+	BatteryRange                float64         `json:"battery_range"`
+	EstBatteryRange             float64         `json:"est_battery_range"`
+	IdealBatteryRange           float64         `json:"ideal_battery_range"`
+	BatteryLevel                int             `json:"battery_level"`
+	UsableBatteryLevel          int             `json:"usable_battery_level"`
+	BatteryCurrent              NullFloat       `json:"battery_current"`
+	ChargeEnergyAdded           float64         `json:"charge_energy_added"`
+	ChargeMilesAddedRated       float64         `json:"charge_miles_added_rated"`
+	ChargeMilesAddedIdeal       float64         `json:"charge_miles_added_ideal"`
+	ChargerVoltage              NullInt         `json:"charger_voltage"`
+	ChargerPilotCurrent         NullInt         `json:"charger_pilot_current"`
+	ChargerActualCurrent        NullInt         `json:"charger_actual_current"`
+	ChargerPower                NullFloat       `json:"charger_power"`
+	TimeToFullCharge            float64         `json:"time_to_full_charge"`
+	TripCharging                interface{}     `json:"trip_charging"`
+	ChargeRate                  float64         `json:"charge_rate"`
+	ChargePortDoorOpen          bool            `json:"charge_port_door_open"`
+	MotorizedChargePort         bool            `json:"motorized_charge_port"`
+	ScheduledChargingStartTime  NullTime        `json:"scheduled_charging_start_time"`
+	ScheduledChargingPending    bool            `json:"scheduled_charging_pending"`
+	UserChargeEnableRequest     interface{}     `json:"user_charge_enable_request"`
+	ChargeEnableRequest         bool            `json:"charge_enable_request"`
+	EuVehicle                   bool            `json:"eu_vehicle"`
+	ChargerPhases               NullInt         `json:"charger_phases"`
+	ChargePortLatch             ChargePortLatch `json:"charge_port_latch"`
+	ChargeCurrentRequest        int             `json:"charge_current_request"`
+	ChargeCurrentRequestMax     int             `json:"charge_current_request_max"`
+	ManagedChargingActive       bool            `json:"managed_charging_active"`
+	ManagedChargingUserCanceled bool            `json:"managed_charging_user_canceled"`
+	ManagedChargingStartTime    NullTime        `json:"managed_charging_start_time"`
+	ChargePortcoldWeatherMode   bool            `json:"charge_port_cold_weather_mode"`
+	ConnChargeCable             ChargeCable     `json:"conn_charge_cable"`
+	FastChargerBrand            string          `json:"fast_charger_brand"`
+	MinutesToFullCharge         int             `json:"minutes_to_full_charge"`
 }
 
 // Contains the current climate states availale from the vehicle
 type ClimateState struct {
-	InsideTemp                 float64     `json:"inside_temp"`
-	OutsideTemp                float64     `json:"outside_temp"`
-	DriverTempSetting          float64     `json:"driver_temp_setting"`
-	PassengerTempSetting       float64     `json:"passenger_temp_setting"`
-	LeftTempDirection          float64     `json:"left_temp_direction"`
-	RightTempDirection         float64     `json:"right_temp_direction"`
-	IsAutoConditioningOn       bool        `json:"is_auto_conditioning_on"`
-	IsFrontDefrosterOn         bool        `json:"is_front_defroster_on"`
-	IsRearDefrosterOn          bool        `json:"is_rear_defroster_on"`
-	FanStatus                  interface{} `json:"fan_status"`
-	IsClimateOn                bool        `json:"is_climate_on"`
-	MinAvailTemp               float64     `json:"min_avail_temp"`
-	MaxAvailTemp               float64     `json:"max_avail_temp"`
-	SeatHeaterLeft             int         `json:"seat_heater_left"`
-	SeatHeaterRight            int         `json:"seat_heater_right"`
-	SeatHeaterRearLeft         int         `json:"seat_heater_rear_left"`
-	SeatHeaterRearRight        int         `json:"seat_heater_rear_right"`
-	SeatHeaterRearCenter       int         `json:"seat_heater_rear_center"`
-	SeatHeaterRearRightBack    int         `json:"seat_heater_rear_right_back"`
-	SeatHeaterRearLeftBack     int         `json:"seat_heater_rear_left_back"`
-	SmartPreconditioning       bool        `json:"smart_preconditioning"`
-	BatteryHeater              bool        `json:"battery_heater"`
-	BatteryHeaterNoPower       interface{} `json:"battery_heater_no_power"`
-	ClimateKeeperMode          string      `json:"climate_keeper_mode"`
-	DefrostMode                int         `json:"defrost_mode"`
-	IsPreconditioning          bool        `json:"is_preconditioning"`
-	RemoteHeaterControlEnabled bool        `json:"remote_heater_control_enabled"`
-	SideMirrorHeaters          bool        `json:"side_mirror_heaters"`
-	WiperBladeHeater           bool        `json:"wiper_blade_heater"`
+	RawJSON
+
+	InsideTemp                 float64           `json:"inside_temp"`
+	OutsideTemp                float64           `json:"outside_temp"`
+	DriverTempSetting          float64           `json:"driver_temp_setting"`
+	PassengerTempSetting       float64           `json:"passenger_temp_setting"`
+	LeftTempDirection          float64           `json:"left_temp_direction"`
+	RightTempDirection         float64           `json:"right_temp_direction"`
+	IsAutoConditioningOn       bool              `json:"is_auto_conditioning_on"`
+	IsFrontDefrosterOn         bool              `json:"is_front_defroster_on"`
+	IsRearDefrosterOn          bool              `json:"is_rear_defroster_on"`
+	FanStatus                  NullInt           `json:"fan_status"`
+	IsClimateOn                bool              `json:"is_climate_on"`
+	MinAvailTemp               float64           `json:"min_avail_temp"`
+	MaxAvailTemp               float64           `json:"max_avail_temp"`
+	SeatHeaterLeft             int               `json:"seat_heater_left"`
+	SeatHeaterRight            int               `json:"seat_heater_right"`
+	SeatHeaterRearLeft         int               `json:"seat_heater_rear_left"`
+	SeatHeaterRearRight        int               `json:"seat_heater_rear_right"`
+	SeatHeaterRearCenter       int               `json:"seat_heater_rear_center"`
+	SeatHeaterRearRightBack    int               `json:"seat_heater_rear_right_back"`
+	SeatHeaterRearLeftBack     int               `json:"seat_heater_rear_left_back"`
+	SmartPreconditioning       bool              `json:"smart_preconditioning"`
+	BatteryHeater              bool              `json:"battery_heater"`
+	BatteryHeaterNoPower       NullBool          `json:"battery_heater_no_power"`
+	ClimateKeeperMode          ClimateKeeperMode `json:"climate_keeper_mode"`
+	DefrostMode                int               `json:"defrost_mode"`
+	IsPreconditioning          bool              `json:"is_preconditioning"`
+	RemoteHeaterControlEnabled bool              `json:"remote_heater_control_enabled"`
+	SideMirrorHeaters          bool              `json:"side_mirror_heaters"`
+	WiperBladeHeater           bool              `json:"wiper_blade_heater"`
 }
 
 // Contains the current drive state of the vehicle
 type DriveState struct {
-	ShiftState              interface{} `json:"shift_state"`
-	Speed                   float64     `json:"speed"`
-	Latitude                float64     `json:"latitude"`
-	Longitude               float64     `json:"longitude"`
-	Heading                 int         `json:"heading"`
-	GpsAsOf                 int64       `json:"gps_as_of"`
-	NativeLatitude          float64     `json:"native_latitude"`
-	NativeLocationSupported int         `json:"native_location_supported"`
-	NativeLongitude         float64     `json:"native_longitude"`
-	NativeType              string      `json:"native_type"`
-	Power                   int         `json:"power"`
+	RawJSON
+
+	ShiftState              ShiftState `json:"shift_state"`
+	Speed                   float64    `json:"speed"`
+	Latitude                float64    `json:"latitude"`
+	Longitude               float64    `json:"longitude"`
+	Heading                 int        `json:"heading"`
+	GpsAsOf                 int64      `json:"gps_as_of"`
+	NativeLatitude          float64    `json:"native_latitude"`
+	NativeLocationSupported int        `json:"native_location_supported"`
+	NativeLongitude         float64    `json:"native_longitude"`
+	NativeType              string     `json:"native_type"`
+	Power                   int        `json:"power"`
 }
 
 // Contains the current GUI settings of the vehicle
 type GuiSettings struct {
+	RawJSON
+
 	GuiDistanceUnits    string `json:"gui_distance_units"`
 	GuiTemperatureUnits string `json:"gui_temperature_units"`
 	GuiChargeRateUnits  string `json:"gui_charge_rate_units"`
@@ -116,67 +126,72 @@ type GuiSettings struct {
 
 // Contains the current state of the vehicle
 type VehicleState struct {
-	APIVersion              int     `json:"api_version"`
-	AutoParkState           string  `json:"autopark_state"`
-	AutoParkStateV2         string  `json:"autopark_state_v2"`
-	CalendarSupported       bool    `json:"calendar_supported"`
-	CarType                 string  `json:"car_type"`
-	CarVersion              string  `json:"car_version"`
-	CenterDisplayState      int     `json:"center_display_state"`
-	DarkRims                bool    `json:"dark_rims"`
-	Df                      int     `json:"df"`
-	Dr                      int     `json:"dr"`
-	ExteriorColor           string  `json:"exterior_color"`
-	Ft                      int     `json:"ft"`
-	HasSpoiler              bool    `json:"has_spoiler"`
-	Locked                  bool    `json:"locked"`
-	NotificationsSupported  bool    `json:"notifications_supported"`
-	Odometer                float64 `json:"odometer"`
-	ParsedCalendarSupported bool    `json:"parsed_calendar_supported"`
-	PerfConfig              string  `json:"perf_config"`
-	Pf                      int     `json:"pf"`
-	Pr                      int     `json:"pr"`
-	RearSeatHeaters         int     `json:"rear_seat_heaters"`
-	RemoteStart             bool    `json:"remote_start"`
-	RemoteStartSupported    bool    `json:"remote_start_supported"`
-	Rhd                     bool    `json:"rhd"`
-	RoofColor               string  `json:"roof_color"`
-	Rt                      int     `json:"rt"`
-	SentryMode              bool    `json:"sentry_mode"`
-	SentryModeAvailable     bool    `json:"sentry_mode_available"`
-	SeatType                int     `json:"seat_type"`
-	SpoilerType             string  `json:"spoiler_type"`
-	SunRoofInstalled        int     `json:"sun_roof_installed"`
-	SunRoofPercentOpen      int     `json:"sun_roof_percent_open"`
-	SunRoofState            string  `json:"sun_roof_state"`
-	ThirdRowSeats           string  `json:"third_row_seats"`
-	ValetMode               bool    `json:"valet_mode"`
-	VehicleName             string  `json:"vehicle_name"`
-	WheelType               string  `json:"wheel_type"`
-	FdWindow                int     `json:"fd_window"`
-	FpWindow                int     `json:"fp_window"`
-	RdWindow                int     `json:"rd_window"`
-	RpWindow                int     `json:"rp_window"`
-	IsUserPresent           bool    `json:"is_user_present"`
-	RemoteStartEnabled      bool    `json:"remote_start_enabled"`
-	ValetPinNeeded          bool    `json:"valet_pin_needed"`
+	RawJSON
+
+	APIVersion              int          `json:"api_version"`
+	AutoParkState           string       `json:"autopark_state"`
+	AutoParkStateV2         string       `json:"autopark_state_v2"`
+	CalendarSupported       bool         `json:"calendar_supported"`
+	CarType                 string       `json:"car_type"`
+	CarVersion              string       `json:"car_version"`
+	CenterDisplayState      int          `json:"center_display_state"`
+	DarkRims                bool         `json:"dark_rims"`
+	Df                      int          `json:"df"`
+	Dr                      int          `json:"dr"`
+	ExteriorColor           string       `json:"exterior_color"`
+	Ft                      int          `json:"ft"`
+	HasSpoiler              bool         `json:"has_spoiler"`
+	Locked                  bool         `json:"locked"`
+	NotificationsSupported  bool         `json:"notifications_supported"`
+	Odometer                float64      `json:"odometer"`
+	ParsedCalendarSupported bool         `json:"parsed_calendar_supported"`
+	PerfConfig              string       `json:"perf_config"`
+	Pf                      int          `json:"pf"`
+	Pr                      int          `json:"pr"`
+	RearSeatHeaters         int          `json:"rear_seat_heaters"`
+	RemoteStart             bool         `json:"remote_start"`
+	RemoteStartSupported    bool         `json:"remote_start_supported"`
+	Rhd                     bool         `json:"rhd"`
+	RoofColor               string       `json:"roof_color"`
+	Rt                      int          `json:"rt"`
+	SentryMode              bool         `json:"sentry_mode"`
+	SentryModeAvailable     bool         `json:"sentry_mode_available"`
+	SeatType                int          `json:"seat_type"`
+	SpoilerType             string       `json:"spoiler_type"`
+	SunRoofInstalled        int          `json:"sun_roof_installed"`
+	SunRoofPercentOpen      int          `json:"sun_roof_percent_open"`
+	SunRoofState            SunRoofState `json:"sun_roof_state"`
+	ThirdRowSeats           string       `json:"third_row_seats"`
+	ValetMode               bool         `json:"valet_mode"`
+	VehicleName             string       `json:"vehicle_name"`
+	WheelType               string       `json:"wheel_type"`
+	FdWindow                int          `json:"fd_window"`
+	FpWindow                int          `json:"fp_window"`
+	RdWindow                int          `json:"rd_window"`
+	RpWindow                int          `json:"rp_window"`
+	IsUserPresent           bool         `json:"is_user_present"`
+	RemoteStartEnabled      bool         `json:"remote_start_enabled"`
+	ValetPinNeeded          bool         `json:"valet_pin_needed"`
 	MediaState              struct {
 		RemoteControlEnabled bool `json:"remote_control_enabled"`
 	} `json:"media_state"`
 	SoftwareUpdate struct {
-		DownloadPerc        int    `json:"download_perc"`
-		ExpectedDurationSec int    `json:"expected_duration_sec"`
-		InstallPerc         int    `json:"install_perc"`
-		Status              string `json:"status"`
-		Version             string `json:"version"`
+		DownloadPerc        int                  `json:"download_perc"`
+		ExpectedDurationSec int                  `json:"expected_duration_sec"`
+		InstallPerc         int                  `json:"install_perc"`
+		Status              SoftwareUpdateStatus `json:"status"`
+		Version             string               `json:"version"`
 	} `json:"software_update" `
-	SpeedLimitMode struct {
-		Active          bool    `json:"active"`
-		CurrentLimitMph float64 `json:"current_limit_mph"`
-		MaxLimitMph     int     `json:"max_limit_mph"`
-		MinLimitMph     int     `json:"min_limit_mph"`
-		PinCodeSet      bool    `json:"pin_code_set"`
-	} `json:"speed_limit_mode"`
+	SpeedLimitMode SpeedLimitMode `json:"speed_limit_mode"`
+}
+
+// Contains the speed limit of the vehicle
+type SpeedLimitMode struct {
+	Active          bool    `json:"active"`
+	CurrentLimitMph float64 `json:"current_limit_mph"`
+	MaxLimitMph     int     `json:"max_limit_mph"`
+	MinLimitMph     int     `json:"min_limit_mph"`
+	PinCodeSet      bool    `json:"pin_code_set"`
 }
 
 type ServiceData struct {
@@ -206,8 +221,13 @@ type MobileEnabledResponse struct {
 
 // MobileEnabled returns if the vehicle is mobile enabled for Tesla API control
 func (v *Vehicle) MobileEnabled() (bool, error) {
+	return v.MobileEnabledContext(context.Background())
+}
+
+// MobileEnabledContext is like MobileEnabled but uses ctx for the requests to the API
+func (v *Vehicle) MobileEnabledContext(ctx context.Context) (bool, error) {
 	r := &MobileEnabledResponse{}
-	if err := v.c.getJSON(v.c.BaseURL+"/vehicles/"+strconv.FormatInt(v.ID, 10)+"/mobile_enabled", r); err != nil {
+	if err := v.c.getJSON(ctx, v.c.baseURL()+"/vehicles/"+strconv.FormatInt(v.ID, 10)+"/mobile_enabled", r); err != nil {
 		return false, err
 	}
 	return r.Bool, nil
@@ -268,8 +288,13 @@ type NearbyChargingSitesResponse struct {
 }
 
 func (v *Vehicle) NearbyChargingSites() (*NearbyChargingSitesResponse, error) {
+	return v.NearbyChargingSitesContext(context.Background())
+}
+
+// NearbyChargingSitesContext is like NearbyChargingSites but uses ctx for the requests to the API
+func (v *Vehicle) NearbyChargingSitesContext(ctx context.Context) (*NearbyChargingSitesResponse, error) {
 	resp := &NearbyChargingSitesResponse{}
-	if err := v.c.getJSON(v.c.BaseURL+"/vehicles/"+strconv.FormatInt(v.ID, 10)+"/nearby_charging_sites", resp); err != nil {
+	if err := v.c.getJSON(ctx, v.c.baseURL()+"/vehicles/"+strconv.FormatInt(v.ID, 10)+"/nearby_charging_sites", resp); err != nil {
 		return nil, err
 	}
 	return resp, nil
@@ -277,7 +302,12 @@ func (v *Vehicle) NearbyChargingSites() (*NearbyChargingSitesResponse, error) {
 
 // ChargeState returns the charge state of the vehicle
 func (v *Vehicle) ChargeState() (*ChargeState, error) {
-	stateRequest, err := v.c.fetchState("/charge_state", v.ID)
+	return v.ChargeStateContext(context.Background())
+}
+
+// ChargeStateContext is like ChargeState but uses ctx for the requests to the API
+func (v *Vehicle) ChargeStateContext(ctx context.Context) (*ChargeState, error) {
+	stateRequest, err := v.fetchState(ctx, "/charge_state")
 	if err != nil {
 		return nil, err
 	}
@@ -286,7 +316,12 @@ func (v *Vehicle) ChargeState() (*ChargeState, error) {
 
 // ClimateState returns the climate state of the vehicle
 func (v Vehicle) ClimateState() (*ClimateState, error) {
-	stateRequest, err := v.c.fetchState("/climate_state", v.ID)
+	return v.ClimateStateContext(context.Background())
+}
+
+// ClimateStateContext is like ClimateState but uses ctx for the requests to the API
+func (v Vehicle) ClimateStateContext(ctx context.Context) (*ClimateState, error) {
+	stateRequest, err := v.fetchState(ctx, "/climate_state")
 	if err != nil {
 		return nil, err
 	}
@@ -294,7 +329,12 @@ func (v Vehicle) ClimateState() (*ClimateState, error) {
 }
 
 func (v Vehicle) DriveState() (*DriveState, error) {
-	stateRequest, err := v.c.fetchState("/drive_state", v.ID)
+	return v.DriveStateContext(context.Background())
+}
+
+// DriveStateContext is like DriveState but uses ctx for the requests to the API
+func (v Vehicle) DriveStateContext(ctx context.Context) (*DriveState, error) {
+	stateRequest, err := v.fetchState(ctx, "/drive_state")
 	if err != nil {
 		return nil, err
 	}
@@ -303,7 +343,12 @@ func (v Vehicle) DriveState() (*DriveState, error) {
 
 // GuiSettings returns the GUI settings of the vehicle
 func (v Vehicle) GuiSettings() (*GuiSettings, error) {
-	stateRequest, err := v.c.fetchState("/gui_settings", v.ID)
+	return v.GuiSettingsContext(context.Background())
+}
+
+// GuiSettingsContext is like GuiSettings but uses ctx for the requests to the API
+func (v Vehicle) GuiSettingsContext(ctx context.Context) (*GuiSettings, error) {
+	stateRequest, err := v.fetchState(ctx, "/gui_settings")
 	if err != nil {
 		return nil, err
 	}
@@ -311,7 +356,12 @@ func (v Vehicle) GuiSettings() (*GuiSettings, error) {
 }
 
 func (v Vehicle) VehicleState() (*VehicleState, error) {
-	stateRequest, err := v.c.fetchState("/vehicle_state", v.ID)
+	return v.VehicleStateContext(context.Background())
+}
+
+// VehicleStateContext is like VehicleState but uses ctx for the requests to the API
+func (v Vehicle) VehicleStateContext(ctx context.Context) (*VehicleState, error) {
+	stateRequest, err := v.fetchState(ctx, "/vehicle_state")
 	if err != nil {
 		return nil, err
 	}
@@ -319,7 +369,12 @@ func (v Vehicle) VehicleState() (*VehicleState, error) {
 }
 
 func (v Vehicle) ServiceData() (*ServiceData, error) {
-	stateRequest, err := v.c.fetchState("/service_data", v.ID)
+	return v.ServiceDataContext(context.Background())
+}
+
+// ServiceDataContext is like ServiceData but uses ctx for the requests to the API
+func (v Vehicle) ServiceDataContext(ctx context.Context) (*ServiceData, error) {
+	stateRequest, err := v.fetchState(ctx, "/service_data")
 	if err != nil {
 		return nil, err
 	}
@@ -337,10 +392,30 @@ func stateError(sr *StateRequest) error {
 	return fmt.Errorf("%s", sr.Error)
 }
 
+// Fetches a state of the vehicle, waking it first if it is asleep and the
+// wake policy allows it
+func (v *Vehicle) fetchState(ctx context.Context, resource string) (*StateRequest, error) {
+	var stateRequest *StateRequest
+	err := v.withWake(ctx, strings.TrimPrefix(resource, "/"), func() (err error) {
+		stateRequest, err = v.c.fetchState(ctx, resource, v.ID)
+		return err
+	})
+	return stateRequest, err
+}
+
 // A utility function to fetch the appropriate state of the vehicle
-func (c *Client) fetchState(resource string, id int64) (*StateRequest, error) {
-	stateRequest := &StateRequest{}
-	if err := c.getJSON(c.BaseURL+"/vehicles/"+strconv.FormatInt(id, 10)+"/data_request"+resource, stateRequest); err != nil {
+func (c *Client) fetchState(ctx context.Context, resource string, id int64) (*StateRequest, error) {
+	if err := c.rateLimit(ctx, id, stateRead); err != nil {
+		return nil, err
+	}
+	var stateRequest *StateRequest
+	var err error
+	if c.API == FleetAPI {
+		stateRequest, err = c.fetchFleetState(ctx, resource, id)
+	} else {
+		stateRequest, err = c.fetchOwnerState(ctx, resource, id)
+	}
+	if err != nil {
 		return nil, err
 	}
 	if err := stateError(stateRequest); err != nil {
@@ -349,59 +424,57 @@ func (c *Client) fetchState(resource string, id int64) (*StateRequest, error) {
 	return stateRequest, nil
 }
 
-// Data : Get data of the vehicle (calling this will not permit the car to sleep)
-func (v Vehicle) Data(vid int64) (*StateRequest, error) {
-	log.Println("Retreiving vehicle data")
-	stateRequest := &StateRequest{}
-
-	/*log.Println(v.c.URL + "/vehicles/" + strconv.FormatInt(vid, 10) + "/vehicle_data")
-	body, err := v.c.get(v.c.URL + "/vehicles/" + strconv.FormatInt(vid, 10) + "/vehicle_data")
+// Fetches a state from the data_request endpoint of the owner API
+func (c *Client) fetchOwnerState(ctx context.Context, resource string, id int64) (*StateRequest, error) {
+	body, err := c.get(ctx, c.baseURL()+"/vehicles/"+strconv.FormatInt(id, 10)+"/data_request"+resource)
 	if err != nil {
 		return nil, err
 	}
+	stateRequest := &StateRequest{}
 	if err := json.Unmarshal(body, stateRequest); err != nil {
 		return nil, err
-	}*/
-
-	// climate_state
-	stateRequestClimate, err := v.c.fetchState("/climate_state", v.ID)
-	if err != nil {
-		log.Println("Error getting climate_state")
-		return nil, err
 	}
-	stateRequest.Response.ClimateState = stateRequestClimate.Response.ClimateState
-
-	// drive_state
-	stateRequestGui, err := v.c.fetchState("/drive_state", v.ID)
-	if err != nil {
-		log.Println("Error getting drive_state")
+	raw := &struct {
+		Response json.RawMessage `json:"response"`
+	}{}
+	if err := json.Unmarshal(body, raw); err != nil {
 		return nil, err
 	}
-	stateRequest.Response.DriveState = stateRequestGui.Response.DriveState
-
-	// gui_settings
-	stateRequestSettings, err := v.c.fetchState("/gui_settings", v.ID)
-	if err != nil {
-		log.Println("Error getting gui_settings")
+	if err := stateRequest.decodeState(resource, raw.Response); err != nil {
 		return nil, err
 	}
-	stateRequest.Response.GuiSettings = stateRequestSettings.Response.GuiSettings
+	return stateRequest, nil
+}
 
-	// vehicle_state
-	stateRequestVehicle, err := v.c.fetchState("/vehicle_state", v.ID)
+// Data : Get data of the vehicle (calling this will not permit the car to sleep).
+// The service data is read on a best-effort basis and is nil if it cannot be read.
+//
+// Deprecated: The vid is ignored. Use VehicleData, which selects the states returned.
+func (v Vehicle) Data(vid int64) (*StateRequest, error) {
+	return v.DataContext(context.Background(), vid)
+}
+
+// DataContext is like Data but uses ctx for the requests to the API
+//
+// Deprecated: The vid is ignored. Use VehicleDataContext, which selects the states returned.
+func (v Vehicle) DataContext(ctx context.Context, vid int64) (*StateRequest, error) {
+	v.c.logf("Retrieving vehicle data")
+	data, err := v.VehicleDataContext(ctx, nil)
 	if err != nil {
-		log.Println("Error getting vehicle_state")
 		return nil, err
 	}
-	stateRequest.Response.VehicleState = stateRequestVehicle.Response.VehicleState
-
-	// charge_state
-	stateRequestCharge, err := v.c.fetchState("/charge_state", v.ID)
+	stateRequest := &StateRequest{}
+	stateRequest.Response.ChargeState = data.ChargeState
+	stateRequest.Response.ClimateState = data.ClimateState
+	stateRequest.Response.DriveState = data.DriveState
+	stateRequest.Response.GuiSettings = data.GuiSettings
+	stateRequest.Response.VehicleState = data.VehicleState
+	// The vehicle was woken for the vehicle data, so the service data does not wake it
+	service, err := v.c.fetchState(ctx, "/service_data", v.ID)
 	if err != nil {
-		log.Println("Error getting charge_state")
-		return nil, err
+		v.c.logf("reading the service data of vehicle %d: %v", v.ID, err)
+		return stateRequest, nil
 	}
-	stateRequest.Response.ChargeState = stateRequestCharge.Response.ChargeState
-
+	stateRequest.Response.ServiceData = service.Response.ServiceData
 	return stateRequest, nil
 }
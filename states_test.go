@@ -21,8 +21,6 @@ var (
 func TestStatesSpec(t *testing.T) {
 	ts := serveHTTP(t)
 	defer ts.Close()
-	previousAuthURL := AuthURL
-	AuthURL = ts.URL + "/oauth/token"
 
 	auth := &Auth{
 		GrantType:    "password",
@@ -31,8 +29,7 @@ func TestStatesSpec(t *testing.T) {
 		Email:        "elon@tesla.com",
 		Password:     "go",
 	}
-	client, _ := NewClient(auth)
-	client.BaseURL = ts.URL + "/api/1"
+	client, _ := NewClient(auth, testOptions(ts)...)
 
 	Convey("Should get mobile enabled status", t, func() {
 		vehicles, _ := client.Vehicles()
@@ -114,6 +111,4 @@ func TestStatesSpec(t *testing.T) {
 		_, err := vehicle.VehicleState()
 		So(err, ShouldNotBeNil)
 	})
-
-	AuthURL = previousAuthURL
 }
@@ -2,6 +2,7 @@ package tesla
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"net/http"
 	"strconv"
@@ -33,8 +34,17 @@ type StreamEvent struct {
 
 // Requests a stream from the vehicle and returns a Go channel
 func (v Vehicle) Stream() (chan *StreamEvent, chan error, error) {
-	url := v.c.StreamingURL + "/stream/" + strconv.FormatUint(v.VehicleID, 10) + "/?values=" + StreamParams
-	req, _ := http.NewRequest("GET", url, nil)
+	return v.StreamContext(context.Background())
+}
+
+// StreamContext is like Stream but stops reading the stream and closes the
+// connection once ctx is done
+func (v Vehicle) StreamContext(ctx context.Context) (chan *StreamEvent, chan error, error) {
+	if v.c.API == FleetAPI {
+		return nil, nil, ErrUnsupported
+	}
+	url := v.c.streamingURL() + "/stream/" + strconv.FormatUint(v.VehicleID, 10) + "/?values=" + StreamParams
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
 	req.SetBasicAuth(v.c.Auth.Email, v.Tokens[0])
 	resp, err := v.c.HTTP.Do(req)
 
@@ -44,13 +54,13 @@ func (v Vehicle) Stream() (chan *StreamEvent, chan error, error) {
 
 	eventChan := make(chan *StreamEvent)
 	errChan := make(chan error)
-	go readStream(resp, eventChan, errChan)
+	go readStream(ctx, resp, eventChan, errChan)
 
 	return eventChan, errChan, nil
 }
 
 // Reads the stream itself from the vehicle
-func readStream(resp *http.Response, eventChan chan *StreamEvent, errChan chan error) {
+func readStream(ctx context.Context, resp *http.Response, eventChan chan *StreamEvent, errChan chan error) {
 	reader := bufio.NewReader(resp.Body)
 	scanner := bufio.NewScanner(reader)
 	scanner.Split(bufio.ScanLines)
@@ -59,12 +69,23 @@ func readStream(resp *http.Response, eventChan chan *StreamEvent, errChan chan e
 	for scanner.Scan() {
 		streamEvent, err := parseStreamEvent(scanner.Text())
 		if err == nil {
-			eventChan <- streamEvent
+			select {
+			case eventChan <- streamEvent:
+			case <-ctx.Done():
+				return
+			}
 		} else {
-			errChan <- err
+			select {
+			case errChan <- err:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}
-	errChan <- errors.New("HTTP stream closed")
+	select {
+	case errChan <- errors.New("HTTP stream closed"):
+	case <-ctx.Done():
+	}
 }
 
 // Parses the stream event, setting all of the appropriate data types
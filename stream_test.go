@@ -1,6 +1,10 @@
 package tesla
 
 import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -14,8 +18,6 @@ var (
 func TestStreamSpec(t *testing.T) {
 	ts := serveHTTP(t)
 	defer ts.Close()
-	previousAuthURL := AuthURL
-	AuthURL = ts.URL + "/oauth/token"
 
 	auth := &Auth{
 		GrantType:    "password",
@@ -24,9 +26,7 @@ func TestStreamSpec(t *testing.T) {
 		Email:        "elon@tesla.com",
 		Password:     "go",
 	}
-	client, _ := NewClient(auth)
-	client.BaseURL = ts.URL + "/api/1"
-	client.StreamingURL = ts.URL
+	client, _ := NewClient(auth, testOptions(ts)...)
 
 	vehicle := &Vehicle{
 		c:         client,
@@ -66,5 +66,34 @@ func TestStreamSpec(t *testing.T) {
 		})
 	})
 
-	AuthURL = previousAuthURL
+	Convey("Should stop streaming when the context is canceled", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		body := &closeNotifier{Reader: strings.NewReader(StreamEventString + "\n" + StreamEventString + "\n"), closed: make(chan struct{})}
+		eventChan, errChan := make(chan *StreamEvent), make(chan error)
+		go readStream(ctx, &http.Response{Body: body}, eventChan, errChan)
+		event := <-eventChan
+		So(event.Speed, ShouldEqual, 65)
+		cancel()
+		// The body is closed once the reader returned, without delivering
+		// the second event
+		<-body.closed
+		select {
+		case <-eventChan:
+			So("received event after cancel", ShouldBeEmpty)
+		case err := <-errChan:
+			So(err, ShouldBeNil)
+		default:
+		}
+	})
+}
+
+// A response body signaling that it was closed
+type closeNotifier struct {
+	io.Reader
+	closed chan struct{}
+}
+
+func (c *closeNotifier) Close() error {
+	close(c.closed)
+	return nil
 }
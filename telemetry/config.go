@@ -0,0 +1,59 @@
+package telemetry
+
+import (
+	"context"
+	"time"
+
+	"github.com/bogosj/tesla"
+)
+
+// Config tells vehicles where to stream their records and which fields to
+// include how often
+type Config struct {
+	// Hostname is the host of the Receiver
+	Hostname string
+	// Port is the port of the Receiver, 443 if 0
+	Port int
+	// CA is the PEM encoded chain the certificate of the Receiver is verified with
+	CA []byte
+	// Expires is the time vehicles stop streaming, never if zero
+	Expires time.Time
+	// Fields maps the fields to stream to their interval
+	Fields map[Field]time.Duration
+	// Alerts are the audiences of the alerts to stream
+	Alerts []Audience
+}
+
+// Build returns the configuration in the form of the Fleet API. Intervals
+// are rounded up to whole seconds.
+func (c *Config) Build() *tesla.FleetTelemetryConfig {
+	config := &tesla.FleetTelemetryConfig{
+		Hostname: c.Hostname,
+		CA:       string(c.CA),
+		Port:     c.Port,
+		Fields:   map[string]tesla.FleetTelemetryField{},
+	}
+	if config.Port == 0 {
+		config.Port = 443
+	}
+	if !c.Expires.IsZero() {
+		config.Expires = c.Expires.Unix()
+	}
+	for f, interval := range c.Fields {
+		seconds := int((interval + time.Second - 1) / time.Second)
+		if seconds < 1 {
+			seconds = 1
+		}
+		config.Fields[f.String()] = tesla.FleetTelemetryField{IntervalSeconds: seconds}
+	}
+	for _, a := range c.Alerts {
+		config.AlertTypes = append(config.AlertTypes, a.String())
+	}
+	return config
+}
+
+// Push sends the configuration to the vehicles with the VINs through a
+// client of the Fleet API
+func (c *Config) Push(ctx context.Context, client *tesla.Client, vins ...string) (*tesla.FleetTelemetryResult, error) {
+	return client.ConfigureFleetTelemetryContext(ctx, c.Build(), vins...)
+}
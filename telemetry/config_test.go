@@ -0,0 +1,33 @@
+package telemetry
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConfigSpec(t *testing.T) {
+	Convey("Should build the configuration of the Fleet API", t, func() {
+		config := &Config{
+			Hostname: "telemetry.example.com",
+			CA:       []byte("-----BEGIN CERTIFICATE-----"),
+			Expires:  time.Unix(1700000000, 0),
+			Fields: map[Field]time.Duration{
+				FieldBatteryLevel: time.Minute,
+				FieldLocation:     1500 * time.Millisecond,
+				FieldGear:         0,
+			},
+			Alerts: []Audience{AudienceService},
+		}
+		built := config.Build()
+		So(built.Hostname, ShouldEqual, "telemetry.example.com")
+		So(built.CA, ShouldEqual, "-----BEGIN CERTIFICATE-----")
+		So(built.Port, ShouldEqual, 443)
+		So(built.Expires, ShouldEqual, 1700000000)
+		So(built.Fields["BatteryLevel"].IntervalSeconds, ShouldEqual, 60)
+		So(built.Fields["Location"].IntervalSeconds, ShouldEqual, 2)
+		So(built.Fields["Gear"].IntervalSeconds, ShouldEqual, 1)
+		So(built.AlertTypes, ShouldResemble, []string{"service"})
+	})
+}
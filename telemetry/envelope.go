@@ -0,0 +1,161 @@
+package telemetry
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Vehicles wrap each record in a flatbuffers envelope:
+//
+//	table FlatbuffersEnvelope {
+//	  txid: [ubyte];
+//	  topic: [ubyte];
+//	  messageType: Message;  // union, type in slot 2, value in slot 3
+//	  messageId: [ubyte];
+//	}
+//	union Message { FlatbuffersStream }
+//	table FlatbuffersStream {
+//	  createdAt: uint32;
+//	  senderId: [ubyte];
+//	  payload: [ubyte];
+//	  deviceType: [ubyte];
+//	  deviceId: [ubyte];
+//	  deliveredAtEpochMs: uint64;
+//	}
+//
+// The payload is the protobuf encoded record of the topic.
+
+// The union type of a FlatbuffersStream message
+const messageTypeStream = 1
+
+var errEnvelope = errors.New("telemetry: malformed envelope")
+
+// A record as received from a vehicle
+type envelope struct {
+	txid      []byte
+	topic     string
+	messageID []byte
+	createdAt uint32
+	senderID  string
+	deviceID  string
+	payload   []byte
+}
+
+// A table of a flatbuffers buffer, giving access to its fields by slot
+type fbTable struct {
+	buf []byte
+	pos int
+}
+
+// Returns the little endian uint32 at off
+func fbUint32(buf []byte, off int) (uint32, bool) {
+	if off < 0 || off+4 > len(buf) {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(buf[off:]), true
+}
+
+// Returns the root table of a buffer
+func fbRoot(buf []byte) (fbTable, error) {
+	off, ok := fbUint32(buf, 0)
+	if !ok {
+		return fbTable{}, errEnvelope
+	}
+	return fbTable{buf, int(off)}, nil
+}
+
+// Returns the position of a field in the buffer, or false if it is absent
+func (t fbTable) field(slot int) (int, bool) {
+	soff, ok := fbUint32(t.buf, t.pos)
+	if !ok {
+		return 0, false
+	}
+	vtable := t.pos - int(int32(soff))
+	if vtable < 0 || vtable+4 > len(t.buf) {
+		return 0, false
+	}
+	size := int(binary.LittleEndian.Uint16(t.buf[vtable:]))
+	entry := vtable + 4 + 2*slot
+	if 4+2*slot+2 > size || entry+2 > len(t.buf) {
+		return 0, false
+	}
+	off := int(binary.LittleEndian.Uint16(t.buf[entry:]))
+	if off == 0 {
+		return 0, false
+	}
+	return t.pos + off, true
+}
+
+// Returns the byte vector of a field, or nil
+func (t fbTable) bytes(slot int) []byte {
+	pos, ok := t.field(slot)
+	if !ok {
+		return nil
+	}
+	off, ok := fbUint32(t.buf, pos)
+	if !ok {
+		return nil
+	}
+	start := pos + int(off)
+	l, ok := fbUint32(t.buf, start)
+	if !ok || uint64(start)+4+uint64(l) > uint64(len(t.buf)) {
+		return nil
+	}
+	return t.buf[start+4 : start+4+int(l)]
+}
+
+// Returns the table referenced by a field
+func (t fbTable) table(slot int) (fbTable, bool) {
+	pos, ok := t.field(slot)
+	if !ok {
+		return fbTable{}, false
+	}
+	off, ok := fbUint32(t.buf, pos)
+	if !ok {
+		return fbTable{}, false
+	}
+	return fbTable{t.buf, pos + int(off)}, true
+}
+
+// Returns a uint8 field, or 0
+func (t fbTable) uint8(slot int) uint8 {
+	pos, ok := t.field(slot)
+	if !ok || pos >= len(t.buf) {
+		return 0
+	}
+	return t.buf[pos]
+}
+
+// Returns a uint32 field, or 0
+func (t fbTable) uint32(slot int) uint32 {
+	pos, ok := t.field(slot)
+	if !ok {
+		return 0
+	}
+	v, _ := fbUint32(t.buf, pos)
+	return v
+}
+
+// Decodes the envelope of a record
+func decodeEnvelope(buf []byte) (*envelope, error) {
+	root, err := fbRoot(buf)
+	if err != nil {
+		return nil, err
+	}
+	if root.uint8(2) != messageTypeStream {
+		return nil, errEnvelope
+	}
+	stream, ok := root.table(3)
+	if !ok {
+		return nil, errEnvelope
+	}
+	return &envelope{
+		txid:      root.bytes(0),
+		topic:     string(root.bytes(1)),
+		messageID: root.bytes(4),
+		createdAt: stream.uint32(0),
+		senderID:  string(stream.bytes(1)),
+		payload:   stream.bytes(2),
+		deviceID:  string(stream.bytes(4)),
+	}, nil
+}
@@ -0,0 +1,105 @@
+package telemetry
+
+import (
+	"encoding/binary"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// A field of a flatbuffers table built by fbTableBlob: inline scalar bytes,
+// a reference to an object at pos of blob, or absent if both are nil
+type fbField struct {
+	inline []byte
+	blob   []byte
+	pos    int
+}
+
+func fbVector(b []byte) fbField {
+	blob := make([]byte, 4, 4+len(b))
+	binary.LittleEndian.PutUint32(blob, uint32(len(b)))
+	return fbField{blob: append(blob, b...)}
+}
+
+func fbUint32Field(v uint32) fbField {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return fbField{inline: b}
+}
+
+// Builds a table preceded by its vtable and followed by the objects it
+// references, returning the blob and the position of the table in it. All
+// offsets are relative, so the blob can be placed anywhere in a buffer.
+func fbTableBlob(fields ...fbField) ([]byte, int) {
+	vtable := make([]byte, 4+2*len(fields))
+	table := make([]byte, 4)
+	var children []byte
+	type ref struct{ at, target int }
+	var refs []ref
+	for i, f := range fields {
+		switch {
+		case f.inline != nil:
+			binary.LittleEndian.PutUint16(vtable[4+2*i:], uint16(len(table)))
+			table = append(table, f.inline...)
+		case f.blob != nil:
+			binary.LittleEndian.PutUint16(vtable[4+2*i:], uint16(len(table)))
+			refs = append(refs, ref{len(table), len(children) + f.pos})
+			table = append(table, 0, 0, 0, 0)
+			children = append(children, f.blob...)
+		}
+	}
+	binary.LittleEndian.PutUint16(vtable, uint16(len(vtable)))
+	binary.LittleEndian.PutUint16(vtable[2:], uint16(len(table)))
+	start := len(vtable)
+	binary.LittleEndian.PutUint32(table, uint32(start))
+	for _, r := range refs {
+		binary.LittleEndian.PutUint32(table[r.at:], uint32(len(table)-r.at+r.target))
+	}
+	blob := append(append(vtable, table...), children...)
+	return blob, start
+}
+
+// Wraps a record in the envelope sent by vehicles
+func testEnvelope(topic, vin string, payload []byte) []byte {
+	stream, streamPos := fbTableBlob(
+		fbUint32Field(1700000000),
+		fbVector([]byte("vehicle_device."+vin)),
+		fbVector(payload),
+		fbVector([]byte("vehicle_device")),
+		fbVector([]byte(vin)),
+	)
+	env, envPos := fbTableBlob(
+		fbVector([]byte("tx1")),
+		fbVector([]byte(topic)),
+		fbField{inline: []byte{messageTypeStream}},
+		fbField{blob: stream, pos: streamPos},
+		fbVector([]byte("msg1")),
+	)
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, uint32(4+envPos))
+	return append(buf, env...)
+}
+
+func TestEnvelopeSpec(t *testing.T) {
+	Convey("Should decode the envelope of a record", t, func() {
+		env, err := decodeEnvelope(testEnvelope("V", "abc123", []byte{1, 2, 3}))
+		So(err, ShouldBeNil)
+		So(env.topic, ShouldEqual, "V")
+		So(string(env.txid), ShouldEqual, "tx1")
+		So(string(env.messageID), ShouldEqual, "msg1")
+		So(env.createdAt, ShouldEqual, 1700000000)
+		So(env.senderID, ShouldEqual, "vehicle_device.abc123")
+		So(env.deviceID, ShouldEqual, "abc123")
+		So(env.payload, ShouldResemble, []byte{1, 2, 3})
+	})
+
+	Convey("Should reject malformed envelopes", t, func() {
+		_, err := decodeEnvelope([]byte{1, 2})
+		So(err, ShouldNotBeNil)
+		buf := testEnvelope("V", "abc123", nil)
+		for _, n := range []int{4, 8, 16} {
+			_, err = decodeEnvelope(buf[:n])
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package telemetry
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Field identifies a vehicle signal streamed by Fleet Telemetry
+type Field int
+
+// Fields of the vehicle data, numbered as in the Fleet Telemetry protocol
+const (
+	FieldUnknown                    Field = 0
+	FieldDriveState                 Field = 1
+	FieldChargeState                Field = 2
+	FieldBmsFullchargecomplete      Field = 3
+	FieldVehicleSpeed               Field = 4
+	FieldOdometer                   Field = 5
+	FieldPackVoltage                Field = 6
+	FieldPackCurrent                Field = 7
+	FieldSoc                        Field = 8
+	FieldDCDCEnable                 Field = 9
+	FieldGear                       Field = 10
+	FieldIsolationResistance        Field = 11
+	FieldPedalPosition              Field = 12
+	FieldBrakePedal                 Field = 13
+	FieldDiStateR                   Field = 14
+	FieldDiHeatsinkTR               Field = 15
+	FieldDiAxleSpeedR               Field = 16
+	FieldDiTorquemotor              Field = 17
+	FieldDiStatorTempR              Field = 18
+	FieldDiVBatR                    Field = 19
+	FieldDiMotorCurrentR            Field = 20
+	FieldLocation                   Field = 21
+	FieldGpsState                   Field = 22
+	FieldGpsHeading                 Field = 23
+	FieldNumBrickVoltageMax         Field = 24
+	FieldBrickVoltageMax            Field = 25
+	FieldNumBrickVoltageMin         Field = 26
+	FieldBrickVoltageMin            Field = 27
+	FieldNumModuleTempMax           Field = 28
+	FieldModuleTempMax              Field = 29
+	FieldNumModuleTempMin           Field = 30
+	FieldModuleTempMin              Field = 31
+	FieldRatedRange                 Field = 32
+	FieldHvil                       Field = 33
+	FieldDCChargingEnergyIn         Field = 34
+	FieldDCChargingPower            Field = 35
+	FieldACChargingEnergyIn         Field = 36
+	FieldACChargingPower            Field = 37
+	FieldChargeLimitSoc             Field = 38
+	FieldFastChargerPresent         Field = 39
+	FieldEstBatteryRange            Field = 40
+	FieldIdealBatteryRange          Field = 41
+	FieldBatteryLevel               Field = 42
+	FieldTimeToFullCharge           Field = 43
+	FieldScheduledChargingStartTime Field = 44
+	FieldScheduledChargingPending   Field = 45
+	FieldScheduledDepartureTime     Field = 46
+	FieldPreconditioningEnabled     Field = 47
+	FieldScheduledChargingMode      Field = 48
+	FieldChargeAmps                 Field = 49
+	FieldChargeEnableRequest        Field = 50
+	FieldChargerPhases              Field = 51
+	FieldChargePortColdWeatherMode  Field = 52
+	FieldChargeCurrentRequest       Field = 53
+	FieldChargeCurrentRequestMax    Field = 54
+	FieldBatteryHeaterOn            Field = 55
+	FieldNotEnoughPowerToHeat       Field = 56
+	FieldDoorState                  Field = 58
+	FieldLocked                     Field = 59
+	FieldFdWindow                   Field = 60
+	FieldFpWindow                   Field = 61
+	FieldRdWindow                   Field = 62
+	FieldRpWindow                   Field = 63
+	FieldVehicleName                Field = 64
+	FieldSentryMode                 Field = 65
+	FieldSpeedLimitMode             Field = 66
+	FieldCurrentLimitMph            Field = 67
+	FieldVersion                    Field = 68
+)
+
+var fieldNames = map[Field]string{
+	FieldUnknown:                    "Unknown",
+	FieldDriveState:                 "DriveState",
+	FieldChargeState:                "ChargeState",
+	FieldBmsFullchargecomplete:      "BmsFullchargecomplete",
+	FieldVehicleSpeed:               "VehicleSpeed",
+	FieldOdometer:                   "Odometer",
+	FieldPackVoltage:                "PackVoltage",
+	FieldPackCurrent:                "PackCurrent",
+	FieldSoc:                        "Soc",
+	FieldDCDCEnable:                 "DCDCEnable",
+	FieldGear:                       "Gear",
+	FieldIsolationResistance:        "IsolationResistance",
+	FieldPedalPosition:              "PedalPosition",
+	FieldBrakePedal:                 "BrakePedal",
+	FieldDiStateR:                   "DiStateR",
+	FieldDiHeatsinkTR:               "DiHeatsinkTR",
+	FieldDiAxleSpeedR:               "DiAxleSpeedR",
+	FieldDiTorquemotor:              "DiTorquemotor",
+	FieldDiStatorTempR:              "DiStatorTempR",
+	FieldDiVBatR:                    "DiVBatR",
+	FieldDiMotorCurrentR:            "DiMotorCurrentR",
+	FieldLocation:                   "Location",
+	FieldGpsState:                   "GpsState",
+	FieldGpsHeading:                 "GpsHeading",
+	FieldNumBrickVoltageMax:         "NumBrickVoltageMax",
+	FieldBrickVoltageMax:            "BrickVoltageMax",
+	FieldNumBrickVoltageMin:         "NumBrickVoltageMin",
+	FieldBrickVoltageMin:            "BrickVoltageMin",
+	FieldNumModuleTempMax:           "NumModuleTempMax",
+	FieldModuleTempMax:              "ModuleTempMax",
+	FieldNumModuleTempMin:           "NumModuleTempMin",
+	FieldModuleTempMin:              "ModuleTempMin",
+	FieldRatedRange:                 "RatedRange",
+	FieldHvil:                       "Hvil",
+	FieldDCChargingEnergyIn:         "DCChargingEnergyIn",
+	FieldDCChargingPower:            "DCChargingPower",
+	FieldACChargingEnergyIn:         "ACChargingEnergyIn",
+	FieldACChargingPower:            "ACChargingPower",
+	FieldChargeLimitSoc:             "ChargeLimitSoc",
+	FieldFastChargerPresent:         "FastChargerPresent",
+	FieldEstBatteryRange:            "EstBatteryRange",
+	FieldIdealBatteryRange:          "IdealBatteryRange",
+	FieldBatteryLevel:               "BatteryLevel",
+	FieldTimeToFullCharge:           "TimeToFullCharge",
+	FieldScheduledChargingStartTime: "ScheduledChargingStartTime",
+	FieldScheduledChargingPending:   "ScheduledChargingPending",
+	FieldScheduledDepartureTime:     "ScheduledDepartureTime",
+	FieldPreconditioningEnabled:     "PreconditioningEnabled",
+	FieldScheduledChargingMode:      "ScheduledChargingMode",
+	FieldChargeAmps:                 "ChargeAmps",
+	FieldChargeEnableRequest:        "ChargeEnableRequest",
+	FieldChargerPhases:              "ChargerPhases",
+	FieldChargePortColdWeatherMode:  "ChargePortColdWeatherMode",
+	FieldChargeCurrentRequest:       "ChargeCurrentRequest",
+	FieldChargeCurrentRequestMax:    "ChargeCurrentRequestMax",
+	FieldBatteryHeaterOn:            "BatteryHeaterOn",
+	FieldNotEnoughPowerToHeat:       "NotEnoughPowerToHeat",
+	FieldDoorState:                  "DoorState",
+	FieldLocked:                     "Locked",
+	FieldFdWindow:                   "FdWindow",
+	FieldFpWindow:                   "FpWindow",
+	FieldRdWindow:                   "RdWindow",
+	FieldRpWindow:                   "RpWindow",
+	FieldVehicleName:                "VehicleName",
+	FieldSentryMode:                 "SentryMode",
+	FieldSpeedLimitMode:             "SpeedLimitMode",
+	FieldCurrentLimitMph:            "CurrentLimitMph",
+	FieldVersion:                    "Version",
+}
+
+// String returns the name of the field used in configurations, e.g. "BatteryLevel"
+func (f Field) String() string {
+	if name, ok := fieldNames[f]; ok {
+		return name
+	}
+	return "Field(" + strconv.Itoa(int(f)) + ")"
+}
+
+// ParseField returns the field with the name used in configurations
+func ParseField(name string) (Field, bool) {
+	for f, n := range fieldNames {
+		if n == name {
+			return f, true
+		}
+	}
+	return FieldUnknown, false
+}
+
+// MarshalText encodes the field by its name, so maps of fields encode as objects
+func (f Field) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// UnmarshalText decodes a field encoded by MarshalText
+func (f *Field) UnmarshalText(text []byte) error {
+	field, ok := ParseField(string(text))
+	if !ok {
+		return errors.New("telemetry: unknown field " + string(text))
+	}
+	*f = field
+	return nil
+}
@@ -0,0 +1,30 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFieldsSpec(t *testing.T) {
+	Convey("Should name the fields", t, func() {
+		So(FieldBatteryLevel.String(), ShouldEqual, "BatteryLevel")
+		So(Field(999).String(), ShouldEqual, "Field(999)")
+		f, ok := ParseField("VehicleSpeed")
+		So(ok, ShouldBeTrue)
+		So(f, ShouldEqual, FieldVehicleSpeed)
+		_, ok = ParseField("Foo")
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Should encode maps of fields by name", t, func() {
+		data, err := json.Marshal(map[Field]int{FieldGear: 1})
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, `{"Gear":1}`)
+		var decoded map[Field]int
+		So(json.Unmarshal(data, &decoded), ShouldBeNil)
+		So(decoded[FieldGear], ShouldEqual, 1)
+		So(json.Unmarshal([]byte(`{"Foo":1}`), &decoded), ShouldNotBeNil)
+	})
+}
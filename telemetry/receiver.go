@@ -0,0 +1,194 @@
+// Package telemetry receives the records vehicles push through Fleet
+// Telemetry, which streams vehicle data without keeping vehicles awake or
+// counting against the rate limits of the Fleet API.
+//
+// Vehicles connect to the Receiver over mutual TLS WebSockets, identifying
+// themselves by their client certificates. Each record is decoded and passed
+// to the sinks of the receiver. Vehicles are told where to connect with a
+// Config pushed through the Fleet API.
+package telemetry
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/bogosj/tesla"
+)
+
+// DefaultMaxMessageSize is the size of the largest message accepted if
+// Receiver.MaxMessageSize is 0
+const DefaultMaxMessageSize = 1 << 20
+
+// Receiver is an http.Handler accepting the WebSocket connections of vehicles
+type Receiver struct {
+	// Sinks receive the records in the order they are received
+	Sinks []Sink
+	// Logger, if set, receives a line for every connection and dropped record
+	Logger tesla.Logger
+	// MaxMessageSize is the size of the largest message accepted
+	MaxMessageSize int
+	// Now returns the current time, time.Now if nil
+	Now func() time.Time
+}
+
+// NewReceiver returns a receiver passing the records to the sinks
+func NewReceiver(sinks ...Sink) *Receiver {
+	return &Receiver{Sinks: sinks}
+}
+
+func (r *Receiver) logf(format string, v ...interface{}) {
+	if r.Logger != nil {
+		r.Logger.Printf(format, v...)
+	}
+}
+
+func (r *Receiver) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
+// Passes a record to the sinks
+func (r *Receiver) dispatch(record Record) {
+	for _, sink := range r.Sinks {
+		sink.Receive(record)
+	}
+}
+
+// Returns the VIN a vehicle identifies itself with
+func clientVIN(req *http.Request) (string, bool) {
+	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return "", false
+	}
+	vin := req.TLS.PeerCertificates[0].Subject.CommonName
+	return vin, vin != ""
+}
+
+// Sets the VIN of a record, returning false if the record claims another vehicle
+func setVIN(record Record, vin string) bool {
+	var claimed *string
+	switch rec := record.(type) {
+	case *Data:
+		claimed = &rec.VIN
+	case *Alerts:
+		claimed = &rec.VIN
+	case *Errors:
+		claimed = &rec.VIN
+	default:
+		return false
+	}
+	if *claimed != "" && *claimed != vin {
+		return false
+	}
+	*claimed = vin
+	return true
+}
+
+// ServeHTTP accepts the connection of a vehicle and receives its records
+// until the vehicle disconnects
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	vin, ok := clientVIN(req)
+	if !ok {
+		http.Error(w, "client certificate required", http.StatusUnauthorized)
+		return
+	}
+	maxSize := r.MaxMessageSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxMessageSize
+	}
+	conn, err := upgrade(w, req, maxSize)
+	if err != nil {
+		r.logf("telemetry: %s: %v", vin, err)
+		return
+	}
+	defer conn.Close()
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	connectivity := &Connectivity{
+		VIN:          vin,
+		ConnectionID: hex.EncodeToString(id),
+		Status:       StatusConnected,
+		CreatedAt:    r.now(),
+	}
+	r.logf("telemetry: %s connected", vin)
+	r.dispatch(connectivity)
+	defer func() {
+		disconnected := *connectivity
+		disconnected.Status = StatusDisconnected
+		disconnected.CreatedAt = r.now()
+		r.logf("telemetry: %s disconnected", vin)
+		r.dispatch(&disconnected)
+	}()
+
+	for {
+		opcode, message, err := conn.readMessage()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				r.logf("telemetry: %s: %v", vin, err)
+			}
+			return
+		}
+		if opcode != opBinary {
+			continue
+		}
+		env, err := decodeEnvelope(message)
+		if err != nil {
+			r.logf("telemetry: %s: %v", vin, err)
+			continue
+		}
+		record, err := Decode(env.topic, env.payload)
+		if err != nil {
+			r.logf("telemetry: %s: %s: %v", vin, env.topic, err)
+			continue
+		}
+		if !setVIN(record, vin) {
+			r.logf("telemetry: %s: dropping %s record of another vehicle", vin, env.topic)
+			continue
+		}
+		r.dispatch(record)
+	}
+}
+
+// TLSConfig returns the configuration of a server presenting the certificate
+// and requiring vehicles to present a certificate issued by the CA, which is
+// the Tesla vehicle CA in production
+func TLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("telemetry: no certificates in " + clientCAFile)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// ListenAndServeTLS receives the records of vehicles connecting to addr,
+// using a configuration returned by TLSConfig
+func (r *Receiver) ListenAndServeTLS(addr string, config *tls.Config) error {
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   r,
+		TLSConfig: config,
+	}
+	return server.ListenAndServeTLS("", "")
+}
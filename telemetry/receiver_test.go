@@ -0,0 +1,176 @@
+package telemetry
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bogosj/tesla/internal/protobuf"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// Issues a certificate, self-signed if parent is nil
+func testCertificate(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// A vehicle connected to the receiver
+type testVehicle struct {
+	conn *tls.Conn
+}
+
+// Connects to the receiver with a certificate issued to the VIN
+func dialReceiver(ts *httptest.Server, cert *x509.Certificate, key *ecdsa.PrivateKey) (*testVehicle, error) {
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+	config := &tls.Config{RootCAs: roots}
+	if cert != nil {
+		config.Certificates = []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}}
+	}
+	conn, err := tls.Dial("tcp", strings.TrimPrefix(ts.URL, "https://"), config)
+	if err != nil {
+		return nil, err
+	}
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"))
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, &httpError{res.Status}
+	}
+	return &testVehicle{conn}, nil
+}
+
+type httpError struct{ status string }
+
+func (e *httpError) Error() string { return e.status }
+
+func (v *testVehicle) send(topic, vin string, payload []byte) {
+	v.conn.Write(wsFrame(true, opBinary, testEnvelope(topic, vin, payload)))
+}
+
+func (v *testVehicle) close() {
+	v.conn.Write(wsFrame(true, opClose, nil))
+	v.conn.Close()
+}
+
+func TestReceiverSpec(t *testing.T) {
+	ca, caKey := testCertificate(t, "Vehicle CA", nil, nil)
+	vehicleCert, vehicleKey := testCertificate(t, "abc123", ca, caKey)
+	otherCA, otherKey := testCertificate(t, "Other CA", nil, nil)
+	strangerCert, strangerKey := testCertificate(t, "def456", otherCA, otherKey)
+
+	received := make(chan Record, 10)
+	receiver := NewReceiver(SinkFunc(func(record Record) {
+		received <- record
+	}))
+	ts := httptest.NewUnstartedServer(receiver)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	ts.TLS = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: pool}
+	ts.StartTLS()
+	defer ts.Close()
+
+	next := func() Record {
+		select {
+		case record := <-received:
+			return record
+		case <-time.After(5 * time.Second):
+			return nil
+		}
+	}
+
+	vehicle, err := dialReceiver(ts, vehicleCert, vehicleKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vehicle.conn.Close()
+	var connected *Connectivity
+
+	Convey("Should report the connection of a vehicle", t, func() {
+		var ok bool
+		connected, ok = next().(*Connectivity)
+		So(ok, ShouldBeTrue)
+		So(connected.VIN, ShouldEqual, "abc123")
+		So(connected.Status, ShouldEqual, StatusConnected)
+	})
+
+	Convey("Should receive the records of the vehicle", t, func() {
+		vehicle.send(TopicData, "abc123", testDataPayload("abc123"))
+		data, ok := next().(*Data)
+		So(ok, ShouldBeTrue)
+		So(data.VIN, ShouldEqual, "abc123")
+		So(data.ChargeState().BatteryLevel, ShouldEqual, 80)
+	})
+
+	Convey("Should fill in the VIN of the certificate", t, func() {
+		vehicle.send(TopicErrors, "", protobuf.Message{}.Bytes(1, protobuf.Message{}.Bytes(2, []byte("foo"))))
+		errs, ok := next().(*Errors)
+		So(ok, ShouldBeTrue)
+		So(errs.VIN, ShouldEqual, "abc123")
+	})
+
+	Convey("Should drop records of other vehicles and malformed records", t, func() {
+		vehicle.send(TopicData, "def456", testDataPayload("def456"))
+		vehicle.conn.Write(wsFrame(true, opBinary, []byte{1, 2, 3}))
+		vehicle.send("foo", "abc123", nil)
+		vehicle.send(TopicAlerts, "abc123", protobuf.Message{}.Bytes(3, []byte("abc123")))
+		alerts, ok := next().(*Alerts)
+		So(ok, ShouldBeTrue)
+		So(alerts.VIN, ShouldEqual, "abc123")
+	})
+
+	Convey("Should report the disconnection", t, func() {
+		vehicle.close()
+		disconnected, ok := next().(*Connectivity)
+		So(ok, ShouldBeTrue)
+		So(disconnected.Status, ShouldEqual, StatusDisconnected)
+		So(disconnected.ConnectionID, ShouldEqual, connected.ConnectionID)
+	})
+
+	Convey("Should reject vehicles without a trusted certificate", t, func() {
+		_, err := dialReceiver(ts, nil, nil)
+		So(err, ShouldNotBeNil)
+		_, err = dialReceiver(ts, strangerCert, strangerKey)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,486 @@
+package telemetry
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/bogosj/tesla"
+	"github.com/bogosj/tesla/internal/protobuf"
+)
+
+// The topics records are sent on
+const (
+	TopicData         = "V"
+	TopicAlerts       = "alerts"
+	TopicErrors       = "errors"
+	TopicConnectivity = "connectivity"
+)
+
+// Record is a decoded telemetry message: *Data, *Alerts, *Errors or *Connectivity
+type Record interface {
+	// Topic returns the topic of the record, e.g. TopicData
+	Topic() string
+}
+
+// ValueKind is the type of a field value
+type ValueKind int
+
+const (
+	KindString ValueKind = iota
+	KindInt
+	KindFloat
+	KindBool
+	KindLocation
+)
+
+// Location is a GPS position
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Value is the value of a field. Vehicles on older firmware send every value
+// as text, which the accessors parse.
+type Value struct {
+	Kind     ValueKind `json:"kind"`
+	Text     string    `json:"text,omitempty"`
+	Number   float64   `json:"number,omitempty"`
+	Bool     bool      `json:"bool,omitempty"`
+	Location *Location `json:"location,omitempty"`
+}
+
+// Float returns the numeric value and whether the value is numeric
+func (v Value) Float() (float64, bool) {
+	switch v.Kind {
+	case KindInt, KindFloat:
+		return v.Number, true
+	case KindString:
+		f, err := strconv.ParseFloat(v.Text, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Int returns the numeric value rounded to an integer and whether the value is numeric
+func (v Value) Int() (int, bool) {
+	f, ok := v.Float()
+	return int(math.Round(f)), ok
+}
+
+// Boolean returns the boolean value and whether the value is a boolean
+func (v Value) Boolean() (bool, bool) {
+	switch v.Kind {
+	case KindBool:
+		return v.Bool, true
+	case KindString:
+		b, err := strconv.ParseBool(v.Text)
+		return b, err == nil
+	}
+	return false, false
+}
+
+// String returns the value as text
+func (v Value) String() string {
+	switch v.Kind {
+	case KindInt, KindFloat:
+		return strconv.FormatFloat(v.Number, 'f', -1, 64)
+	case KindBool:
+		return strconv.FormatBool(v.Bool)
+	case KindLocation:
+		return strconv.FormatFloat(v.Location.Latitude, 'f', -1, 64) + "," + strconv.FormatFloat(v.Location.Longitude, 'f', -1, 64)
+	}
+	return v.Text
+}
+
+// Data is a batch of field values sampled by a vehicle
+type Data struct {
+	VIN       string          `json:"vin"`
+	CreatedAt time.Time       `json:"created_at"`
+	Resend    bool            `json:"is_resend"`
+	Fields    map[Field]Value `json:"data"`
+}
+
+// Topic returns TopicData
+func (d *Data) Topic() string { return TopicData }
+
+// Returns the value of a field as a float, if present and numeric
+func (d *Data) float(f Field) (float64, bool) {
+	v, ok := d.Fields[f]
+	if !ok {
+		return 0, false
+	}
+	return v.Float()
+}
+
+// Returns the value of a field as an int, if present and numeric
+func (d *Data) int(f Field) (int, bool) {
+	v, ok := d.Fields[f]
+	if !ok {
+		return 0, false
+	}
+	return v.Int()
+}
+
+// Returns the value of a field as a bool, if present and boolean
+func (d *Data) bool(f Field) (bool, bool) {
+	v, ok := d.Fields[f]
+	if !ok {
+		return false, false
+	}
+	return v.Boolean()
+}
+
+// ChargeState returns the charge state fields carried by the record, or nil
+// if it carries none. Fields missing from the record keep their zero value.
+func (d *Data) ChargeState() *tesla.ChargeState {
+	s := &tesla.ChargeState{}
+	found := false
+	setInt := func(f Field, dst *int) {
+		if v, ok := d.int(f); ok {
+			*dst, found = v, true
+		}
+	}
+	setFloat := func(f Field, dst *float64) {
+		if v, ok := d.float(f); ok {
+			*dst, found = v, true
+		}
+	}
+	setBool := func(f Field, dst *bool) {
+		if v, ok := d.bool(f); ok {
+			*dst, found = v, true
+		}
+	}
+	setNullInt := func(f Field, dst *tesla.NullInt) {
+		if v, ok := d.int(f); ok {
+			*dst, found = tesla.NewNullInt(v), true
+		}
+	}
+	setNullFloat := func(f Field, dst *tesla.NullFloat) {
+		if v, ok := d.float(f); ok {
+			*dst, found = tesla.NewNullFloat(v), true
+		}
+	}
+	setNullTime := func(f Field, dst *tesla.NullTime) {
+		if v, ok := d.float(f); ok {
+			*dst, found = tesla.NewNullTime(time.Unix(int64(v), 0)), true
+		}
+	}
+	setInt(FieldBatteryLevel, &s.BatteryLevel)
+	setInt(FieldChargeLimitSoc, &s.ChargeLimitSoc)
+	setInt(FieldChargeCurrentRequest, &s.ChargeCurrentRequest)
+	setInt(FieldChargeCurrentRequestMax, &s.ChargeCurrentRequestMax)
+	setFloat(FieldRatedRange, &s.BatteryRange)
+	setFloat(FieldEstBatteryRange, &s.EstBatteryRange)
+	setFloat(FieldIdealBatteryRange, &s.IdealBatteryRange)
+	setFloat(FieldTimeToFullCharge, &s.TimeToFullCharge)
+	setBool(FieldFastChargerPresent, &s.FastChargerPresent)
+	setBool(FieldScheduledChargingPending, &s.ScheduledChargingPending)
+	setBool(FieldChargeEnableRequest, &s.ChargeEnableRequest)
+	setBool(FieldChargePortColdWeatherMode, &s.ChargePortcoldWeatherMode)
+	setBool(FieldBatteryHeaterOn, &s.BatteryHeaterOn)
+	setBool(FieldNotEnoughPowerToHeat, &s.NotEnoughPowerToHeat)
+	setNullTime(FieldScheduledChargingStartTime, &s.ScheduledChargingStartTime)
+	setNullInt(FieldChargerPhases, &s.ChargerPhases)
+	setNullInt(FieldChargeAmps, &s.ChargerActualCurrent)
+	setNullFloat(FieldACChargingPower, &s.ChargerPower)
+	// The power of a fast charger is reported separately
+	if s.FastChargerPresent {
+		setNullFloat(FieldDCChargingPower, &s.ChargerPower)
+	}
+	if !found {
+		return nil
+	}
+	return s
+}
+
+// DriveState returns the drive state fields carried by the record, or nil
+// if it carries none. Fields missing from the record keep their zero value.
+func (d *Data) DriveState() *tesla.DriveState {
+	s := &tesla.DriveState{}
+	found := false
+	if v, ok := d.float(FieldVehicleSpeed); ok {
+		s.Speed, found = v, true
+	}
+	if v, ok := d.int(FieldGpsHeading); ok {
+		s.Heading, found = v, true
+	}
+	if v, ok := d.Fields[FieldGear]; ok {
+		s.ShiftState, found = tesla.ShiftState(v.String()), true
+	}
+	if v, ok := d.Fields[FieldLocation]; ok && v.Location != nil {
+		s.Latitude, s.Longitude, found = v.Location.Latitude, v.Location.Longitude, true
+		s.GpsAsOf = d.CreatedAt.Unix()
+	}
+	if !found {
+		return nil
+	}
+	return s
+}
+
+// Audience is who an alert is meant for
+type Audience int
+
+const (
+	AudienceUnknown Audience = iota
+	AudienceCustomer
+	AudienceService
+	AudienceServiceFix
+)
+
+var audienceNames = map[Audience]string{
+	AudienceCustomer:   "customer",
+	AudienceService:    "service",
+	AudienceServiceFix: "service_fix",
+}
+
+// String returns the name of the audience used in configurations, e.g. "service"
+func (a Audience) String() string {
+	if name, ok := audienceNames[a]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Alert is an alert raised by a vehicle
+type Alert struct {
+	Name      string     `json:"name"`
+	Audiences []Audience `json:"audiences"`
+	StartedAt time.Time  `json:"started_at"`
+	// EndedAt is zero while the alert is active
+	EndedAt time.Time `json:"ended_at"`
+}
+
+// Alerts is a batch of alerts raised by a vehicle
+type Alerts struct {
+	VIN       string    `json:"vin"`
+	CreatedAt time.Time `json:"created_at"`
+	Alerts    []Alert   `json:"alerts"`
+}
+
+// Topic returns TopicAlerts
+func (a *Alerts) Topic() string { return TopicAlerts }
+
+// VehicleError is an error a vehicle encountered while streaming
+type VehicleError struct {
+	CreatedAt time.Time         `json:"created_at"`
+	Name      string            `json:"name"`
+	Tags      map[string]string `json:"tags"`
+	Body      string            `json:"body"`
+}
+
+// Errors is a batch of errors reported by a vehicle
+type Errors struct {
+	VIN       string         `json:"vin"`
+	CreatedAt time.Time      `json:"created_at"`
+	Errors    []VehicleError `json:"errors"`
+}
+
+// Topic returns TopicErrors
+func (e *Errors) Topic() string { return TopicErrors }
+
+// ConnectivityStatus tells whether a vehicle connected or disconnected
+type ConnectivityStatus int
+
+const (
+	StatusUnknown ConnectivityStatus = iota
+	StatusConnected
+	StatusDisconnected
+)
+
+// Connectivity reports a vehicle connecting to or disconnecting from the receiver
+type Connectivity struct {
+	VIN              string             `json:"vin"`
+	ConnectionID     string             `json:"connection_id"`
+	Status           ConnectivityStatus `json:"status"`
+	CreatedAt        time.Time          `json:"created_at"`
+	NetworkInterface string             `json:"network_interface,omitempty"`
+}
+
+// Topic returns TopicConnectivity
+func (c *Connectivity) Topic() string { return TopicConnectivity }
+
+// ErrUnknownTopic is returned when decoding a record of an unknown topic
+var ErrUnknownTopic = errors.New("telemetry: unknown topic")
+
+// Decode decodes the protobuf payload of a record sent on the topic
+func Decode(topic string, payload []byte) (Record, error) {
+	fields, err := protobuf.Parse(payload)
+	if err != nil {
+		return nil, err
+	}
+	switch topic {
+	case TopicData:
+		return decodeData(fields)
+	case TopicAlerts:
+		return decodeAlerts(fields)
+	case TopicErrors:
+		return decodeErrors(fields)
+	case TopicConnectivity:
+		return decodeConnectivity(fields)
+	}
+	return nil, ErrUnknownTopic
+}
+
+// Decodes a google.protobuf.Timestamp
+func decodeTimestamp(fields protobuf.Fields, num int) (time.Time, error) {
+	ts, err := fields.Message(num)
+	if err != nil || ts == nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(ts.Value(1)), int64(ts.Value(2))).UTC(), nil
+}
+
+func decodeData(fields protobuf.Fields) (*Data, error) {
+	createdAt, err := decodeTimestamp(fields, 2)
+	if err != nil {
+		return nil, err
+	}
+	d := &Data{
+		VIN:       string(fields.Bytes(3)),
+		CreatedAt: createdAt,
+		Resend:    fields.Value(4) != 0,
+		Fields:    map[Field]Value{},
+	}
+	for _, f := range fields.All(1) {
+		datum, err := protobuf.Parse(f.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		value, err := decodeValue(datum)
+		if err != nil {
+			return nil, err
+		}
+		d.Fields[Field(datum.Value(1))] = value
+	}
+	return d, nil
+}
+
+// Decodes the value of a datum, whose oneof field gives the type
+func decodeValue(datum protobuf.Fields) (Value, error) {
+	v, err := datum.Message(2)
+	if err != nil || len(v) == 0 {
+		return Value{}, err
+	}
+	f := v[len(v)-1]
+	switch f.Num {
+	case 1:
+		return Value{Kind: KindString, Text: string(f.Bytes)}, nil
+	case 2:
+		return Value{Kind: KindInt, Number: float64(int32(f.Value))}, nil
+	case 3:
+		return Value{Kind: KindInt, Number: float64(int64(f.Value))}, nil
+	case 4, 5:
+		return Value{Kind: KindFloat, Number: f.Float()}, nil
+	case 6:
+		return Value{Kind: KindBool, Bool: f.Value != 0}, nil
+	case 7:
+		loc, err := protobuf.Parse(f.Bytes)
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{Kind: KindLocation, Location: &Location{
+			Latitude:  math.Float64frombits(loc.Value(1)),
+			Longitude: math.Float64frombits(loc.Value(2)),
+		}}, nil
+	}
+	// Enums of newer firmware
+	if f.Wire == protobuf.WireVarint {
+		return Value{Kind: KindInt, Number: float64(f.Value)}, nil
+	}
+	return Value{Kind: KindString, Text: string(f.Bytes)}, nil
+}
+
+func decodeAlerts(fields protobuf.Fields) (*Alerts, error) {
+	createdAt, err := decodeTimestamp(fields, 2)
+	if err != nil {
+		return nil, err
+	}
+	a := &Alerts{VIN: string(fields.Bytes(3)), CreatedAt: createdAt}
+	for _, f := range fields.All(1) {
+		alert, err := protobuf.Parse(f.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		started, err := decodeTimestamp(alert, 3)
+		if err != nil {
+			return nil, err
+		}
+		ended, err := decodeTimestamp(alert, 4)
+		if err != nil {
+			return nil, err
+		}
+		var audiences []Audience
+		for _, audience := range alert.All(2) {
+			if audience.Wire == protobuf.WireBytes {
+				// Packed repeated enum
+				for b := audience.Bytes; len(b) > 0; {
+					v, n := binary.Uvarint(b)
+					if n <= 0 {
+						return nil, protobuf.ErrTruncated
+					}
+					audiences = append(audiences, Audience(v))
+					b = b[n:]
+				}
+				continue
+			}
+			audiences = append(audiences, Audience(audience.Value))
+		}
+		a.Alerts = append(a.Alerts, Alert{
+			Name:      string(alert.Bytes(1)),
+			Audiences: audiences,
+			StartedAt: started,
+			EndedAt:   ended,
+		})
+	}
+	return a, nil
+}
+
+func decodeErrors(fields protobuf.Fields) (*Errors, error) {
+	createdAt, err := decodeTimestamp(fields, 2)
+	if err != nil {
+		return nil, err
+	}
+	e := &Errors{VIN: string(fields.Bytes(3)), CreatedAt: createdAt}
+	for _, f := range fields.All(1) {
+		vehicleErr, err := protobuf.Parse(f.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		created, err := decodeTimestamp(vehicleErr, 1)
+		if err != nil {
+			return nil, err
+		}
+		tags := map[string]string{}
+		for _, tag := range vehicleErr.All(3) {
+			entry, err := protobuf.Parse(tag.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			tags[string(entry.Bytes(1))] = string(entry.Bytes(2))
+		}
+		e.Errors = append(e.Errors, VehicleError{
+			CreatedAt: created,
+			Name:      string(vehicleErr.Bytes(2)),
+			Tags:      tags,
+			Body:      string(vehicleErr.Bytes(4)),
+		})
+	}
+	return e, nil
+}
+
+func decodeConnectivity(fields protobuf.Fields) (*Connectivity, error) {
+	createdAt, err := decodeTimestamp(fields, 4)
+	if err != nil {
+		return nil, err
+	}
+	return &Connectivity{
+		VIN:              string(fields.Bytes(1)),
+		ConnectionID:     string(fields.Bytes(2)),
+		Status:           ConnectivityStatus(fields.Value(3)),
+		CreatedAt:        createdAt,
+		NetworkInterface: string(fields.Bytes(5)),
+	}, nil
+}
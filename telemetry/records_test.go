@@ -0,0 +1,132 @@
+package telemetry
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/bogosj/tesla/internal/protobuf"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func testTimestamp(t time.Time) []byte {
+	return protobuf.Message{}.Varint(1, uint64(t.Unix())).Varint(2, uint64(t.Nanosecond()))
+}
+
+// Encodes a datum of a data record
+func testDatum(f Field, value protobuf.Message) []byte {
+	return protobuf.Message{}.Varint(1, uint64(f)).Bytes(2, value)
+}
+
+var testCreatedAt = time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+
+// Encodes a data record with values of every type
+func testDataPayload(vin string) []byte {
+	location := protobuf.Message{}.Fixed64(1, math.Float64bits(37.49)).Fixed64(2, math.Float64bits(-121.94))
+	return protobuf.Message{}.
+		Bytes(1, testDatum(FieldBatteryLevel, protobuf.Message{}.Fixed32(4, math.Float32bits(79.5)))).
+		Bytes(1, testDatum(FieldChargeLimitSoc, protobuf.Message{}.Varint(2, 90))).
+		Bytes(1, testDatum(FieldEstBatteryRange, protobuf.Message{}.Fixed64(5, math.Float64bits(210.25)))).
+		Bytes(1, testDatum(FieldFastChargerPresent, protobuf.Message{}.Varint(6, 1))).
+		Bytes(1, testDatum(FieldDCChargingPower, protobuf.Message{}.Bytes(1, []byte("120.5")))).
+		Bytes(1, testDatum(FieldVehicleSpeed, protobuf.Message{}.Bytes(1, []byte("0")))).
+		Bytes(1, testDatum(FieldGear, protobuf.Message{}.Bytes(1, []byte("P")))).
+		Bytes(1, testDatum(FieldLocation, protobuf.Message{}.Bytes(7, location))).
+		Bytes(2, testTimestamp(testCreatedAt)).
+		Bytes(3, []byte(vin))
+}
+
+func TestRecordsSpec(t *testing.T) {
+	Convey("Should decode data records", t, func() {
+		record, err := Decode(TopicData, testDataPayload("abc123"))
+		So(err, ShouldBeNil)
+		data, ok := record.(*Data)
+		So(ok, ShouldBeTrue)
+		So(data.Topic(), ShouldEqual, TopicData)
+		So(data.VIN, ShouldEqual, "abc123")
+		So(data.CreatedAt, ShouldEqual, testCreatedAt)
+		So(data.Fields[FieldChargeLimitSoc].Kind, ShouldEqual, KindInt)
+		So(data.Fields[FieldGear].String(), ShouldEqual, "P")
+
+		Convey("Should fill the charge state", func() {
+			state := data.ChargeState()
+			So(state, ShouldNotBeNil)
+			So(state.BatteryLevel, ShouldEqual, 80)
+			So(state.ChargeLimitSoc, ShouldEqual, 90)
+			So(state.EstBatteryRange, ShouldEqual, 210.25)
+			So(state.FastChargerPresent, ShouldBeTrue)
+			So(state.ChargerPower.Valid, ShouldBeTrue)
+			So(state.ChargerPower.Float64, ShouldEqual, 120.5)
+		})
+
+		Convey("Should fill the drive state", func() {
+			state := data.DriveState()
+			So(state, ShouldNotBeNil)
+			So(state.Speed, ShouldEqual, 0)
+			So(state.ShiftState, ShouldEqual, "P")
+			So(state.Latitude, ShouldEqual, 37.49)
+			So(state.Longitude, ShouldEqual, -121.94)
+			So(state.GpsAsOf, ShouldEqual, testCreatedAt.Unix())
+		})
+
+		Convey("Should return no states without their fields", func() {
+			empty := &Data{Fields: map[Field]Value{FieldOdometer: {Kind: KindFloat, Number: 1}}}
+			So(empty.ChargeState(), ShouldBeNil)
+			So(empty.DriveState(), ShouldBeNil)
+		})
+	})
+
+	Convey("Should decode alerts", t, func() {
+		alert := protobuf.Message{}.
+			Bytes(1, []byte("BMS_a066_SW_Over_Current")).
+			Bytes(2, protobuf.Message{}.Uvarint(uint64(AudienceCustomer)).Uvarint(uint64(AudienceService))).
+			Bytes(3, testTimestamp(testCreatedAt))
+		record, err := Decode(TopicAlerts, protobuf.Message{}.Bytes(1, alert).Bytes(2, testTimestamp(testCreatedAt)).Bytes(3, []byte("abc123")))
+		So(err, ShouldBeNil)
+		alerts := record.(*Alerts)
+		So(alerts.VIN, ShouldEqual, "abc123")
+		So(len(alerts.Alerts), ShouldEqual, 1)
+		So(alerts.Alerts[0].Name, ShouldEqual, "BMS_a066_SW_Over_Current")
+		So(alerts.Alerts[0].Audiences, ShouldResemble, []Audience{AudienceCustomer, AudienceService})
+		So(alerts.Alerts[0].StartedAt, ShouldEqual, testCreatedAt)
+		So(alerts.Alerts[0].EndedAt.IsZero(), ShouldBeTrue)
+	})
+
+	Convey("Should decode errors", t, func() {
+		tag := protobuf.Message{}.Bytes(1, []byte("field")).Bytes(2, []byte("BatteryLevel"))
+		vehicleErr := protobuf.Message{}.Bytes(1, testTimestamp(testCreatedAt)).Bytes(2, []byte("unsupported_field")).Bytes(3, tag).Bytes(4, []byte("not supported"))
+		record, err := Decode(TopicErrors, protobuf.Message{}.Bytes(1, vehicleErr).Bytes(3, []byte("abc123")))
+		So(err, ShouldBeNil)
+		errs := record.(*Errors)
+		So(len(errs.Errors), ShouldEqual, 1)
+		So(errs.Errors[0].Name, ShouldEqual, "unsupported_field")
+		So(errs.Errors[0].Tags, ShouldResemble, map[string]string{"field": "BatteryLevel"})
+		So(errs.Errors[0].Body, ShouldEqual, "not supported")
+	})
+
+	Convey("Should decode connectivity events", t, func() {
+		payload := protobuf.Message{}.Bytes(1, []byte("abc123")).Bytes(2, []byte("conn1")).Varint(3, uint64(StatusDisconnected)).Bytes(4, testTimestamp(testCreatedAt)).Bytes(5, []byte("wifi"))
+		record, err := Decode(TopicConnectivity, payload)
+		So(err, ShouldBeNil)
+		So(record, ShouldResemble, &Connectivity{VIN: "abc123", ConnectionID: "conn1", Status: StatusDisconnected, CreatedAt: testCreatedAt, NetworkInterface: "wifi"})
+	})
+
+	Convey("Should reject unknown topics and truncated records", t, func() {
+		_, err := Decode("foo", nil)
+		So(err, ShouldEqual, ErrUnknownTopic)
+		_, err = Decode(TopicData, testDataPayload("abc123")[:20])
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Should parse the values of older firmware", t, func() {
+		v := Value{Kind: KindString, Text: "true"}
+		b, ok := v.Boolean()
+		So(ok, ShouldBeTrue)
+		So(b, ShouldBeTrue)
+		_, ok = v.Float()
+		So(ok, ShouldBeFalse)
+		n, ok := Value{Kind: KindString, Text: "12.6"}.Int()
+		So(ok, ShouldBeTrue)
+		So(n, ShouldEqual, 13)
+	})
+}
@@ -0,0 +1,48 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// Sink receives the records of a Receiver. Receive is called concurrently
+// for records of different vehicles.
+type Sink interface {
+	Receive(record Record)
+}
+
+// SinkFunc adapts a function to a Sink
+type SinkFunc func(record Record)
+
+// Receive calls f(record)
+func (f SinkFunc) Receive(record Record) {
+	f(record)
+}
+
+// JSONSink writes each record as a line of JSON, e.g.
+// {"topic":"V","record":{"vin":"...","data":{"BatteryLevel":{...}}}}
+type JSONSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	// Err is the first error writing a record
+	Err error
+}
+
+// NewJSONSink returns a sink writing to w
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{enc: json.NewEncoder(w)}
+}
+
+// Receive writes the record
+func (s *JSONSink) Receive(record Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.enc.Encode(&struct {
+		Topic  string `json:"topic"`
+		Record Record `json:"record"`
+	}{record.Topic(), record})
+	if err != nil && s.Err == nil {
+		s.Err = err
+	}
+}
@@ -0,0 +1,35 @@
+package telemetry
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSinkSpec(t *testing.T) {
+	Convey("Should write records as lines of JSON", t, func() {
+		var buf bytes.Buffer
+		sink := NewJSONSink(&buf)
+		sink.Receive(&Data{
+			VIN:       "abc123",
+			CreatedAt: time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC),
+			Fields:    map[Field]Value{FieldBatteryLevel: {Kind: KindFloat, Number: 79.5}},
+		})
+		sink.Receive(&Connectivity{VIN: "abc123", Status: StatusConnected})
+		So(sink.Err, ShouldBeNil)
+		lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+		So(len(lines), ShouldEqual, 2)
+		So(string(lines[0]), ShouldEqual, `{"topic":"V","record":{"vin":"abc123","created_at":"2023-11-14T22:13:20Z","is_resend":false,"data":{"BatteryLevel":{"kind":2,"number":79.5}}}}`)
+		So(string(lines[1]), ShouldStartWith, `{"topic":"connectivity","record":{"vin":"abc123"`)
+	})
+
+	Convey("Should adapt functions", t, func() {
+		var topics []string
+		sink := SinkFunc(func(record Record) { topics = append(topics, record.Topic()) })
+		sink.Receive(&Alerts{})
+		sink.Receive(&Errors{})
+		So(topics, ShouldResemble, []string{TopicAlerts, TopicErrors})
+	})
+}
@@ -0,0 +1,197 @@
+package telemetry
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// The GUID of the WebSocket handshake, see RFC 6455
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// The opcodes of WebSocket frames
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+var errMessageTooLarge = errors.New("telemetry: message too large")
+
+// The server side of a WebSocket connection
+type wsConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	maxSize int
+
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+// Returns the accept key answering the key of a handshake
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Indicates whether a comma separated header contains the token
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Completes the WebSocket handshake of a request and takes over its connection
+func upgrade(w http.ResponseWriter, req *http.Request, maxSize int) (*wsConn, error) {
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if req.Method != "GET" || key == "" || !headerContains(req.Header, "Connection", "upgrade") || !headerContains(req.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected a WebSocket handshake", http.StatusBadRequest)
+		return nil, errors.New("telemetry: not a WebSocket handshake")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection cannot be upgraded", http.StatusInternalServerError)
+		return nil, errors.New("telemetry: connection cannot be hijacked")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, r: rw.Reader, w: rw.Writer, maxSize: maxSize}, nil
+}
+
+// Reads a frame, unmasking its payload
+func (c *wsConn) readFrame() (fin bool, opcode int, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.r, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = head[0]&0x80 != 0
+	opcode = int(head[0] & 0x0f)
+	masked := head[1]&0x80 != 0
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if !masked {
+		return false, 0, nil, errors.New("telemetry: unmasked client frame")
+	}
+	if length > uint64(c.maxSize) {
+		return false, 0, nil, errMessageTooLarge
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// Reads the next data message, answering pings and closes on the way. It
+// returns io.EOF once the client closes the connection.
+func (c *wsConn) readMessage() (int, []byte, error) {
+	var opcode int
+	var message []byte
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			c.writeFrame(opClose, payload)
+			return 0, nil, io.EOF
+		case opContinuation:
+			if message == nil {
+				return 0, nil, errors.New("telemetry: unexpected continuation frame")
+			}
+		case opText, opBinary:
+			if message != nil {
+				return 0, nil, errors.New("telemetry: interleaved data frames")
+			}
+			opcode = op
+			message = []byte{}
+		default:
+			return 0, nil, errors.New("telemetry: unknown opcode")
+		}
+		if len(message)+len(payload) > c.maxSize {
+			return 0, nil, errMessageTooLarge
+		}
+		message = append(message, payload...)
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+// Writes an unmasked frame, as servers do
+func (c *wsConn) writeFrame(opcode int, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	head := []byte{0x80 | byte(opcode)}
+	switch l := len(payload); {
+	case l < 126:
+		head = append(head, byte(l))
+	case l <= 0xffff:
+		head = append(head, 126, byte(l>>8), byte(l))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(l))
+		head = append(append(head, 127), ext[:]...)
+	}
+	c.w.Write(head)
+	c.w.Write(payload)
+	return c.w.Flush()
+}
+
+// Closes the connection
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,91 @@
+package telemetry
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// Encodes a masked frame, as clients send them
+func wsFrame(fin bool, opcode int, payload []byte) []byte {
+	head := byte(opcode)
+	if fin {
+		head |= 0x80
+	}
+	frame := []byte{head}
+	switch l := len(payload); {
+	case l < 126:
+		frame = append(frame, 0x80|byte(l))
+	case l <= 0xffff:
+		frame = append(frame, 0x80|126, byte(l>>8), byte(l))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(l))
+		frame = append(append(frame, 0x80|127), ext[:]...)
+	}
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// Returns a server connection and the client end of a pipe
+func testWSConn(maxSize int) (*wsConn, net.Conn) {
+	server, client := net.Pipe()
+	return &wsConn{conn: server, r: bufio.NewReader(server), w: bufio.NewWriter(server), maxSize: maxSize}, client
+}
+
+func TestWebSocketSpec(t *testing.T) {
+	Convey("Should answer the handshake key", t, func() {
+		// Example from RFC 6455
+		So(websocketAccept("dGhlIHNhbXBsZSBub25jZQ=="), ShouldEqual, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=")
+	})
+
+	Convey("Should reassemble fragmented messages and answer pings", t, func() {
+		conn, client := testWSConn(1024)
+		defer conn.Close()
+		go func() {
+			client.Write(wsFrame(false, opBinary, []byte("hello ")))
+			client.Write(wsFrame(true, opPing, []byte("ping")))
+			client.Write(wsFrame(true, opContinuation, make([]byte, 200)))
+		}()
+		done := make(chan []byte)
+		go func() {
+			pong := make([]byte, 6)
+			io.ReadFull(client, pong)
+			done <- pong
+		}()
+		opcode, message, err := conn.readMessage()
+		So(err, ShouldBeNil)
+		So(opcode, ShouldEqual, opBinary)
+		So(len(message), ShouldEqual, 206)
+		So(string(message[:6]), ShouldEqual, "hello ")
+		So(<-done, ShouldResemble, []byte{0x80 | opPong, 4, 'p', 'i', 'n', 'g'})
+	})
+
+	Convey("Should return io.EOF when the client closes", t, func() {
+		conn, client := testWSConn(1024)
+		defer conn.Close()
+		go func() {
+			client.Write(wsFrame(true, opClose, nil))
+			io.Copy(ioutil.Discard, client)
+		}()
+		_, _, err := conn.readMessage()
+		So(err, ShouldEqual, io.EOF)
+	})
+
+	Convey("Should reject large messages", t, func() {
+		conn, client := testWSConn(100)
+		defer conn.Close()
+		go client.Write(wsFrame(true, opBinary, make([]byte, 101)))
+		_, _, err := conn.readMessage()
+		So(err, ShouldEqual, errMessageTooLarge)
+	})
+}
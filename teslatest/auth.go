@@ -0,0 +1,153 @@
+package teslatest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bogosj/tesla"
+)
+
+// The SSO login page, carrying the hidden inputs posted back with the credentials
+const loginPage = `<html><body><form method="post">
+<input type="hidden" name="_csrf" value="csrf">
+<input type="hidden" name="transaction_id" value="%s">
+<input type="text" name="identity">
+<input type="password" name="credential">
+</form></body></html>`
+
+// Serves the SSO authorize and token endpoints
+func (s *Server) serveSSO(w http.ResponseWriter, req *http.Request) {
+	switch {
+	case req.Method == "GET" && req.URL.Path == "/oauth2/v3/authorize":
+		s.mu.Lock()
+		transaction := s.newToken("transaction")
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, loginPage, html.EscapeString(transaction))
+	case req.Method == "POST" && req.URL.Path == "/oauth2/v3/authorize":
+		req.ParseForm()
+		if req.PostForm.Get("identity") != s.Email || req.PostForm.Get("credential") != s.Password {
+			// The login page is shown again on wrong credentials
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, loginPage, html.EscapeString(req.PostForm.Get("transaction_id")))
+			return
+		}
+		q := req.URL.Query()
+		s.mu.Lock()
+		code := s.newToken("code")
+		s.codes[code] = q.Get("code_challenge")
+		s.mu.Unlock()
+		redirect := url.Values{}
+		redirect.Set("code", code)
+		redirect.Set("state", q.Get("state"))
+		http.Redirect(w, req, q.Get("redirect_uri")+"?"+redirect.Encode(), http.StatusFound)
+	case req.Method == "POST" && req.URL.Path == "/oauth2/v3/token" &&
+		req.Header.Get("Content-Type") == "application/x-www-form-urlencoded":
+		s.serveFleetToken(w, req)
+	case req.Method == "POST" && req.URL.Path == "/oauth2/v3/token":
+		params := map[string]string{}
+		json.NewDecoder(req.Body).Decode(&params)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch params["grant_type"] {
+		case "authorization_code":
+			challenge, ok := s.codes[params["code"]]
+			if !ok || codeChallenge(params["code_verifier"]) != challenge {
+				writeError(w, http.StatusBadRequest, "invalid_grant")
+				return
+			}
+			delete(s.codes, params["code"])
+		case "refresh_token":
+			if !s.refreshTokens[params["refresh_token"]] {
+				writeError(w, http.StatusUnauthorized, "invalid_grant")
+				return
+			}
+		default:
+			writeError(w, http.StatusBadRequest, "unsupported_grant_type")
+			return
+		}
+		// SSO access tokens are only good for the exchange, so they are not
+		// accepted by the owner API
+		refreshToken := params["refresh_token"]
+		if refreshToken == "" {
+			refreshToken = s.newToken("refresh")
+			s.refreshTokens[refreshToken] = true
+		}
+		accessToken := s.newToken("sso")
+		s.ssoTokens[accessToken] = refreshToken
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  accessToken,
+			"refresh_token": refreshToken,
+			"token_type":    "Bearer",
+			"expires_in":    300,
+		})
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// Serves the Fleet API token endpoint, whose tokens are accepted by the API
+// without an exchange
+func (s *Server) serveFleetToken(w http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var token *tesla.Token
+	switch req.PostForm.Get("grant_type") {
+	case "refresh_token":
+		if !s.refreshTokens[req.PostForm.Get("refresh_token")] {
+			writeError(w, http.StatusUnauthorized, "invalid_grant")
+			return
+		}
+		token = s.ownerToken(req.PostForm.Get("refresh_token"))
+	case "client_credentials":
+		token = s.ownerToken("")
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token":  token.AccessToken,
+		"refresh_token": token.RefreshToken,
+		"token_type":    token.TokenType,
+		"expires_in":    token.ExpiresIn,
+	})
+}
+
+// Exchanges an SSO access token for an owner API token
+func (s *Server) serveOwnerToken(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.NotFound(w, req)
+		return
+	}
+	ssoToken := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refreshToken, ok := s.ssoTokens[ssoToken]
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "invalid bearer token")
+		return
+	}
+	delete(s.ssoTokens, ssoToken)
+	token := s.ownerToken(refreshToken)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": token.AccessToken,
+		"token_type":   token.TokenType,
+		"expires_in":   token.ExpiresIn,
+	})
+}
+
+// Computes the S256 PKCE code challenge for a code verifier
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
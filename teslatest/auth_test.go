@@ -0,0 +1,61 @@
+package teslatest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bogosj/tesla"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAuthSpec(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.AddVehicle(NewVehicle(1234, "5YJ3E1EA7KF000001"))
+
+	Convey("Should log in through SSO", t, func() {
+		client, err := tesla.NewClient(server.Auth(), server.Options()...)
+		So(err, ShouldBeNil)
+		So(client.Token.AccessToken, ShouldNotBeEmpty)
+		So(client.Token.RefreshToken, ShouldNotBeEmpty)
+		vehicles, err := client.Vehicles()
+		So(err, ShouldBeNil)
+		So(len(vehicles), ShouldEqual, 1)
+	})
+
+	Convey("Should reject wrong credentials", t, func() {
+		auth := server.Auth()
+		auth.Password = "wrong"
+		_, err := tesla.NewClient(auth, server.Options()...)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Should renew expired tokens", t, func() {
+		client, err := server.NewClient()
+		So(err, ShouldBeNil)
+		previous := client.Token.AccessToken
+		server.ExpireTokens()
+		_, err = client.Vehicles()
+		So(err, ShouldBeNil)
+		So(client.Token.AccessToken, ShouldNotEqual, previous)
+	})
+
+	Convey("Should renew Fleet API tokens", t, func() {
+		client, err := tesla.NewClientWithToken(server.Auth(), server.Token(), server.FleetOptions()...)
+		So(err, ShouldBeNil)
+		server.ExpireTokens()
+		vehicle, err := client.Vehicle(1234)
+		So(err, ShouldBeNil)
+		charge, err := vehicle.ChargeState()
+		So(err, ShouldBeNil)
+		So(charge.BatteryLevel, ShouldEqual, 80)
+	})
+
+	Convey("Should reject unknown tokens", t, func() {
+		client, err := tesla.NewClientWithToken(nil, &tesla.Token{AccessToken: "foo", Expires: time.Now().Add(8 * time.Hour).Unix()}, server.Options()...)
+		So(err, ShouldBeNil)
+		_, err = client.Vehicles()
+		So(errors.Is(err, tesla.ErrUnauthorized), ShouldBeTrue)
+	})
+}
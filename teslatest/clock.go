@@ -0,0 +1,32 @@
+package teslatest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a clock that only moves when advanced, making simulations of
+// vehicles deterministic. Assign its Now method to Server.Now.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a clock set to t
+func NewClock(t time.Time) *Clock {
+	return &Clock{now: t}
+}
+
+// Now returns the time of the clock
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,18 @@
+package teslatest
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClockSpec(t *testing.T) {
+	Convey("Should only move when advanced", t, func() {
+		start := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+		clock := NewClock(start)
+		So(clock.Now(), ShouldEqual, start)
+		clock.Advance(time.Hour)
+		So(clock.Now(), ShouldEqual, start.Add(time.Hour))
+	})
+}
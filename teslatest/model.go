@@ -0,0 +1,273 @@
+package teslatest
+
+import (
+	"math"
+	"time"
+
+	"github.com/bogosj/tesla"
+)
+
+// The interval at which the model is integrated
+const modelStep = time.Minute
+
+// Model simulates the physics of a vehicle, evolving its states with the time
+// of the server: the battery drains while driving and idling, charging tapers
+// off towards the charge limit, the cabin heats or cools towards the set
+// point and the vehicle falls asleep when left alone. The states are updated
+// whenever the server serves a request or Server.Update is called.
+type Model struct {
+	// Capacity is the usable energy of the battery in kWh
+	Capacity float64
+	// Efficiency is the rated range in miles per kWh
+	Efficiency float64
+	// IdlePower is the power drawn in kW while online
+	IdlePower float64
+	// SleepPower is the power drawn in kW while asleep
+	SleepPower float64
+	// ClimatePower is the power drawn in kW by the climate control
+	ClimatePower float64
+	// ChargerVoltage and ChargerCurrent are the voltage of the charger and
+	// the current it offers, which the charge current request may lower
+	ChargerVoltage float64
+	ChargerCurrent int
+	// TaperStart is the battery level in percent at which charging slows down
+	TaperStart float64
+	// ClimateRate is the change of the cabin temperature in °C per minute
+	// while the climate control is on
+	ClimateRate float64
+	// CoolDown is the time constant of the cabin temperature approaching the
+	// outside temperature while the climate control is off
+	CoolDown time.Duration
+	// SleepAfter is the time the vehicle stays online when left alone
+	SleepAfter time.Duration
+
+	energy       float64
+	updated      time.Time
+	lastActivity time.Time
+	online       bool
+}
+
+// NewModel returns a model of a long range vehicle charging from a wall connector
+func NewModel() *Model {
+	return &Model{
+		Capacity:       75,
+		Efficiency:     4,
+		IdlePower:      0.25,
+		SleepPower:     0.01,
+		ClimatePower:   2,
+		ChargerVoltage: 240,
+		ChargerCurrent: 32,
+		TaperStart:     80,
+		ClimateRate:    0.5,
+		CoolDown:       2 * time.Hour,
+		SleepAfter:     15 * time.Minute,
+	}
+}
+
+// Simulates the vehicle up to now
+func (v *Vehicle) advance(now time.Time) {
+	m := v.Model
+	if m == nil {
+		return
+	}
+	if m.updated.IsZero() {
+		m.updated, m.lastActivity = now, now
+		if v.ChargeState != nil {
+			m.energy = float64(v.ChargeState.BatteryLevel) / 100 * m.Capacity
+		}
+	}
+	// Vehicles brought online by the test count as active from then on
+	if online := v.State == StateOnline; online && !m.online {
+		m.lastActivity = m.updated
+	}
+	for m.updated.Before(now) {
+		dt := now.Sub(m.updated)
+		if dt > modelStep {
+			dt = modelStep
+		}
+		v.step(dt)
+		m.updated = m.updated.Add(dt)
+		if v.busy() {
+			m.lastActivity = m.updated
+		} else if v.State == StateOnline && m.updated.Sub(m.lastActivity) >= m.SleepAfter {
+			v.State = StateAsleep
+		}
+	}
+	m.online = v.State == StateOnline
+}
+
+// Records activity keeping the vehicle online
+func (v *Vehicle) touch(now time.Time) {
+	if v.Model != nil {
+		v.advance(now)
+		v.Model.lastActivity = now
+	}
+}
+
+// Indicates whether the vehicle is driving, charging or conditioning,
+// which keeps it online
+func (v *Vehicle) busy() bool {
+	return v.driving() || v.charging() ||
+		v.ClimateState != nil && v.ClimateState.IsClimateOn ||
+		v.VehicleState != nil && v.VehicleState.SentryMode
+}
+
+func (v *Vehicle) driving() bool {
+	return v.DriveState != nil && v.DriveState.Speed > 0
+}
+
+func (v *Vehicle) charging() bool {
+	return v.ChargeState != nil && v.ChargeState.ChargingState == "Charging"
+}
+
+// Advances the states of the vehicle by dt
+func (v *Vehicle) step(dt time.Duration) {
+	m := v.Model
+	hours := dt.Hours()
+	power := m.SleepPower
+	if v.State == StateOnline {
+		power = m.IdlePower
+	}
+	if v.ClimateState != nil {
+		v.stepClimate(dt)
+		if v.ClimateState.IsClimateOn {
+			power += m.ClimatePower
+		}
+	}
+	if v.driving() {
+		power += v.stepDrive(hours)
+	}
+	if v.charging() {
+		power -= v.stepCharge(hours)
+	}
+	m.energy = math.Max(0, math.Min(m.Capacity, m.energy-power*hours))
+	if v.ChargeState != nil {
+		level := m.energy / m.Capacity * 100
+		v.ChargeState.BatteryLevel = int(math.Round(level))
+		v.ChargeState.UsableBatteryLevel = v.ChargeState.BatteryLevel
+		v.ChargeState.BatteryRange = m.energy * m.Efficiency
+		v.ChargeState.IdealBatteryRange = v.ChargeState.BatteryRange
+		v.ChargeState.EstBatteryRange = v.ChargeState.BatteryRange * 0.9
+		if v.charging() && level >= float64(v.ChargeState.ChargeLimitSoc) {
+			v.ChargeState.ChargingState = "Complete"
+			v.stopCharger()
+		}
+	}
+}
+
+// Moves the vehicle along its heading, returning the power it takes
+func (v *Vehicle) stepDrive(hours float64) float64 {
+	d := v.DriveState
+	miles := d.Speed * hours
+	heading := float64(d.Heading) * math.Pi / 180
+	d.Latitude += miles / 69 * math.Cos(heading)
+	d.Longitude += miles / (69 * math.Cos(d.Latitude*math.Pi/180)) * math.Sin(heading)
+	d.GpsAsOf = v.Model.updated.Add(time.Duration(hours * float64(time.Hour))).Unix()
+	if v.VehicleState != nil {
+		v.VehicleState.Odometer += miles
+	}
+	power := d.Speed / v.Model.Efficiency
+	d.Power = int(math.Round(power))
+	return power
+}
+
+// Charges the battery, returning the power the charger delivers
+func (v *Vehicle) stepCharge(hours float64) float64 {
+	m, c := v.Model, v.ChargeState
+	current := m.ChargerCurrent
+	if c.ChargeCurrentRequest > 0 && c.ChargeCurrentRequest < current {
+		current = c.ChargeCurrentRequest
+	}
+	level := m.energy / m.Capacity * 100
+	taper := 1.0
+	if level > m.TaperStart {
+		taper = math.Max(0.1, (100-level)/(100-m.TaperStart))
+	}
+	actual := float64(current) * taper
+	power := actual * m.ChargerVoltage / 1000
+	kw := int(math.Round(power))
+	c.ChargerVoltage = tesla.NewNullInt(int(m.ChargerVoltage))
+	c.ChargerPilotCurrent = tesla.NewNullInt(m.ChargerCurrent)
+	c.ChargerActualCurrent = tesla.NewNullInt(int(math.Round(actual)))
+	c.ChargerPower = tesla.NewNullFloat(float64(kw))
+	c.ChargeRate = power * m.Efficiency
+	c.ChargeEnergyAdded += power * hours
+	c.ChargeMilesAddedRated += power * hours * m.Efficiency
+	c.ChargeMilesAddedIdeal = c.ChargeMilesAddedRated
+	remaining := math.Max(0, float64(c.ChargeLimitSoc)-level) / 100 * m.Capacity
+	c.TimeToFullCharge = math.Round(remaining/power*100) / 100
+	c.MinutesToFullCharge = int(remaining / power * 60)
+	if v.DriveState != nil {
+		v.DriveState.Power = -kw
+	}
+	return power
+}
+
+// Resets the values reported while charging
+func (v *Vehicle) stopCharger() {
+	c := v.ChargeState
+	c.ChargerActualCurrent = tesla.NewNullInt(0)
+	c.ChargerPower = tesla.NewNullFloat(0)
+	c.ChargeRate = 0
+	c.TimeToFullCharge = 0
+	c.MinutesToFullCharge = 0
+	if v.DriveState != nil && !v.driving() {
+		v.DriveState.Power = 0
+	}
+}
+
+// Moves the cabin temperature towards the set point while the climate
+// control is on, and towards the outside temperature otherwise
+func (v *Vehicle) stepClimate(dt time.Duration) {
+	c := v.ClimateState
+	if !c.IsClimateOn {
+		c.InsideTemp += (c.OutsideTemp - c.InsideTemp) * (1 - math.Exp(-float64(dt)/float64(v.Model.CoolDown)))
+		return
+	}
+	delta := c.DriverTempSetting - c.InsideTemp
+	change := v.Model.ClimateRate * dt.Minutes()
+	if math.Abs(delta) <= change {
+		c.InsideTemp = c.DriverTempSetting
+	} else {
+		c.InsideTemp += math.Copysign(change, delta)
+	}
+}
+
+// PlugIn connects the vehicle to the charger, which starts charging unless
+// the battery is at the charge limit
+func (v *Vehicle) PlugIn() {
+	c := v.ChargeState
+	c.ChargePortDoorOpen = true
+	c.ChargePortLatch = "Engaged"
+	c.ConnChargeCable = "SAE"
+	c.ChargingState = "Charging"
+	c.ChargeEnergyAdded = 0
+	c.ChargeMilesAddedRated = 0
+	c.ChargeMilesAddedIdeal = 0
+	if c.BatteryLevel >= c.ChargeLimitSoc {
+		c.ChargingState = "Complete"
+	}
+}
+
+// Unplug disconnects the vehicle from the charger
+func (v *Vehicle) Unplug() {
+	c := v.ChargeState
+	v.stopCharger()
+	c.ChargingState = "Disconnected"
+	c.ChargePortLatch = "Disengaged"
+	c.ConnChargeCable = "<invalid>"
+	c.ChargerVoltage = tesla.NullInt{}
+	c.ChargerPilotCurrent = tesla.NullInt{}
+}
+
+// Drive puts the vehicle in drive at the speed in mph, or parks it at 0
+func (v *Vehicle) Drive(speed float64) {
+	d := v.DriveState
+	d.Speed = speed
+	d.ShiftState = "D"
+	if speed <= 0 {
+		d.Speed = 0
+		d.ShiftState = "P"
+		d.Power = 0
+	}
+}
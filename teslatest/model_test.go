@@ -0,0 +1,168 @@
+package teslatest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bogosj/tesla"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestModelSpec(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	clock := NewClock(time.Date(2023, 11, 14, 22, 0, 0, 0, time.UTC))
+	server.Now = clock.Now
+	v := NewVehicle(1234, "5YJ3E1EA7KF000001")
+	v.Model = NewModel()
+	v.ChargeState.BatteryLevel = 50
+	v.ChargeState.ChargeLimitSoc = 90
+	server.AddVehicle(v)
+	client, err := server.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vehicle, err := client.Vehicle(1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	charge := func() *tesla.ChargeState {
+		state, err := vehicle.ChargeState()
+		So(err, ShouldBeNil)
+		return state
+	}
+
+	Convey("Should charge at the current of the charger", t, func() {
+		server.Update(v, func(v *Vehicle) { v.PlugIn() })
+		clock.Advance(time.Hour)
+		state := charge()
+		So(state.ChargingState, ShouldEqual, "Charging")
+		So(state.ChargerPower.Float64, ShouldEqual, 8)
+		// 7.68 kW for an hour less the idle drain adds 10% to 75 kWh
+		So(state.BatteryLevel, ShouldEqual, 60)
+		So(state.ChargeEnergyAdded, ShouldAlmostEqual, 7.68, 0.01)
+		So(state.MinutesToFullCharge, ShouldBeBetween, 170, 180)
+	})
+
+	Convey("Should honour the requested charge current", t, func() {
+		server.Update(v, func(v *Vehicle) {
+			So(v.apply("set_charging_amps", []byte(`{"charging_amps": 16}`)), ShouldBeNil)
+		})
+		before := charge().BatteryLevel
+		clock.Advance(time.Hour)
+		state := charge()
+		So(state.ChargerActualCurrent.Int, ShouldEqual, 16)
+		So(state.BatteryLevel-before, ShouldEqual, 5)
+	})
+
+	Convey("Should taper off and stop at the charge limit", t, func() {
+		clock.Advance(4 * time.Hour)
+		state := charge()
+		So(state.BatteryLevel, ShouldBeBetween, 80, 90)
+		So(state.ChargerActualCurrent.Int, ShouldBeLessThan, 16)
+		// Done charging, the vehicle falls asleep
+		clock.Advance(10 * time.Hour)
+		_, err := vehicle.ChargeState()
+		So(err, ShouldNotBeNil)
+		_, err = vehicle.Wakeup()
+		So(err, ShouldBeNil)
+		state = charge()
+		So(state.ChargingState, ShouldEqual, "Complete")
+		So(state.BatteryLevel, ShouldEqual, 90)
+		So(state.ChargerPower, ShouldResemble, tesla.NewNullFloat(0))
+	})
+
+	Convey("Should resume charging when the limit is raised", t, func() {
+		So(vehicle.SetChargeLimit(95), ShouldBeNil)
+		So(vehicle.StartCharging(), ShouldBeNil)
+		So(charge().ChargingState, ShouldEqual, "Charging")
+		server.Update(v, func(v *Vehicle) { v.Unplug() })
+		state := charge()
+		So(state.ChargingState, ShouldEqual, "Disconnected")
+		So(state.ChargerVoltage.Valid, ShouldBeFalse)
+	})
+
+	Convey("Should drain the battery while driving", t, func() {
+		var odometer float64
+		server.Update(v, func(v *Vehicle) {
+			odometer = v.VehicleState.Odometer
+			v.Drive(60)
+		})
+		before := charge()
+		clock.Advance(30 * time.Minute)
+		after := charge()
+		// 30 miles at 4 miles per kWh take 7.5 kWh, 10% of the battery
+		So(before.BatteryLevel-after.BatteryLevel, ShouldEqual, 10)
+		drive, err := vehicle.DriveState()
+		So(err, ShouldBeNil)
+		So(drive.Power, ShouldEqual, 15)
+		So(drive.Longitude, ShouldBeGreaterThan, -121.9447)
+		state, err := vehicle.VehicleState()
+		So(err, ShouldBeNil)
+		So(state.Odometer, ShouldAlmostEqual, odometer+30, 0.01)
+		server.Update(v, func(v *Vehicle) { v.Drive(0) })
+	})
+
+	Convey("Should condition the cabin towards the set point", t, func() {
+		server.Update(v, func(v *Vehicle) { v.ClimateState.InsideTemp = 10 })
+		So(vehicle.SetTemprature(22, 22), ShouldBeNil)
+		So(vehicle.StartAirConditioning(), ShouldBeNil)
+		clock.Advance(10 * time.Minute)
+		climate, err := vehicle.ClimateState()
+		So(err, ShouldBeNil)
+		So(climate.InsideTemp, ShouldAlmostEqual, 15, 0.01)
+		clock.Advance(time.Hour)
+		climate, err = vehicle.ClimateState()
+		So(err, ShouldBeNil)
+		So(climate.InsideTemp, ShouldEqual, 22)
+		So(vehicle.StopAirConditioning(), ShouldBeNil)
+		clock.Advance(2 * time.Hour)
+		server.Update(v, func(v *Vehicle) {
+			So(v.ClimateState.InsideTemp, ShouldBeBetween, 15, 22)
+		})
+	})
+
+	Convey("Should stay online while polled", t, func() {
+		_, err := vehicle.Wakeup()
+		So(err, ShouldBeNil)
+		for i := 0; i < 6; i++ {
+			clock.Advance(10 * time.Minute)
+			charge()
+		}
+	})
+
+	Convey("Should fall asleep when read letting it sleep", t, func() {
+		_, err := vehicle.Wakeup()
+		So(err, ShouldBeNil)
+		request := &tesla.VehicleDataRequest{Endpoints: []string{tesla.EndpointChargeState}, LetSleep: true}
+		for i := 0; i < 3; i++ {
+			clock.Advance(4 * time.Minute)
+			data, err := vehicle.VehicleData(request)
+			So(err, ShouldBeNil)
+			So(data.ChargeState, ShouldNotBeNil)
+		}
+		clock.Advance(4 * time.Minute)
+		_, err = vehicle.VehicleData(request)
+		So(errors.Is(err, tesla.ErrVehicleUnavailable), ShouldBeTrue)
+		_, err = vehicle.Wakeup()
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Should fall asleep when left alone and wake up", t, func() {
+		clock.Advance(16 * time.Minute)
+		_, err := vehicle.ChargeState()
+		So(err, ShouldNotBeNil)
+		level := 0
+		server.Update(v, func(v *Vehicle) {
+			So(v.State, ShouldEqual, StateAsleep)
+			level = v.ChargeState.BatteryLevel
+		})
+		clock.Advance(24 * time.Hour)
+		woken, err := vehicle.Wakeup()
+		So(err, ShouldBeNil)
+		So(woken.State, ShouldEqual, StateOnline)
+		// Asleep, the battery loses a fraction of a percent a day
+		So(level-charge().BatteryLevel, ShouldBeLessThanOrEqualTo, 1)
+	})
+}
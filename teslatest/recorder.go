@@ -0,0 +1,244 @@
+package teslatest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Mode selects whether a Recorder records or replays
+type Mode int
+
+const (
+	// ModeReplay serves the interactions of the cassette without network
+	ModeReplay Mode = iota
+	// ModeRecord sends the requests and records the interactions
+	ModeRecord
+)
+
+// Cassette holds recorded interactions with the API
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request and its response
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a recorded request. Requests are matched by method and
+// path in the order they were recorded.
+type RecordedRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+// RecordedResponse is a recorded response. For streams, Body holds what the
+// client read before it closed the connection.
+type RecordedResponse struct {
+	StatusCode int               `json:"status_code"`
+	Header     map[string]string `json:"header,omitempty"`
+	Body       string            `json:"body"`
+}
+
+// The response headers that are recorded
+var recordedHeaders = []string{"Content-Type", "Location", "Retry-After"}
+
+// Recorder is an http.RoundTripper that records the interactions with the
+// API to a cassette file, redacting tokens, VINs, e-mail addresses and
+// coordinates, and replays them in tests:
+//
+//	recorder, err := teslatest.NewRecorder("testdata/session.json", teslatest.ModeReplay)
+//	client, err := tesla.NewClientWithToken(auth, token, tesla.WithHTTPClient(recorder.Client()))
+type Recorder struct {
+	// Path is the cassette file
+	Path string
+	Mode Mode
+	// Transport sends the requests while recording, http.DefaultTransport if nil
+	Transport http.RoundTripper
+
+	mu       sync.Mutex
+	cassette *Cassette
+	used     []bool
+	redactor *redactor
+}
+
+// NewRecorder returns a recorder of the cassette file, which is loaded when replaying
+func NewRecorder(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{Path: path, Mode: mode, cassette: &Cassette{}, redactor: newRedactor()}
+	if mode == ModeReplay {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, r.cassette); err != nil {
+			return nil, err
+		}
+		r.used = make([]bool, len(r.cassette.Interactions))
+	}
+	return r, nil
+}
+
+// Client returns an HTTP client using the recorder, to be passed to
+// tesla.WithHTTPClient
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Save writes the recorded interactions to the cassette file. The bodies of
+// responses are recorded once the client read them to the end or closed
+// them, which for streams is when the client stops reading.
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.Path, data, 0644)
+}
+
+// RoundTrip records or replays a request
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if r.Mode == ModeReplay {
+		return r.replay(req)
+	}
+	return r.record(req)
+}
+
+// Returns whether a request is for the streaming endpoint
+func isStream(req *http.Request) bool {
+	return strings.HasPrefix(req.URL.Path, "/stream/")
+}
+
+// Sends the request and records the interaction, whose response body is
+// filled in once the client read or closed it
+func (r *Recorder) record(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	interaction := &Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    r.redactor.redact(req.URL.String()),
+			Body:   r.redactor.redact(string(body)),
+		},
+		Response: RecordedResponse{StatusCode: res.StatusCode, Header: map[string]string{}},
+	}
+	for _, name := range recordedHeaders {
+		if value := res.Header.Get(name); value != "" {
+			interaction.Response.Header[name] = r.redactor.redact(value)
+		}
+	}
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.mu.Unlock()
+	res.Body = &recordingBody{ReadCloser: res.Body, done: func(body []byte) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if isStream(req) {
+			interaction.Response.Body = r.redactor.redactStream(string(body))
+		} else {
+			interaction.Response.Body = r.redactor.redact(string(body))
+		}
+	}}
+	return res, nil
+}
+
+// Captures what the client reads from a response body
+type recordingBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	once sync.Once
+	done func(body []byte)
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+// Records the body read so far, once
+func (b *recordingBody) finish() {
+	b.once.Do(func() { b.done(b.buf.Bytes()) })
+}
+
+// Serves the first unused interaction with the method and path of the request
+func (r *Recorder) replay(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	path := r.redactor.redact(req.URL.Path)
+	for i, interaction := range r.cassette.Interactions {
+		recorded, err := url.Parse(interaction.Request.URL)
+		if r.used[i] || err != nil || interaction.Request.Method != req.Method || recorded.Path != path {
+			continue
+		}
+		r.used[i] = true
+		res := &http.Response{
+			Status:        strconv.Itoa(interaction.Response.StatusCode) + " " + http.StatusText(interaction.Response.StatusCode),
+			StatusCode:    interaction.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{},
+			Body:          ioutil.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}
+		for name, value := range interaction.Response.Header {
+			res.Header.Set(name, value)
+		}
+		replaceState(req, res)
+		return res, nil
+	}
+	return nil, errors.New("teslatest: no recorded response for " + req.Method + " " + path)
+}
+
+// Passes the state of an SSO authorize request on to its redirect, as the
+// login checks it against the random state it sent
+func replaceState(req *http.Request, res *http.Response) {
+	state := req.URL.Query().Get("state")
+	location, err := url.Parse(res.Header.Get("Location"))
+	if state == "" || err != nil || location.Query().Get("state") == "" {
+		return
+	}
+	q := location.Query()
+	q.Set("state", state)
+	location.RawQuery = q.Encode()
+	res.Header.Set("Location", location.String())
+}
@@ -0,0 +1,117 @@
+package teslatest
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bogosj/tesla"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// The results of a session against the API
+type session struct {
+	client   *tesla.Client
+	vehicle  *tesla.Vehicle
+	charge   *tesla.ChargeState
+	drive    *tesla.DriveState
+	streamed []*tesla.StreamEvent
+}
+
+// Runs a session against the API through the HTTP client
+func recordSession(options []tesla.ClientOption, auth *tesla.Auth) (*session, error) {
+	s := &session{}
+	var err error
+	if s.client, err = tesla.NewClient(auth, options...); err != nil {
+		return nil, err
+	}
+	vehicles, err := s.client.Vehicles()
+	if err != nil {
+		return nil, err
+	}
+	s.vehicle = vehicles[0]
+	if s.charge, err = s.vehicle.ChargeState(); err != nil {
+		return nil, err
+	}
+	if s.drive, err = s.vehicle.DriveState(); err != nil {
+		return nil, err
+	}
+	if err := s.vehicle.LockDoors(); err != nil {
+		return nil, err
+	}
+	events, errs, err := s.vehicle.Stream()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		select {
+		case event := <-events:
+			s.streamed = append(s.streamed, event)
+		case <-errs:
+			return s, nil
+		}
+	}
+}
+
+func TestRecorderSpec(t *testing.T) {
+	server := NewServer()
+	v := NewVehicle(1234, "5YJ3E1EA7KF000001")
+	v.StreamEvents = []*tesla.StreamEvent{
+		{Timestamp: time.Unix(1700000000, 0), Speed: 65, Soc: 79, ShiftState: "D", EstLat: 37.49, EstLng: -121.94},
+	}
+	server.AddVehicle(v)
+	server.Password = "s3cret"
+	path := filepath.Join(t.TempDir(), "session.json")
+
+	Convey("Should record a session with the secrets redacted", t, func() {
+		recorder, err := NewRecorder(path, ModeRecord)
+		So(err, ShouldBeNil)
+		options := append(server.Options(), tesla.WithHTTPClient(recorder.Client()))
+		s, err := recordSession(options, server.Auth())
+		So(err, ShouldBeNil)
+		So(s.vehicle.Vin, ShouldEqual, "5YJ3E1EA7KF000001")
+		So(s.charge.BatteryLevel, ShouldEqual, 80)
+		So(len(s.streamed), ShouldEqual, 1)
+		So(recorder.Save(), ShouldBeNil)
+
+		data, err := ioutil.ReadFile(path)
+		So(err, ShouldBeNil)
+		cassette := string(data)
+		So(cassette, ShouldContainSubstring, "/api/1/vehicles/1234/data_request/charge_state")
+		So(cassette, ShouldContainSubstring, "VIN00000000000001")
+		So(cassette, ShouldNotContainSubstring, "5YJ3E1EA7KF000001")
+		So(cassette, ShouldNotContainSubstring, server.Email)
+		So(cassette, ShouldNotContainSubstring, server.Password)
+		So(cassette, ShouldNotContainSubstring, s.client.Token.AccessToken)
+		So(cassette, ShouldNotContainSubstring, s.client.Token.RefreshToken)
+		So(cassette, ShouldNotContainSubstring, "stream1234")
+		So(cassette, ShouldNotContainSubstring, "37.49")
+	})
+
+	server.Close()
+
+	Convey("Should replay the session without the server", t, func() {
+		recorder, err := NewRecorder(path, ModeReplay)
+		So(err, ShouldBeNil)
+		options := append(server.Options(), tesla.WithHTTPClient(recorder.Client()))
+		s, err := recordSession(options, server.Auth())
+		So(err, ShouldBeNil)
+		So(s.vehicle.Vin, ShouldEqual, "VIN00000000000001")
+		So(s.charge.BatteryLevel, ShouldEqual, 80)
+		So(s.drive.Latitude, ShouldEqual, 0)
+		So(len(s.streamed), ShouldEqual, 1)
+		So(s.streamed[0].Speed, ShouldEqual, 65)
+		So(s.streamed[0].EstLat, ShouldEqual, 0)
+
+		Convey("Should fail requests that were not recorded", func() {
+			_, err := recorder.Client().Get(server.URL + "/api/1/vehicles/1234/data_request/climate_state")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Should fail to replay a missing cassette", t, func() {
+		_, err := NewRecorder(filepath.Join(t.TempDir(), "missing.json"), ModeReplay)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,73 @@
+package teslatest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The placeholders of redacted values
+const (
+	redacted      = "REDACTED"
+	redactedEmail = "user@example.com"
+)
+
+var (
+	vinRegexp   = regexp.MustCompile(`\b[A-HJ-NPR-Z0-9]{17}\b`)
+	emailRegexp = regexp.MustCompile(`[A-Za-z0-9._+-]+(@|%40)[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	// Secrets in JSON bodies and forms
+	secretJSONRegexp = regexp.MustCompile(`"(access_token|refresh_token|id_token|client_secret|password|credential|code|code_verifier)"(\s*:\s*)"[^"]*"`)
+	tokensJSONRegexp = regexp.MustCompile(`"tokens"(\s*:\s*)\[[^\]]*\]`)
+	secretFormRegexp = regexp.MustCompile(`\b(access_token|refresh_token|client_secret|password|credential|code|code_verifier)=[^&\s"]*`)
+	// Coordinates in JSON bodies
+	coordinateRegexp = regexp.MustCompile(`"(latitude|longitude|native_latitude|native_longitude|corrected_latitude|corrected_longitude|est_lat|est_lng|lat|lon)"(\s*:\s*)-?[0-9.eE+-]+`)
+)
+
+// Replaces the VINs, e-mail addresses, tokens and coordinates of the
+// recorded requests and responses. VINs are replaced consistently, so that
+// the requests for a vehicle still match in replay.
+type redactor struct {
+	vins map[string]string
+}
+
+func newRedactor() *redactor {
+	return &redactor{vins: map[string]string{}}
+}
+
+// Returns the placeholder of a VIN. Numbers, such as the IDs of vehicles,
+// are kept.
+func (r *redactor) vin(vin string) string {
+	if strings.Trim(vin, "0123456789") == "" {
+		return vin
+	}
+	placeholder, ok := r.vins[vin]
+	if !ok {
+		placeholder = fmt.Sprintf("VIN%014d", len(r.vins)+1)
+		r.vins[vin] = placeholder
+	}
+	return placeholder
+}
+
+// Redacts a URL or body
+func (r *redactor) redact(s string) string {
+	s = vinRegexp.ReplaceAllStringFunc(s, r.vin)
+	s = emailRegexp.ReplaceAllString(s, redactedEmail)
+	s = secretJSONRegexp.ReplaceAllString(s, `"$1"$2"`+redacted+`"`)
+	s = tokensJSONRegexp.ReplaceAllString(s, `"tokens"$1["`+redacted+`"]`)
+	s = secretFormRegexp.ReplaceAllString(s, "$1="+redacted)
+	return coordinateRegexp.ReplaceAllString(s, `"$1"${2}0`)
+}
+
+// Redacts the lines of a stream, whose seventh and eighth values are the
+// coordinates of the vehicle
+func (r *redactor) redactStream(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		values := strings.Split(line, ",")
+		if len(values) == 13 {
+			values[6], values[7] = "0", "0"
+		}
+		lines[i] = strings.Join(values, ",")
+	}
+	return r.redact(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,30 @@
+package teslatest
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRedactSpec(t *testing.T) {
+	Convey("Should replace VINs consistently and keep IDs", t, func() {
+		r := newRedactor()
+		So(r.redact(`{"id":12345678901234567,"vin":"5YJ3E1EA7KF000001"}`), ShouldEqual, `{"id":12345678901234567,"vin":"VIN00000000000001"}`)
+		So(r.redact("/api/1/vehicles/5YJ3E1EA7KF000002/vehicle_data"), ShouldEqual, "/api/1/vehicles/VIN00000000000002/vehicle_data")
+		So(r.redact("5YJ3E1EA7KF000001"), ShouldEqual, "VIN00000000000001")
+	})
+
+	Convey("Should redact e-mail addresses and secrets", t, func() {
+		r := newRedactor()
+		So(r.redact("identity=elon%40tesla.com&credential=go&transaction_id=tx1"), ShouldEqual, "identity=user@example.com&credential=REDACTED&transaction_id=tx1")
+		So(r.redact(`{"access_token": "abc", "refresh_token":"def", "tokens":["1","2"], "token_type":"bearer"}`), ShouldEqual,
+			`{"access_token": "REDACTED", "refresh_token":"REDACTED", "tokens":["REDACTED"], "token_type":"bearer"}`)
+	})
+
+	Convey("Should redact coordinates", t, func() {
+		r := newRedactor()
+		So(r.redact(`{"latitude":37.4925,"longitude":-121.9447,"heading":90}`), ShouldEqual, `{"latitude":0,"longitude":0,"heading":90}`)
+		So(r.redactStream("1700000000000,65,12345.6,79,10,90,37.49,-121.94,20,D,200,190,90\n"), ShouldEqual,
+			"1700000000000,65,12345.6,79,10,90,0,0,20,D,200,190,90\n")
+	})
+}
@@ -0,0 +1,321 @@
+// Package teslatest provides a fake of the Tesla API for tests of code built
+// on the tesla package. The Server serves the SSO login, the owner API token
+// exchange, the vehicle, state, command and wake_up endpoints and the
+// streaming endpoint, for vehicles that tests script and inspect.
+//
+//	server := teslatest.NewServer()
+//	defer server.Close()
+//	vehicle := server.AddVehicle(teslatest.NewVehicle(1234, "5YJ3E1EA7KF000001"))
+//	client, err := server.NewClient()
+//	...
+//	server.AssertCommands(t, "door_lock")
+package teslatest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bogosj/tesla"
+)
+
+// Failure makes the server fail requests, e.g. with 429 Too Many Requests
+type Failure struct {
+	// Path is the suffix of the paths of the failing requests, all requests if empty
+	Path string
+	// Times is the number of requests failing, 1 if 0
+	Times int
+	// Status is the status of the responses, 500 if 0
+	Status int
+	// Message is the error reported in the response body
+	Message string
+	// RetryAfter sets the Retry-After header of the responses
+	RetryAfter time.Duration
+}
+
+// Command is a command received by the server
+type Command struct {
+	VehicleID int64
+	VIN       string
+	// Name is the name of the command endpoint, e.g. "door_lock"
+	Name string
+	// Params is the body of the request
+	Params []byte
+	Time   time.Time
+}
+
+// Server is a fake of the Tesla API. Its methods may be called concurrently
+// with the requests it serves.
+type Server struct {
+	*httptest.Server
+
+	// Email and Password are the credentials accepted by the SSO login
+	Email    string
+	Password string
+	// Now returns the time the vehicles are simulated up to, time.Now if nil.
+	// Set it to the Now method of a Clock before serving requests.
+	Now func() time.Time
+
+	mu            sync.Mutex
+	vehicles      []*Vehicle
+	commands      []Command
+	requests      []string
+	failures      []*Failure
+	accessTokens  map[string]bool
+	refreshTokens map[string]bool
+	codes         map[string]string
+	ssoTokens     map[string]string
+	counter       int
+}
+
+// NewServer starts a fake of the Tesla API without vehicles
+func NewServer() *Server {
+	s := &Server{
+		Email:         "elon@tesla.com",
+		Password:      "password",
+		accessTokens:  map[string]bool{},
+		refreshTokens: map[string]bool{},
+		codes:         map[string]string{},
+		ssoTokens:     map[string]string{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Options returns the options pointing a client at the server
+func (s *Server) Options() []tesla.ClientOption {
+	return []tesla.ClientOption{
+		tesla.WithBaseURL(s.URL + "/api/1"),
+		tesla.WithAuthURL(s.URL + "/oauth/token"),
+		tesla.WithSSOURL(s.URL + "/oauth2/v3"),
+		tesla.WithStreamingURL(s.URL),
+	}
+}
+
+// FleetOptions returns the options pointing a Fleet API client at the server
+func (s *Server) FleetOptions() []tesla.ClientOption {
+	return []tesla.ClientOption{
+		tesla.WithFleetAPI(),
+		tesla.WithBaseURL(s.URL + "/api/1"),
+		tesla.WithFleetAuthURL(s.URL + "/oauth2/v3"),
+	}
+}
+
+// Auth returns the credentials accepted by the server
+func (s *Server) Auth() *tesla.Auth {
+	return &tesla.Auth{
+		ClientID:     "ownerapi",
+		ClientSecret: "secret",
+		Email:        s.Email,
+		Password:     s.Password,
+	}
+}
+
+// NewClient returns a client of the server holding a valid token
+func (s *Server) NewClient(options ...tesla.ClientOption) (*tesla.Client, error) {
+	return tesla.NewClientWithToken(s.Auth(), s.Token(), append(s.Options(), options...)...)
+}
+
+// Returns a new unique token with the prefix. The caller holds s.mu.
+func (s *Server) newToken(prefix string) string {
+	s.counter++
+	return prefix + strconv.Itoa(s.counter)
+}
+
+// Token issues a valid owner API token, renewable with its refresh token
+func (s *Server) Token() *tesla.Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ownerToken(s.newToken("refresh"))
+}
+
+// Issues an owner API token keeping the refresh token. The caller holds s.mu.
+func (s *Server) ownerToken(refreshToken string) *tesla.Token {
+	token := &tesla.Token{
+		AccessToken:  s.newToken("access"),
+		RefreshToken: refreshToken,
+		TokenType:    "bearer",
+		ExpiresIn:    3600 * 8,
+		Expires:      time.Now().Add(8 * time.Hour).Unix(),
+	}
+	s.accessTokens[token.AccessToken] = true
+	if refreshToken != "" {
+		s.refreshTokens[refreshToken] = true
+	}
+	return token
+}
+
+// ExpireTokens rejects the access tokens issued so far, so that clients
+// have to renew them
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessTokens = map[string]bool{}
+}
+
+// AddVehicle adds a vehicle to the account and returns it
+func (s *Server) AddVehicle(v *Vehicle) *Vehicle {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.vehicles = append(s.vehicles, v)
+	return v
+}
+
+// Update calls f with the vehicle locked, so that tests can change it while
+// requests are served. The vehicle is simulated up to the current time first.
+func (s *Server) Update(v *Vehicle, f func(v *Vehicle)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v.advance(s.now())
+	f(v)
+}
+
+// Returns the current time of the server
+func (s *Server) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// Fail makes the server fail the next requests matching the failure
+func (s *Server) Fail(f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f.Times == 0 {
+		f.Times = 1
+	}
+	if f.Status == 0 {
+		f.Status = http.StatusInternalServerError
+	}
+	s.failures = append(s.failures, &f)
+}
+
+// Commands returns the commands received so far, including those rejected
+// because the vehicle was unavailable or in service
+func (s *Server) Commands() []Command {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Command(nil), s.commands...)
+}
+
+// Requests returns the method and path of the requests received so far,
+// e.g. "POST /api/1/vehicles/1234/wake_up"
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Reset forgets the commands and requests received so far
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = nil
+	s.requests = nil
+}
+
+// AssertCommands reports an error unless the server received exactly the
+// commands with the names, in order
+func (s *Server) AssertCommands(t testing.TB, names ...string) {
+	t.Helper()
+	var received []string
+	for _, c := range s.Commands() {
+		received = append(received, c.Name)
+	}
+	if strings.Join(received, ",") != strings.Join(names, ",") {
+		t.Errorf("teslatest: received commands %q, expected %q", received, names)
+	}
+}
+
+// AssertNoCommands reports an error if the server received any command
+func (s *Server) AssertNoCommands(t testing.TB) {
+	t.Helper()
+	s.AssertCommands(t)
+}
+
+// Returns the failure of a request, if any. The caller holds s.mu.
+func (s *Server) failure(path string) *Failure {
+	for i, f := range s.failures {
+		if strings.HasSuffix(path, f.Path) {
+			if f.Times--; f.Times == 0 {
+				s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			}
+			return f
+		}
+	}
+	return nil
+}
+
+// Writes an error response in the format of the API
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"response":          nil,
+		"error":             message,
+		"error_description": "",
+	})
+}
+
+// Writes a response wrapping the value, as the API does
+func writeResponse(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"response": v})
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	now := s.now()
+	for _, v := range s.vehicles {
+		v.advance(now)
+	}
+	s.requests = append(s.requests, req.Method+" "+req.URL.Path)
+	f := s.failure(req.URL.Path)
+	s.mu.Unlock()
+	if f != nil {
+		if f.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(f.RetryAfter/time.Second)))
+		}
+		writeError(w, f.Status, f.Message)
+		return
+	}
+	switch {
+	case strings.HasPrefix(req.URL.Path, "/oauth2/v3/"):
+		s.serveSSO(w, req)
+	case req.URL.Path == "/oauth/token":
+		s.serveOwnerToken(w, req)
+	case strings.HasPrefix(req.URL.Path, "/stream/"):
+		s.serveStream(w, req)
+	case strings.HasPrefix(req.URL.Path, "/api/1/"):
+		if !s.authorized(req) {
+			writeError(w, http.StatusUnauthorized, "invalid bearer token")
+			return
+		}
+		s.serveAPI(w, req)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// Indicates whether a request carries a valid access token
+func (s *Server) authorized(req *http.Request) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accessTokens[strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")]
+}
+
+// Returns the vehicle with the ID or VIN. The caller holds s.mu.
+func (s *Server) vehicle(id string) *Vehicle {
+	for _, v := range s.vehicles {
+		if strconv.FormatInt(v.ID, 10) == id || v.Vin == id {
+			return v
+		}
+	}
+	return nil
+}
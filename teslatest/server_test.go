@@ -0,0 +1,67 @@
+package teslatest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bogosj/tesla"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// Records the errors reported to a test
+type recorder struct {
+	testing.TB
+	errors int
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors++
+}
+
+func TestServerSpec(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.AddVehicle(NewVehicle(1234, "5YJ3E1EA7KF000001"))
+	client, err := server.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("Should fail scripted requests", t, func() {
+		server.Fail(Failure{Path: "/vehicles", Times: 2, Status: 429, RetryAfter: 30 * time.Second})
+		for i := 0; i < 2; i++ {
+			_, err := client.Vehicles()
+			So(errors.Is(err, tesla.ErrRateLimited), ShouldBeTrue)
+			var apiErr *tesla.APIError
+			So(errors.As(err, &apiErr), ShouldBeTrue)
+			So(apiErr.RetryAfter, ShouldEqual, 30*time.Second)
+		}
+		_, err := client.Vehicles()
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Should record the requests", t, func() {
+		server.Reset()
+		client.Vehicles()
+		So(server.Requests(), ShouldResemble, []string{"GET /api/1/vehicles"})
+	})
+
+	Convey("Should assert the commands received", t, func() {
+		server.Reset()
+		vehicle, err := client.Vehicle(1234)
+		So(err, ShouldBeNil)
+		So(vehicle.LockDoors(), ShouldBeNil)
+		So(vehicle.HonkHorn(), ShouldBeNil)
+		r := &recorder{}
+		server.AssertCommands(r, "door_lock", "honk_horn")
+		So(r.errors, ShouldEqual, 0)
+		server.AssertCommands(r, "honk_horn")
+		So(r.errors, ShouldEqual, 1)
+		server.AssertNoCommands(r)
+		So(r.errors, ShouldEqual, 2)
+		So(server.Commands()[0].VIN, ShouldEqual, "5YJ3E1EA7KF000001")
+	})
+}
@@ -0,0 +1,42 @@
+package teslatest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bogosj/tesla"
+)
+
+// Serves the streaming endpoint, writing the stream events of the vehicle as
+// lines of comma separated values
+func (s *Server) serveStream(w http.ResponseWriter, req *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(req.URL.Path, "/stream/"), "/")
+	email, token, _ := req.BasicAuth()
+	s.mu.Lock()
+	var v *Vehicle
+	for _, vehicle := range s.vehicles {
+		if strconv.FormatUint(vehicle.VehicleID, 10) == id {
+			v = vehicle
+		}
+	}
+	if v == nil {
+		s.mu.Unlock()
+		http.NotFound(w, req)
+		return
+	}
+	authorized := email == s.Email && len(v.Tokens) > 0 && token == v.Tokens[0]
+	events := append([]*tesla.StreamEvent(nil), v.StreamEvents...)
+	s.mu.Unlock()
+	if !authorized {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	for _, e := range events {
+		fmt.Fprintf(w, "%d,%d,%g,%d,%d,%d,%g,%g,%d,%s,%d,%d,%d\n",
+			e.Timestamp.UnixNano()/1e6, e.Speed, e.Odometer, e.Soc, e.Elevation, e.EstHeading,
+			e.EstLat, e.EstLng, e.Power, e.ShiftState, e.Range, e.EstRange, e.Heading)
+	}
+}
@@ -0,0 +1,39 @@
+package teslatest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bogosj/tesla"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStreamSpec(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	v := NewVehicle(1234, "5YJ3E1EA7KF000001")
+	v.StreamEvents = []*tesla.StreamEvent{
+		{Timestamp: time.Unix(1700000000, 0), Speed: 65, Odometer: 12345.6, Soc: 79, ShiftState: "D", EstLat: 37.49, EstLng: -121.94},
+		{Timestamp: time.Unix(1700000001, 0), Speed: 64, Odometer: 12345.7, Soc: 79, ShiftState: "D"},
+	}
+	server.AddVehicle(v)
+	client, err := server.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("Should stream the events of the vehicle", t, func() {
+		vehicle, err := client.Vehicle(1234)
+		So(err, ShouldBeNil)
+		events, errs, err := vehicle.Stream()
+		So(err, ShouldBeNil)
+		event := <-events
+		So(event.Timestamp.Unix(), ShouldEqual, 1700000000)
+		So(event.Speed, ShouldEqual, 65)
+		So(event.Odometer, ShouldEqual, 12345.6)
+		So(event.ShiftState, ShouldEqual, "D")
+		So(event.EstLat, ShouldEqual, 37.49)
+		So((<-events).Speed, ShouldEqual, 64)
+		So((<-errs).Error(), ShouldEqual, "HTTP stream closed")
+	})
+}
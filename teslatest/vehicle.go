@@ -0,0 +1,406 @@
+package teslatest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bogosj/tesla"
+)
+
+// The states of a vehicle as reported by the API
+const (
+	StateOnline  = tesla.StateOnline
+	StateAsleep  = tesla.StateAsleep
+	StateOffline = tesla.StateOffline
+)
+
+// Vehicle is a vehicle of the fake account. Change it through Server.Update
+// once the server serves it.
+type Vehicle struct {
+	// Vehicle is returned by the vehicles endpoints. Its State is "online",
+	// "asleep" or "offline", and vehicles in service reject commands.
+	tesla.Vehicle
+
+	// The states returned by the data_request and vehicle_data endpoints
+	ChargeState  *tesla.ChargeState
+	ClimateState *tesla.ClimateState
+	DriveState   *tesla.DriveState
+	GuiSettings  *tesla.GuiSettings
+	VehicleState *tesla.VehicleState
+	ServiceData  *tesla.ServiceData
+
+	// Latency delays the responses to the requests for the vehicle
+	Latency time.Duration
+	// WakeAfter is the number of wake_up requests an asleep vehicle answers
+	// before it comes online
+	WakeAfter int
+	// Command, if set, is called for each command sent to the online vehicle
+	// before its default effect. Returning a *tesla.CommandError fails the
+	// command with its reason, other errors fail the request.
+	Command func(name string, params []byte) error
+	// StreamEvents are written to the streaming endpoint, which then closes
+	StreamEvents []*tesla.StreamEvent
+	// Model, if set, simulates the vehicle over time. Without a model the
+	// states only change through commands and tests.
+	Model *Model
+
+	wakeups int
+}
+
+// NewVehicle returns an online vehicle with plausible states, parked and
+// locked with its battery at 80%
+func NewVehicle(id int64, vin string) *Vehicle {
+	now := time.Now()
+	return &Vehicle{
+		Vehicle: tesla.Vehicle{
+			ID:          id,
+			VehicleID:   uint64(id) * 10,
+			Vin:         vin,
+			DisplayName: "Test Vehicle",
+			State:       StateOnline,
+			Tokens:      []string{"stream" + strconv.FormatInt(id, 10)},
+			AccessType:  "OWNER",
+			APIVersion:  67,
+		},
+		ChargeState: &tesla.ChargeState{
+			ChargingState:        "Disconnected",
+			ChargeLimitSoc:       90,
+			BatteryLevel:         80,
+			UsableBatteryLevel:   80,
+			BatteryRange:         240,
+			EstBatteryRange:      220,
+			IdealBatteryRange:    240,
+			ChargeCurrentRequest: 32,
+		},
+		ClimateState: &tesla.ClimateState{
+			InsideTemp:           20,
+			OutsideTemp:          15,
+			DriverTempSetting:    21,
+			PassengerTempSetting: 21,
+		},
+		DriveState: &tesla.DriveState{
+			ShiftState: "P",
+			Latitude:   37.4925,
+			Longitude:  -121.9447,
+			Heading:    90,
+			GpsAsOf:    now.Unix(),
+		},
+		GuiSettings: &tesla.GuiSettings{
+			GuiDistanceUnits:    "mi/hr",
+			GuiTemperatureUnits: "F",
+			GuiChargeRateUnits:  "mi/hr",
+		},
+		VehicleState: &tesla.VehicleState{
+			CarVersion:  "2023.44.30",
+			Locked:      true,
+			Odometer:    12345.6,
+			VehicleName: "Test Vehicle",
+		},
+		ServiceData: &tesla.ServiceData{
+			ServiceStatus: "not_in_service",
+		},
+	}
+}
+
+// The states of the vehicle data by the name of the endpoint selecting them
+func (v *Vehicle) states() map[string]interface{} {
+	return map[string]interface{}{
+		"charge_state":  v.ChargeState,
+		"climate_state": v.ClimateState,
+		"drive_state":   v.DriveState,
+		"gui_settings":  v.GuiSettings,
+		"vehicle_state": v.VehicleState,
+	}
+}
+
+// Returns the vehicle data, restricted to the states of the endpoints
+// separated by semicolons if any
+func (v *Vehicle) data(endpoints string) map[string]interface{} {
+	data := map[string]interface{}{}
+	b, _ := json.Marshal(&v.Vehicle)
+	json.Unmarshal(b, &data)
+	if !selected(endpoints, "vehicle_config") {
+		delete(data, "vehicle_config")
+	}
+	for name, state := range v.states() {
+		if selected(endpoints, name) {
+			data[name] = state
+		}
+	}
+	return data
+}
+
+// Indicates whether the endpoints separated by semicolons, all if empty,
+// select the named one
+func selected(endpoints, name string) bool {
+	return endpoints == "" || strings.Contains(";"+endpoints+";", ";"+name+";")
+}
+
+// Waits for the latency of the vehicle, returning false if the request is
+// canceled in the meantime
+func wait(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Serves the vehicle endpoints of the owner API and the Fleet API
+func (s *Server) serveAPI(w http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, "/api/1/"), "/"), "/")
+	if len(parts) == 1 && parts[0] == "vehicles" && req.Method == "GET" {
+		s.mu.Lock()
+		vehicles := make([]tesla.Vehicle, len(s.vehicles))
+		for i, v := range s.vehicles {
+			vehicles[i] = v.Vehicle
+		}
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"response": vehicles, "count": len(vehicles)})
+		return
+	}
+	if len(parts) < 2 || parts[0] != "vehicles" {
+		http.NotFound(w, req)
+		return
+	}
+
+	s.mu.Lock()
+	v := s.vehicle(parts[1])
+	var latency time.Duration
+	if v != nil {
+		latency = v.Latency
+	}
+	s.mu.Unlock()
+	if v == nil {
+		writeError(w, http.StatusNotFound, "not_found")
+		return
+	}
+	if !wait(req.Context(), latency) {
+		return
+	}
+
+	endpoint := strings.Join(parts[2:], "/")
+	switch {
+	case endpoint == "" && req.Method == "GET":
+		s.mu.Lock()
+		vehicle := v.Vehicle
+		s.mu.Unlock()
+		writeResponse(w, &vehicle)
+	case endpoint == "wake_up" && req.Method == "POST":
+		s.serveWakeup(w, v)
+	case strings.HasPrefix(endpoint, "command/") && req.Method == "POST":
+		s.serveCommand(w, req, v, strings.TrimPrefix(endpoint, "command/"))
+	case req.Method == "GET":
+		s.serveState(w, req, v, endpoint)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// Writes the error returned by the API for a vehicle that is not online, if
+// it is not. The caller holds s.mu.
+func unavailable(w http.ResponseWriter, v *Vehicle) bool {
+	if v.State == StateOnline {
+		return false
+	}
+	writeError(w, http.StatusRequestTimeout, "vehicle unavailable: {:error=>\"vehicle unavailable:\"}")
+	return true
+}
+
+// Serves the states of the vehicle
+func (s *Server) serveState(w http.ResponseWriter, req *http.Request, v *Vehicle, endpoint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var response interface{}
+	switch endpoint {
+	case "mobile_enabled":
+		if unavailable(w, v) {
+			return
+		}
+		v.touch(s.now())
+		response = true
+	case "service_data", "data_request/service_data":
+		response = v.ServiceData
+	case "vehicle_data":
+		if unavailable(w, v) {
+			return
+		}
+		// Requests letting the vehicle sleep do not keep it online
+		if req.URL.Query().Get("let_sleep") != "true" {
+			v.touch(s.now())
+		}
+		response = v.data(req.URL.Query().Get("endpoints"))
+	default:
+		state, ok := v.states()[strings.TrimPrefix(endpoint, "data_request/")]
+		if !ok || !strings.HasPrefix(endpoint, "data_request/") {
+			http.NotFound(w, req)
+			return
+		}
+		if unavailable(w, v) {
+			return
+		}
+		v.touch(s.now())
+		response = state
+	}
+	writeResponse(w, response)
+}
+
+// Serves wake_up, which brings an asleep vehicle online after WakeAfter requests
+func (s *Server) serveWakeup(w http.ResponseWriter, v *Vehicle) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v.State == StateAsleep {
+		if v.wakeups >= v.WakeAfter {
+			v.State = StateOnline
+			v.wakeups = 0
+			v.touch(s.now())
+		} else {
+			v.wakeups++
+		}
+	}
+	vehicle := v.Vehicle
+	writeResponse(w, &vehicle)
+}
+
+// Serves a command, recording it and applying its effect on the states
+func (s *Server) serveCommand(w http.ResponseWriter, req *http.Request, v *Vehicle, name string) {
+	params, _ := ioutil.ReadAll(req.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = append(s.commands, Command{
+		VehicleID: v.ID,
+		VIN:       v.Vin,
+		Name:      name,
+		Params:    params,
+		Time:      s.now(),
+	})
+	if unavailable(w, v) {
+		return
+	}
+	v.touch(s.now())
+	if v.InService {
+		writeError(w, http.StatusMethodNotAllowed, "vehicle is currently in service")
+		return
+	}
+	err := error(nil)
+	if v.Command != nil {
+		err = v.Command(name, params)
+	}
+	if err == nil {
+		err = v.apply(name, params)
+	}
+	var commandErr *tesla.CommandError
+	switch {
+	case errors.As(err, &commandErr):
+		writeResponse(w, map[string]interface{}{"result": false, "reason": commandErr.Reason})
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeResponse(w, map[string]interface{}{"result": true, "reason": ""})
+	}
+}
+
+// Returns a numeric parameter, which clients send either as a JSON number
+// or as a string
+func number(params map[string]interface{}, name string) (float64, bool) {
+	switch value := params[name].(type) {
+	case float64:
+		return value, true
+	case string:
+		f, err := strconv.ParseFloat(value, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Returns a boolean parameter, which clients send either as a JSON boolean
+// or as a string
+func flag(params map[string]interface{}, name string) bool {
+	switch value := params[name].(type) {
+	case bool:
+		return value
+	case string:
+		b, _ := strconv.ParseBool(value)
+		return b
+	}
+	return false
+}
+
+// Applies the default effect of the well-known commands. The caller holds s.mu.
+func (v *Vehicle) apply(name string, body []byte) error {
+	params := map[string]interface{}{}
+	json.Unmarshal(body, &params)
+	charge, climate, vehicle := v.ChargeState, v.ClimateState, v.VehicleState
+	switch {
+	case name == "door_lock" && vehicle != nil:
+		vehicle.Locked = true
+	case name == "door_unlock" && vehicle != nil:
+		vehicle.Locked = false
+	case name == "set_sentry_mode" && vehicle != nil:
+		vehicle.SentryMode = flag(params, "on")
+	case name == "set_charge_limit" && charge != nil:
+		percent, ok := number(params, "percent")
+		if !ok || percent < 50 || percent > 100 {
+			return &tesla.CommandError{Reason: "invalid_percent"}
+		}
+		charge.ChargeLimitSoc = int(percent)
+	case name == "charge_standard" && charge != nil:
+		charge.ChargeLimitSoc = 90
+	case name == "charge_max_range" && charge != nil:
+		charge.ChargeLimitSoc = 100
+	case name == "charge_start" && charge != nil:
+		switch charge.ChargingState {
+		case "Disconnected":
+			return tesla.ErrDisconnected
+		case "Charging":
+			return tesla.ErrIsCharging
+		case "Complete":
+			if charge.BatteryLevel >= charge.ChargeLimitSoc {
+				return tesla.ErrComplete
+			}
+		}
+		charge.ChargingState = "Charging"
+	case name == "charge_stop" && charge != nil:
+		if charge.ChargingState != "Charging" {
+			return tesla.ErrNotCharging
+		}
+		charge.ChargingState = "Stopped"
+	case name == "set_charging_amps" && charge != nil:
+		amps, ok := number(params, "charging_amps")
+		if !ok || amps < 0 {
+			return &tesla.CommandError{Reason: "invalid_charging_amps"}
+		}
+		charge.ChargeCurrentRequest = int(amps)
+	case name == "charge_port_door_open" && charge != nil:
+		charge.ChargePortDoorOpen = true
+	case name == "charge_port_door_close" && charge != nil:
+		charge.ChargePortDoorOpen = false
+	case name == "auto_conditioning_start" && climate != nil:
+		climate.IsClimateOn = true
+		climate.IsAutoConditioningOn = true
+	case name == "auto_conditioning_stop" && climate != nil:
+		climate.IsClimateOn = false
+		climate.IsAutoConditioningOn = false
+	case name == "set_temps" && climate != nil:
+		if driver, ok := number(params, "driver_temp"); ok {
+			climate.DriverTempSetting = driver
+		}
+		if passenger, ok := number(params, "passenger_temp"); ok {
+			climate.PassengerTempSetting = passenger
+		}
+	}
+	return nil
+}
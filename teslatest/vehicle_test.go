@@ -0,0 +1,137 @@
+package teslatest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bogosj/tesla"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVehicleSpec(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	v := server.AddVehicle(NewVehicle(1234, "5YJ3E1EA7KF000001"))
+	client, err := server.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vehicle, err := client.Vehicle(1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("Should serve the vehicles and their states", t, func() {
+		So(vehicle.Vin, ShouldEqual, "5YJ3E1EA7KF000001")
+		So(vehicle.State, ShouldEqual, StateOnline)
+		charge, err := vehicle.ChargeState()
+		So(err, ShouldBeNil)
+		So(charge.BatteryLevel, ShouldEqual, 80)
+		data, err := vehicle.VehicleData(nil)
+		So(err, ShouldBeNil)
+		So(data.VehicleState.Locked, ShouldBeTrue)
+		So(data.ClimateState.InsideTemp, ShouldEqual, 20)
+	})
+
+	Convey("Should select the states of the vehicle data", t, func() {
+		data := v.data("charge_state;drive_state")
+		So(data["vin"], ShouldEqual, "5YJ3E1EA7KF000001")
+		So(data["charge_state"], ShouldNotBeNil)
+		So(data["drive_state"], ShouldNotBeNil)
+		So(data["climate_state"], ShouldBeNil)
+	})
+
+	Convey("Should apply the commands to the states", t, func() {
+		So(vehicle.UnlockDoors(), ShouldBeNil)
+		So(vehicle.SetChargeLimit(75), ShouldBeNil)
+		So(vehicle.SetTemprature(19.5, 20), ShouldBeNil)
+		So(vehicle.StartAirConditioning(), ShouldBeNil)
+		So(vehicle.EnableSentry(), ShouldBeNil)
+		server.Update(v, func(v *Vehicle) {
+			So(v.VehicleState.Locked, ShouldBeFalse)
+			So(v.VehicleState.SentryMode, ShouldBeTrue)
+			So(v.ChargeState.ChargeLimitSoc, ShouldEqual, 75)
+			So(v.ClimateState.DriverTempSetting, ShouldEqual, 19.5)
+			So(v.ClimateState.PassengerTempSetting, ShouldEqual, 20)
+			So(v.ClimateState.IsClimateOn, ShouldBeTrue)
+		})
+	})
+
+	Convey("Should fail commands with the reasons of the vehicle", t, func() {
+		err := vehicle.StartCharging()
+		So(errors.Is(err, tesla.ErrDisconnected), ShouldBeTrue)
+		server.Update(v, func(v *Vehicle) {
+			v.Command = func(name string, params []byte) error {
+				return &tesla.CommandError{Reason: "user_present"}
+			}
+		})
+		err = vehicle.FlashLights()
+		So(errors.Is(err, tesla.ErrUserPresent), ShouldBeTrue)
+		server.Update(v, func(v *Vehicle) { v.Command = nil })
+	})
+
+	Convey("Should wake asleep vehicles", t, func() {
+		server.Update(v, func(v *Vehicle) {
+			v.State = StateAsleep
+			v.WakeAfter = 1
+		})
+		_, err := vehicle.ChargeState()
+		So(errors.Is(err, tesla.ErrVehicleUnavailable), ShouldBeTrue)
+		err = vehicle.LockDoors()
+		So(errors.Is(err, tesla.ErrVehicleUnavailable), ShouldBeTrue)
+		woken, err := vehicle.Wakeup()
+		So(err, ShouldBeNil)
+		So(woken.State, ShouldEqual, StateAsleep)
+		woken, err = vehicle.Wakeup()
+		So(err, ShouldBeNil)
+		So(woken.State, ShouldEqual, StateOnline)
+		_, err = vehicle.ChargeState()
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Should serve clients waking vehicles on demand", t, func() {
+		server.Update(v, func(v *Vehicle) {
+			v.State = StateAsleep
+			v.WakeAfter = 0
+		})
+		server.Reset()
+		vehicle.WakePolicy = tesla.DefaultWakePolicy()
+		defer func() { vehicle.WakePolicy = nil }()
+		So(vehicle.HonkHorn(), ShouldBeNil)
+		server.AssertCommands(t, "honk_horn", "honk_horn")
+		So(server.Requests(), ShouldContain, "POST /api/1/vehicles/1234/wake_up")
+	})
+
+	Convey("Should not wake offline vehicles", t, func() {
+		server.Update(v, func(v *Vehicle) { v.State = StateOffline })
+		woken, err := vehicle.Wakeup()
+		So(err, ShouldBeNil)
+		So(woken.State, ShouldEqual, StateOffline)
+		server.Update(v, func(v *Vehicle) { v.State = StateOnline })
+	})
+
+	Convey("Should reject commands to vehicles in service", t, func() {
+		server.Update(v, func(v *Vehicle) { v.InService = true })
+		err := vehicle.HonkHorn()
+		So(errors.Is(err, tesla.ErrVehicleInService), ShouldBeTrue)
+		server.Update(v, func(v *Vehicle) { v.InService = false })
+	})
+
+	Convey("Should delay the responses", t, func() {
+		server.Update(v, func(v *Vehicle) { v.Latency = time.Second })
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := vehicle.ChargeStateContext(ctx)
+		So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+		server.Update(v, func(v *Vehicle) { v.Latency = 0 })
+	})
+
+	Convey("Should return 404 for unknown vehicles", t, func() {
+		_, err := client.Vehicle(5678)
+		var apiErr *tesla.APIError
+		So(errors.As(err, &apiErr), ShouldBeTrue)
+		So(apiErr.StatusCode, ShouldEqual, 404)
+	})
+}
@@ -0,0 +1,264 @@
+package tesla
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrTokenNotFound is returned by a TokenStore when no token has been saved
+var ErrTokenNotFound = errors.New("token not found")
+
+// TokenStore persists the token of a client. The client loads the token from
+// the store on creation and saves every token it obtains by login or refresh.
+type TokenStore interface {
+	Load() (*Token, error)
+	Save(token *Token) error
+	Delete() error
+}
+
+// FileTokenStore stores the token as plain JSON in a file. Access to the file
+// is serialized with a lock file, so the store may be shared by several processes.
+type FileTokenStore struct {
+	Path string
+}
+
+// NewFileTokenStore returns a token store backed by the file at path
+func NewFileTokenStore(path string) *FileTokenStore {
+	return &FileTokenStore{Path: path}
+}
+
+// Load reads the token from the file
+func (s *FileTokenStore) Load() (*Token, error) {
+	data, err := readLocked(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	token := &Token{}
+	if err := json.Unmarshal(data, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// Save writes the token to the file
+func (s *FileTokenStore) Save(token *Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	return writeLocked(s.Path, data)
+}
+
+// Delete removes the file
+func (s *FileTokenStore) Delete() error {
+	return deleteLocked(s.Path)
+}
+
+// EncryptedFileTokenStore stores the token in a file encrypted with AES-GCM,
+// using a key derived from a passphrase. Like FileTokenStore, it may be shared
+// by several processes.
+type EncryptedFileTokenStore struct {
+	Path       string
+	Passphrase string
+}
+
+// NewEncryptedFileTokenStore returns a token store backed by the file at path
+// and encrypted with the passphrase
+func NewEncryptedFileTokenStore(path, passphrase string) *EncryptedFileTokenStore {
+	return &EncryptedFileTokenStore{Path: path, Passphrase: passphrase}
+}
+
+const (
+	encryptedTokenMagic = "TSLA1"
+	encryptedTokenSalt  = 16
+	keyIterations       = 100000
+)
+
+// Load reads and decrypts the token from the file
+func (s *EncryptedFileTokenStore) Load() (*Token, error) {
+	data, err := readLocked(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(encryptedTokenMagic)) || len(data) < len(encryptedTokenMagic)+encryptedTokenSalt {
+		return nil, errors.New("token file is not encrypted")
+	}
+	data = data[len(encryptedTokenMagic):]
+	aead, err := s.cipher(data[:encryptedTokenSalt])
+	if err != nil {
+		return nil, err
+	}
+	data = data[encryptedTokenSalt:]
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("token file is truncated")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(encryptedTokenMagic))
+	if err != nil {
+		return nil, errors.New("unable to decrypt token, wrong passphrase?")
+	}
+	token := &Token{}
+	if err := json.Unmarshal(plain, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// Save encrypts and writes the token to the file
+func (s *EncryptedFileTokenStore) Save(token *Token) error {
+	plain, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	salt := make([]byte, encryptedTokenSalt)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	aead, err := s.cipher(salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	data := append([]byte(encryptedTokenMagic), salt...)
+	data = append(data, nonce...)
+	data = aead.Seal(data, nonce, plain, []byte(encryptedTokenMagic))
+	return writeLocked(s.Path, data)
+}
+
+// Delete removes the file
+func (s *EncryptedFileTokenStore) Delete() error {
+	return deleteLocked(s.Path)
+}
+
+// Returns the AES-GCM cipher for the passphrase and salt
+func (s *EncryptedFileTokenStore) cipher(salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2SHA256([]byte(s.Passphrase), salt, keyIterations, 32))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Derives a key from a passphrase as specified by PBKDF2 (RFC 8018) with HMAC-SHA256
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	key := make([]byte, 0, keyLen)
+	u := make([]byte, 0, sha256.Size)
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, block)
+		u = prf.Sum(u[:0])
+		t := append([]byte{}, u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+var (
+	lockTimeout = 10 * time.Second
+	lockStale   = 30 * time.Second
+)
+
+// Acquires the lock file next to path, removing locks left behind by crashed processes
+func lockFile(path string) (func(), error) {
+	lock := path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if fi, err := os.Stat(lock); err == nil && time.Since(fi.ModTime()) > lockStale {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.New("timed out waiting for lock on " + path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Reads the file at path while holding its lock
+func readLocked(path string) ([]byte, error) {
+	unlock, err := lockFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrTokenNotFound
+	}
+	return data, err
+}
+
+// Atomically replaces the file at path while holding its lock
+func writeLocked(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	unlock, err := lockFile(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Removes the file at path while holding its lock
+func deleteLocked(path string) error {
+	unlock, err := lockFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
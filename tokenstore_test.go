@@ -0,0 +1,123 @@
+package tesla
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTokenStoreSpec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tesla")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	token := &Token{
+		AccessToken:  "foo",
+		TokenType:    "bearer",
+		Expires:      99999999999,
+		RefreshToken: "refresh123",
+	}
+
+	Convey("Should save and load a token from a file", t, func() {
+		store := NewFileTokenStore(filepath.Join(dir, "plain", "token.json"))
+		_, err := store.Load()
+		So(err, ShouldEqual, ErrTokenNotFound)
+		So(store.Save(token), ShouldBeNil)
+		loaded, err := store.Load()
+		So(err, ShouldBeNil)
+		So(loaded, ShouldResemble, token)
+		So(store.Delete(), ShouldBeNil)
+		_, err = store.Load()
+		So(err, ShouldEqual, ErrTokenNotFound)
+		So(store.Delete(), ShouldBeNil)
+	})
+
+	Convey("Should save and load an encrypted token", t, func() {
+		path := filepath.Join(dir, "token.enc")
+		store := NewEncryptedFileTokenStore(path, "secret")
+		So(store.Save(token), ShouldBeNil)
+		data, _ := ioutil.ReadFile(path)
+		So(strings.Contains(string(data), "refresh123"), ShouldBeFalse)
+		loaded, err := store.Load()
+		So(err, ShouldBeNil)
+		So(loaded, ShouldResemble, token)
+
+		Convey("Should not decrypt with the wrong passphrase", func() {
+			_, err := NewEncryptedFileTokenStore(path, "wrong").Load()
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Should wait for a locked file", t, func() {
+		path := filepath.Join(dir, "locked.json")
+		unlock, err := lockFile(path)
+		So(err, ShouldBeNil)
+		previousTimeout := lockTimeout
+		lockTimeout = 0
+		So(NewFileTokenStore(path).Save(token), ShouldNotBeNil)
+		lockTimeout = previousTimeout
+		unlock()
+		So(NewFileTokenStore(path).Save(token), ShouldBeNil)
+	})
+
+	Convey("Should derive PBKDF2 keys", t, func() {
+		// Test vector from RFC 7914, section 11
+		key := pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1, 64)
+		So(hex.EncodeToString(key), ShouldEqual, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783")
+	})
+}
+
+func TestClientTokenStoreSpec(t *testing.T) {
+	ts := serveHTTP(t)
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "tesla")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	auth := &Auth{
+		ClientID:     "abc123",
+		ClientSecret: "def456",
+		Email:        "elon@tesla.com",
+		Password:     "go",
+	}
+
+	Convey("Should login and save the token to an empty store", t, func() {
+		store := NewFileTokenStore(filepath.Join(dir, "login.json"))
+		client, err := NewClientWithTokenStore(auth, store, testOptions(ts)...)
+		So(err, ShouldBeNil)
+		saved, err := store.Load()
+		So(err, ShouldBeNil)
+		So(saved.AccessToken, ShouldEqual, client.Token.AccessToken)
+	})
+
+	Convey("Should use and refresh the stored token", t, func() {
+		store := NewFileTokenStore(filepath.Join(dir, "refresh.json"))
+		store.Save(&Token{AccessToken: "foo", Expires: 99999999999, RefreshToken: "refresh123"})
+		client, err := NewClientWithTokenStore(auth, store, testOptions(ts)...)
+		So(err, ShouldBeNil)
+		So(client.Token.AccessToken, ShouldEqual, "foo")
+		So(client.RefreshToken(), ShouldBeNil)
+		saved, _ := store.Load()
+		So(saved.AccessToken, ShouldEqual, "ghi789")
+	})
+
+	Convey("Should pick up a token refreshed by another client", t, func() {
+		store := NewFileTokenStore(filepath.Join(dir, "shared.json"))
+		store.Save(&Token{AccessToken: "foo", Expires: 99999999999, RefreshToken: "bad"})
+		client, err := NewClientWithTokenStore(auth, store, testOptions(ts)...)
+		So(err, ShouldBeNil)
+		store.Save(&Token{AccessToken: "bar", Expires: 99999999999, RefreshToken: "bad"})
+		So(client.RefreshToken(), ShouldBeNil)
+		So(client.Token.AccessToken, ShouldEqual, "bar")
+	})
+}
@@ -0,0 +1,73 @@
+package tesla
+
+import "github.com/bogosj/tesla/units"
+
+// Converter returns the converter presenting values in the units the driver
+// chose, or in the units of the API if the settings are nil
+func (g *GuiSettings) Converter() *units.Converter {
+	if g == nil {
+		return units.NewConverter("", "")
+	}
+	return units.NewConverter(g.GuiDistanceUnits, g.GuiTemperatureUnits)
+}
+
+// RatedRange returns the rated range of the battery
+func (c *ChargeState) RatedRange() units.Distance { return units.Miles(c.BatteryRange) }
+
+// EstimatedRange returns the range of the battery estimated from the recent consumption
+func (c *ChargeState) EstimatedRange() units.Distance { return units.Miles(c.EstBatteryRange) }
+
+// IdealRange returns the ideal range of the battery
+func (c *ChargeState) IdealRange() units.Distance { return units.Miles(c.IdealBatteryRange) }
+
+// RangeAdded returns the rated range added by the current charge
+func (c *ChargeState) RangeAdded() units.Distance { return units.Miles(c.ChargeMilesAddedRated) }
+
+// EnergyAdded returns the energy added by the current charge
+func (c *ChargeState) EnergyAdded() units.Energy { return units.KilowattHours(c.ChargeEnergyAdded) }
+
+// RangeRate returns the range added per hour of charging
+func (c *ChargeState) RangeRate() units.Speed { return units.MilesPerHour(c.ChargeRate) }
+
+// InsideTemperature returns the temperature of the cabin
+func (c *ClimateState) InsideTemperature() units.Temperature { return units.Celsius(c.InsideTemp) }
+
+// OutsideTemperature returns the temperature outside of the vehicle
+func (c *ClimateState) OutsideTemperature() units.Temperature { return units.Celsius(c.OutsideTemp) }
+
+// DriverTemperature returns the temperature set on the driver side
+func (c *ClimateState) DriverTemperature() units.Temperature {
+	return units.Celsius(c.DriverTempSetting)
+}
+
+// PassengerTemperature returns the temperature set on the passenger side
+func (c *ClimateState) PassengerTemperature() units.Temperature {
+	return units.Celsius(c.PassengerTempSetting)
+}
+
+// Velocity returns the speed of the vehicle
+func (d *DriveState) Velocity() units.Speed { return units.MilesPerHour(d.Speed) }
+
+// OdometerReading returns the distance the vehicle traveled
+func (v *VehicleState) OdometerReading() units.Distance { return units.Miles(v.Odometer) }
+
+// CurrentLimit returns the speed the vehicle is limited to
+func (s SpeedLimitMode) CurrentLimit() units.Speed { return units.MilesPerHour(s.CurrentLimitMph) }
+
+// MaxLimit returns the highest speed limit that can be set
+func (s SpeedLimitMode) MaxLimit() units.Speed { return units.MilesPerHour(float64(s.MaxLimitMph)) }
+
+// MinLimit returns the lowest speed limit that can be set
+func (s SpeedLimitMode) MinLimit() units.Speed { return units.MilesPerHour(float64(s.MinLimitMph)) }
+
+// Velocity returns the speed of the vehicle
+func (e *StreamEvent) Velocity() units.Speed { return units.MilesPerHour(float64(e.Speed)) }
+
+// OdometerReading returns the distance the vehicle traveled
+func (e *StreamEvent) OdometerReading() units.Distance { return units.Miles(e.Odometer) }
+
+// RatedRange returns the rated range of the battery
+func (e *StreamEvent) RatedRange() units.Distance { return units.Miles(float64(e.Range)) }
+
+// EstimatedRange returns the range of the battery estimated from the recent consumption
+func (e *StreamEvent) EstimatedRange() units.Distance { return units.Miles(float64(e.EstRange)) }
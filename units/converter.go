@@ -0,0 +1,116 @@
+package units
+
+import (
+	"strconv"
+	"strings"
+)
+
+// DistanceUnit is the unit distances and speeds are presented in
+type DistanceUnit int
+
+const (
+	// UnitMiles presents distances in miles and speeds in mph, as the API reports them
+	UnitMiles DistanceUnit = iota
+	UnitKilometers
+)
+
+// TemperatureUnit is the unit temperatures are presented in
+type TemperatureUnit int
+
+const (
+	// UnitCelsius presents temperatures in °C, as the API reports them
+	UnitCelsius TemperatureUnit = iota
+	UnitFahrenheit
+)
+
+// Converter presents values in the units the driver chose
+type Converter struct {
+	DistanceUnits    DistanceUnit
+	TemperatureUnits TemperatureUnit
+}
+
+// NewConverter returns a converter for the units of the GUI settings of a
+// vehicle, e.g. "km/hr" and "F". Units it does not know are taken to be the
+// units of the API.
+func NewConverter(distanceUnits, temperatureUnits string) *Converter {
+	c := &Converter{}
+	if strings.HasPrefix(strings.ToLower(distanceUnits), "km") {
+		c.DistanceUnits = UnitKilometers
+	}
+	if strings.EqualFold(temperatureUnits, "F") {
+		c.TemperatureUnits = UnitFahrenheit
+	}
+	return c
+}
+
+// Distance returns the distance in the unit of the driver
+func (c *Converter) Distance(d Distance) float64 {
+	if c.DistanceUnits == UnitKilometers {
+		return d.Kilometers()
+	}
+	return d.Miles()
+}
+
+// DistanceUnit returns the abbreviation of the unit of distances, "mi" or "km"
+func (c *Converter) DistanceUnit() string {
+	if c.DistanceUnits == UnitKilometers {
+		return "km"
+	}
+	return "mi"
+}
+
+// FormatDistance formats the distance with a decimal, e.g. "379.6 km"
+func (c *Converter) FormatDistance(d Distance) string {
+	return format(c.Distance(d), 1, c.DistanceUnit())
+}
+
+// Speed returns the speed in the unit of the driver
+func (c *Converter) Speed(s Speed) float64 {
+	if c.DistanceUnits == UnitKilometers {
+		return s.KilometersPerHour()
+	}
+	return s.MilesPerHour()
+}
+
+// SpeedUnit returns the abbreviation of the unit of speeds, "mph" or "km/h"
+func (c *Converter) SpeedUnit() string {
+	if c.DistanceUnits == UnitKilometers {
+		return "km/h"
+	}
+	return "mph"
+}
+
+// FormatSpeed formats the speed without decimals, e.g. "105 km/h"
+func (c *Converter) FormatSpeed(s Speed) string {
+	return format(c.Speed(s), 0, c.SpeedUnit())
+}
+
+// Temperature returns the temperature in the unit of the driver
+func (c *Converter) Temperature(t Temperature) float64 {
+	if c.TemperatureUnits == UnitFahrenheit {
+		return t.Fahrenheit()
+	}
+	return t.Celsius()
+}
+
+// TemperatureUnit returns the symbol of the unit of temperatures, "°C" or "°F"
+func (c *Converter) TemperatureUnit() string {
+	if c.TemperatureUnits == UnitFahrenheit {
+		return "°F"
+	}
+	return "°C"
+}
+
+// FormatTemperature formats the temperature with a decimal, e.g. "21.5 °C"
+func (c *Converter) FormatTemperature(t Temperature) string {
+	return format(c.Temperature(t), 1, c.TemperatureUnit())
+}
+
+// FormatEnergy formats the energy with two decimals, e.g. "19.94 kWh"
+func (c *Converter) FormatEnergy(e Energy) string {
+	return format(e.KilowattHours(), 2, "kWh")
+}
+
+func format(v float64, decimals int, unit string) string {
+	return strconv.FormatFloat(v, 'f', decimals, 64) + " " + unit
+}
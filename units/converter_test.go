@@ -0,0 +1,33 @@
+package units
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConverterSpec(t *testing.T) {
+	Convey("Should present values in metric units", t, func() {
+		c := NewConverter("km/hr", "C")
+		So(c.Distance(Miles(100)), ShouldAlmostEqual, 160.9344)
+		So(c.FormatDistance(Miles(235.92)), ShouldEqual, "379.7 km")
+		So(c.FormatSpeed(MilesPerHour(65)), ShouldEqual, "105 km/h")
+		So(c.FormatTemperature(Celsius(21.5)), ShouldEqual, "21.5 °C")
+	})
+
+	Convey("Should present values in imperial units", t, func() {
+		c := NewConverter("mi/hr", "F")
+		So(c.FormatDistance(Miles(235.92)), ShouldEqual, "235.9 mi")
+		So(c.FormatSpeed(MilesPerHour(65)), ShouldEqual, "65 mph")
+		So(c.Temperature(Celsius(22)), ShouldAlmostEqual, 71.6)
+		So(c.FormatTemperature(Celsius(22)), ShouldEqual, "71.6 °F")
+	})
+
+	Convey("Should fall back to the units of the API", t, func() {
+		c := NewConverter("", "")
+		So(c.DistanceUnit(), ShouldEqual, "mi")
+		So(c.SpeedUnit(), ShouldEqual, "mph")
+		So(c.TemperatureUnit(), ShouldEqual, "°C")
+		So(c.FormatEnergy(KilowattHours(19.94)), ShouldEqual, "19.94 kWh")
+	})
+}
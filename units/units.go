@@ -0,0 +1,70 @@
+// Package units converts the distances, speeds, temperatures and energies
+// reported by the Tesla API, which reports miles, mph and °C whatever the
+// settings of the vehicle, into the units the driver chose:
+//
+//	converter := units.NewConverter("km/hr", "F")
+//	fmt.Println(converter.FormatDistance(units.Miles(235.9)))
+package units
+
+// The factors from the units to the base units of the types
+const (
+	metersPerMile      = 1609.344
+	metersPerKilometer = 1000
+)
+
+// Distance is a length, stored in meters
+type Distance float64
+
+// Miles returns the distance of mi miles
+func Miles(mi float64) Distance { return Distance(mi * metersPerMile) }
+
+// Kilometers returns the distance of km kilometers
+func Kilometers(km float64) Distance { return Distance(km * metersPerKilometer) }
+
+// Miles returns the distance in miles
+func (d Distance) Miles() float64 { return float64(d) / metersPerMile }
+
+// Kilometers returns the distance in kilometers
+func (d Distance) Kilometers() float64 { return float64(d) / metersPerKilometer }
+
+// Speed is a velocity, stored in meters per hour
+type Speed float64
+
+// MilesPerHour returns the speed of mph miles per hour
+func MilesPerHour(mph float64) Speed { return Speed(mph * metersPerMile) }
+
+// KilometersPerHour returns the speed of kmh kilometers per hour
+func KilometersPerHour(kmh float64) Speed { return Speed(kmh * metersPerKilometer) }
+
+// MilesPerHour returns the speed in miles per hour
+func (s Speed) MilesPerHour() float64 { return float64(s) / metersPerMile }
+
+// KilometersPerHour returns the speed in kilometers per hour
+func (s Speed) KilometersPerHour() float64 { return float64(s) / metersPerKilometer }
+
+// Temperature is stored in degrees Celsius
+type Temperature float64
+
+// Celsius returns the temperature of c °C
+func Celsius(c float64) Temperature { return Temperature(c) }
+
+// Fahrenheit returns the temperature of f °F
+func Fahrenheit(f float64) Temperature { return Temperature((f - 32) * 5 / 9) }
+
+// Celsius returns the temperature in °C
+func (t Temperature) Celsius() float64 { return float64(t) }
+
+// Fahrenheit returns the temperature in °F
+func (t Temperature) Fahrenheit() float64 { return float64(t)*9/5 + 32 }
+
+// Energy is stored in kilowatt hours
+type Energy float64
+
+// KilowattHours returns the energy of kwh kWh
+func KilowattHours(kwh float64) Energy { return Energy(kwh) }
+
+// KilowattHours returns the energy in kWh
+func (e Energy) KilowattHours() float64 { return float64(e) }
+
+// WattHours returns the energy in Wh
+func (e Energy) WattHours() float64 { return float64(e) * 1000 }
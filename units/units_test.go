@@ -0,0 +1,31 @@
+package units
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitsSpec(t *testing.T) {
+	Convey("Should convert distances", t, func() {
+		So(Miles(1).Kilometers(), ShouldAlmostEqual, 1.609344)
+		So(Kilometers(100).Miles(), ShouldAlmostEqual, 62.1371, 0.0001)
+		So(Miles(235.92).Miles(), ShouldAlmostEqual, 235.92)
+	})
+
+	Convey("Should convert speeds", t, func() {
+		So(MilesPerHour(65).KilometersPerHour(), ShouldAlmostEqual, 104.607, 0.001)
+		So(KilometersPerHour(120).MilesPerHour(), ShouldAlmostEqual, 74.565, 0.001)
+	})
+
+	Convey("Should convert temperatures", t, func() {
+		So(Celsius(100).Fahrenheit(), ShouldAlmostEqual, 212)
+		So(Fahrenheit(-40).Celsius(), ShouldAlmostEqual, -40)
+		So(Fahrenheit(71.6).Celsius(), ShouldAlmostEqual, 22)
+	})
+
+	Convey("Should convert energies", t, func() {
+		So(KilowattHours(19.94).WattHours(), ShouldAlmostEqual, 19940)
+		So(KilowattHours(19.94).KilowattHours(), ShouldEqual, 19.94)
+	})
+}
@@ -0,0 +1,41 @@
+package tesla
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitsSpec(t *testing.T) {
+	resp := &StateRequest{}
+	json.Unmarshal([]byte(ChargeStateJSON), resp)
+	charge := resp.Response.ChargeState
+
+	Convey("Should present the states in the units of the GUI settings", t, func() {
+		settings := &GuiSettings{GuiDistanceUnits: "km/hr", GuiTemperatureUnits: "F"}
+		c := settings.Converter()
+		So(c.FormatDistance(charge.RatedRange()), ShouldEqual, "379.7 km")
+		So(c.FormatDistance(charge.IdealRange()), ShouldEqual, "490.4 km")
+		So(c.FormatEnergy(charge.EnergyAdded()), ShouldEqual, "19.94 kWh")
+		climate := &ClimateState{InsideTemp: 20, DriverTempSetting: 22}
+		So(c.FormatTemperature(climate.InsideTemperature()), ShouldEqual, "68.0 °F")
+		So(c.FormatTemperature(climate.DriverTemperature()), ShouldEqual, "71.6 °F")
+		drive := &DriveState{Speed: 65}
+		So(c.FormatSpeed(drive.Velocity()), ShouldEqual, "105 km/h")
+		vehicle := &VehicleState{Odometer: 3738.84633}
+		vehicle.SpeedLimitMode.CurrentLimitMph = 74.564543
+		So(c.FormatDistance(vehicle.OdometerReading()), ShouldEqual, "6017.1 km")
+		So(c.FormatSpeed(vehicle.SpeedLimitMode.CurrentLimit()), ShouldEqual, "120 km/h")
+		event := &StreamEvent{Speed: 30, Range: 200}
+		So(c.FormatSpeed(event.Velocity()), ShouldEqual, "48 km/h")
+		So(c.FormatDistance(event.RatedRange()), ShouldEqual, "321.9 km")
+	})
+
+	Convey("Should keep the units of the API without settings", t, func() {
+		var settings *GuiSettings
+		c := settings.Converter()
+		So(c.FormatDistance(charge.RatedRange()), ShouldEqual, "235.9 mi")
+		So(c.FormatDistance(charge.RangeAdded()), ShouldEqual, "64.5 mi")
+	})
+}
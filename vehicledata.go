@@ -0,0 +1,228 @@
+package tesla
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The endpoints selecting the categories of the vehicle data
+const (
+	EndpointChargeState   = "charge_state"
+	EndpointClimateState  = "climate_state"
+	EndpointDriveState    = "drive_state"
+	EndpointLocationData  = "location_data"
+	EndpointGuiSettings   = "gui_settings"
+	EndpointVehicleState  = "vehicle_state"
+	EndpointVehicleConfig = "vehicle_config"
+	EndpointClosuresState = "closures_state"
+)
+
+// AllEndpoints are the endpoints returned when none are selected
+var AllEndpoints = []string{
+	EndpointChargeState,
+	EndpointClimateState,
+	EndpointDriveState,
+	EndpointLocationData,
+	EndpointGuiSettings,
+	EndpointVehicleState,
+	EndpointVehicleConfig,
+	EndpointClosuresState,
+}
+
+// VehicleDataRequest selects the data returned by VehicleData
+type VehicleDataRequest struct {
+	// Endpoints are the categories returned, AllEndpoints if empty. The
+	// location is part of the drive state and the closures are part of the
+	// vehicle state.
+	Endpoints []string
+	// LetSleep asks the API not to keep the vehicle awake for the request,
+	// which also keeps the wake policy from waking it
+	LetSleep bool
+}
+
+// VehicleData is a snapshot of the vehicle and its states returned by a
+// single request. The states not selected are nil.
+type VehicleData struct {
+	// Vehicle is the vehicle as returned along with its states
+	Vehicle       *Vehicle       `json:"-"`
+	ChargeState   *ChargeState   `json:"charge_state"`
+	ClimateState  *ClimateState  `json:"climate_state"`
+	DriveState    *DriveState    `json:"drive_state"`
+	GuiSettings   *GuiSettings   `json:"gui_settings"`
+	VehicleState  *VehicleState  `json:"vehicle_state"`
+	VehicleConfig *VehicleConfig `json:"vehicle_config"`
+}
+
+// VehicleData returns the states of the vehicle selected by req, or all of
+// them if req is nil, in a single request. Vehicles whose firmware does not
+// serve vehicle_data are read with a request per state instead.
+func (v Vehicle) VehicleData(req *VehicleDataRequest) (*VehicleData, error) {
+	return v.VehicleDataContext(context.Background(), req)
+}
+
+// VehicleDataContext is like VehicleData but uses ctx for the requests to the API
+func (v Vehicle) VehicleDataContext(ctx context.Context, req *VehicleDataRequest) (*VehicleData, error) {
+	if req == nil {
+		req = &VehicleDataRequest{}
+	}
+	endpoints := req.Endpoints
+	if len(endpoints) == 0 {
+		endpoints = AllEndpoints
+	}
+	var data *VehicleData
+	fetch := func() (err error) {
+		data, err = v.c.fetchVehicleData(ctx, v.ID, endpoints, req.LetSleep)
+		return err
+	}
+	var err error
+	if req.LetSleep {
+		err = fetch()
+	} else {
+		err = v.withWake(ctx, "vehicle_data", fetch)
+	}
+	if v.c.vehicleDataUnsupported(ctx, v.ID, err) {
+		v.c.logf("vehicle_data not found, reading the states of vehicle %d one by one", v.ID)
+		return v.fetchStates(ctx, endpoints, req.LetSleep)
+	}
+	if err != nil {
+		return nil, err
+	}
+	data.Vehicle.c = v.c
+	return data, nil
+}
+
+// Indicates whether err tells that the vehicle_data endpoint is not served
+// for the vehicle, rather than that the vehicle does not exist. The API
+// answers 404 to both, so the vehicle is looked up to tell them apart.
+func (c *Client) vehicleDataUnsupported(ctx context.Context, id int64, err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		return false
+	}
+	_, lookupErr := c.VehicleContext(ctx, id)
+	return lookupErr == nil
+}
+
+// Fetches the vehicle data of the endpoints in a single request
+func (c *Client) fetchVehicleData(ctx context.Context, id int64, endpoints []string, letSleep bool) (*VehicleData, error) {
+	if err := c.rateLimit(ctx, id, stateRead); err != nil {
+		return nil, err
+	}
+	query := "?endpoints=" + url.QueryEscape(strings.Join(endpoints, ";"))
+	if letSleep {
+		query += "&let_sleep=true"
+	}
+	resp := &struct {
+		Response json.RawMessage `json:"response"`
+	}{}
+	if err := c.getJSON(ctx, c.baseURL()+"/vehicles/"+strconv.FormatInt(id, 10)+"/vehicle_data"+query, resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Response) == 0 || string(resp.Response) == "null" {
+		return nil, errors.New("vehicle_data returned no data")
+	}
+	data := &VehicleData{Vehicle: &Vehicle{}}
+	if err := json.Unmarshal(resp.Response, data.Vehicle); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(resp.Response, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Reads the states of the endpoints with a request per state, for firmware
+// that does not serve vehicle_data. The vehicle is woken once for all of
+// them if it is asleep and the wake policy allows it.
+func (v Vehicle) fetchStates(ctx context.Context, endpoints []string, letSleep bool) (*VehicleData, error) {
+	if letSleep {
+		return v.fetchEachState(ctx, endpoints)
+	}
+	var data *VehicleData
+	err := v.withWake(ctx, "vehicle_data", func() (err error) {
+		data, err = v.fetchEachState(ctx, endpoints)
+		return err
+	})
+	return data, err
+}
+
+// Reads the states of the endpoints concurrently, without waking the vehicle
+func (v Vehicle) fetchEachState(ctx context.Context, endpoints []string) (*VehicleData, error) {
+	resources := map[string]bool{}
+	for _, endpoint := range endpoints {
+		switch endpoint {
+		case EndpointLocationData:
+			resources[EndpointDriveState] = true
+		case EndpointClosuresState:
+			resources[EndpointVehicleState] = true
+		default:
+			resources[endpoint] = true
+		}
+	}
+	vehicle := v
+	data := &VehicleData{Vehicle: &vehicle}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	for resource := range resources {
+		wg.Add(1)
+		go func(resource string) {
+			defer wg.Done()
+			var stateRequest *StateRequest
+			var config *VehicleConfig
+			var err error
+			if resource == EndpointVehicleConfig {
+				config, err = v.c.fetchVehicleConfig(ctx, v.ID)
+			} else {
+				stateRequest, err = v.c.fetchState(ctx, "/"+resource, v.ID)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			switch resource {
+			case EndpointChargeState:
+				data.ChargeState = stateRequest.Response.ChargeState
+			case EndpointClimateState:
+				data.ClimateState = stateRequest.Response.ClimateState
+			case EndpointDriveState:
+				data.DriveState = stateRequest.Response.DriveState
+			case EndpointGuiSettings:
+				data.GuiSettings = stateRequest.Response.GuiSettings
+			case EndpointVehicleState:
+				data.VehicleState = stateRequest.Response.VehicleState
+			case EndpointVehicleConfig:
+				data.VehicleConfig = config
+			}
+		}(resource)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return data, nil
+}
+
+// Fetches the configuration of the vehicle from its data_request endpoint
+func (c *Client) fetchVehicleConfig(ctx context.Context, id int64) (*VehicleConfig, error) {
+	if err := c.rateLimit(ctx, id, stateRead); err != nil {
+		return nil, err
+	}
+	resp := &struct {
+		Response *VehicleConfig `json:"response"`
+	}{}
+	if err := c.getJSON(ctx, c.baseURL()+"/vehicles/"+strconv.FormatInt(id, 10)+"/data_request/vehicle_config", resp); err != nil {
+		return nil, err
+	}
+	return resp.Response, nil
+}
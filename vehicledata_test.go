@@ -0,0 +1,171 @@
+package tesla
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var VehicleDataJSON = `{"response":{"id":1234,"vin":"5YJSA11111111111","state":"online","display_name":"Macak","charge_state":{"charging_state":"Charging","battery_level":58},"drive_state":{"shift_state":"D","speed":42,"latitude":35.1,"longitude":20.2},"vehicle_config":{"car_type":"models"}}}`
+
+func TestVehicleDataSpec(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	awake := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		requests = append(requests, req.URL.String())
+		asleep := !awake
+		mu.Unlock()
+		switch req.URL.Path {
+		case "/api/1/vehicles/4321/wake_up":
+			mu.Lock()
+			awake = true
+			mu.Unlock()
+			w.Write([]byte(`{"response":{"id":4321,"state":"online"}}`))
+		case "/api/1/vehicles/4321":
+			if asleep {
+				w.Write([]byte(`{"response":{"id":4321,"state":"asleep"}}`))
+				return
+			}
+			w.Write([]byte(`{"response":{"id":4321,"state":"online"}}`))
+		case "/api/1/vehicles/4321/data_request/charge_state", "/api/1/vehicles/4321/data_request/drive_state", "/api/1/vehicles/4321/data_request/vehicle_config":
+			if asleep {
+				w.WriteHeader(http.StatusRequestTimeout)
+				return
+			}
+			w.Write([]byte(`{"response":{}}`))
+		case "/api/1/vehicles/1234/vehicle_data":
+			w.Write([]byte(VehicleDataJSON))
+		case "/api/1/vehicles/5678/data_request/charge_state":
+			w.Write([]byte(ChargeStateJSON))
+		case "/api/1/vehicles/5678/data_request/drive_state":
+			w.Write([]byte(DriveStateJSON))
+		case "/api/1/vehicles/5678/data_request/vehicle_state":
+			w.Write([]byte(VehicleStateJSON))
+		case "/api/1/vehicles/5678/data_request/vehicle_config":
+			w.Write([]byte(`{"response":{"car_type":"model3"}}`))
+		case "/api/1/vehicles/5678":
+			w.Write([]byte(`{"response":{"id":5678,"state":"online"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client := &Client{
+		HTTP:    &http.Client{},
+		Token:   &Token{AccessToken: "foo", Expires: 99999999999},
+		BaseURL: ts.URL + "/api/1",
+	}
+	reset := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		r := requests
+		requests = nil
+		sort.Strings(r)
+		return r
+	}
+
+	Convey("Should get the selected states in a single request", t, func() {
+		reset()
+		vehicle := &Vehicle{ID: 1234, c: client}
+		data, err := vehicle.VehicleData(&VehicleDataRequest{
+			Endpoints: []string{EndpointChargeState, EndpointLocationData},
+			LetSleep:  true,
+		})
+		So(err, ShouldBeNil)
+		So(reset(), ShouldResemble, []string{"/api/1/vehicles/1234/vehicle_data?endpoints=charge_state%3Blocation_data&let_sleep=true"})
+		So(data.Vehicle.Vin, ShouldEqual, "5YJSA11111111111")
+		So(data.Vehicle.State, ShouldEqual, "online")
+		So(data.ChargeState.BatteryLevel, ShouldEqual, 58)
+		So(data.DriveState.Latitude, ShouldEqual, 35.1)
+		So(data.VehicleConfig.CarType, ShouldEqual, "models")
+		So(data.ClimateState, ShouldBeNil)
+	})
+
+	Convey("Should get all states by default", t, func() {
+		reset()
+		vehicle := &Vehicle{ID: 1234, c: client}
+		_, err := vehicle.VehicleData(nil)
+		So(err, ShouldBeNil)
+		So(reset(), ShouldResemble, []string{"/api/1/vehicles/1234/vehicle_data?endpoints=charge_state%3Bclimate_state%3Bdrive_state%3Blocation_data%3Bgui_settings%3Bvehicle_state%3Bvehicle_config%3Bclosures_state"})
+	})
+
+	Convey("Should read the states one by one without vehicle_data", t, func() {
+		reset()
+		vehicle := &Vehicle{ID: 5678, DisplayName: "Kocka", c: client}
+		data, err := vehicle.VehicleData(&VehicleDataRequest{
+			Endpoints: []string{EndpointChargeState, EndpointDriveState, EndpointLocationData, EndpointClosuresState, EndpointVehicleConfig},
+		})
+		So(err, ShouldBeNil)
+		So(reset(), ShouldResemble, []string{
+			"/api/1/vehicles/5678",
+			"/api/1/vehicles/5678/data_request/charge_state",
+			"/api/1/vehicles/5678/data_request/drive_state",
+			"/api/1/vehicles/5678/data_request/vehicle_config",
+			"/api/1/vehicles/5678/data_request/vehicle_state",
+			"/api/1/vehicles/5678/vehicle_data?endpoints=charge_state%3Bdrive_state%3Blocation_data%3Bclosures_state%3Bvehicle_config",
+		})
+		So(data.Vehicle.DisplayName, ShouldEqual, "Kocka")
+		So(data.ChargeState.BatteryLevel, ShouldEqual, 90)
+		So(data.DriveState.Heading, ShouldEqual, 57)
+		So(data.VehicleState.VehicleName, ShouldEqual, "Macak")
+		So(data.VehicleConfig.CarType, ShouldEqual, "model3")
+	})
+
+	Convey("Should wake the vehicle once to read the states one by one", t, func() {
+		reset()
+		sleepy := &Client{
+			HTTP:       &http.Client{},
+			Token:      &Token{AccessToken: "foo", Expires: 99999999999},
+			BaseURL:    ts.URL + "/api/1",
+			WakePolicy: DefaultWakePolicy(),
+		}
+		vehicle := &Vehicle{ID: 4321, State: StateAsleep, c: sleepy}
+		data, err := vehicle.VehicleData(&VehicleDataRequest{
+			Endpoints: []string{EndpointChargeState, EndpointDriveState, EndpointVehicleConfig},
+		})
+		So(err, ShouldBeNil)
+		So(data.Vehicle.State, ShouldEqual, StateOnline)
+		wakeups := 0
+		for _, r := range reset() {
+			if r == "/api/1/vehicles/4321/wake_up" {
+				wakeups++
+			}
+		}
+		So(wakeups, ShouldEqual, 1)
+	})
+
+	Convey("Should not read the states of unknown vehicles one by one", t, func() {
+		reset()
+		vehicle := &Vehicle{ID: 9999, c: client}
+		_, err := vehicle.VehicleData(&VehicleDataRequest{Endpoints: []string{EndpointChargeState}})
+		var apiErr *APIError
+		So(errors.As(err, &apiErr), ShouldBeTrue)
+		So(apiErr.StatusCode, ShouldEqual, http.StatusNotFound)
+		So(reset(), ShouldResemble, []string{
+			"/api/1/vehicles/9999",
+			"/api/1/vehicles/9999/vehicle_data?endpoints=charge_state",
+		})
+	})
+
+	Convey("Should keep the vehicle data without the service data", t, func() {
+		vehicle := &Vehicle{ID: 1234, c: client}
+		data, err := vehicle.Data(vehicle.ID)
+		So(err, ShouldBeNil)
+		So(data.Response.ChargeState.BatteryLevel, ShouldEqual, 58)
+		So(data.Response.ServiceData, ShouldBeNil)
+	})
+
+	Convey("Should fail if a state cannot be read", t, func() {
+		vehicle := &Vehicle{ID: 5678, c: client}
+		_, err := vehicle.VehicleData(&VehicleDataRequest{Endpoints: []string{EndpointChargeState, EndpointGuiSettings}})
+		So(err, ShouldNotBeNil)
+	})
+}
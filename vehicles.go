@@ -1,6 +1,7 @@
 package tesla
 
 import (
+	"context"
 	"strconv"
 	"time"
 )
@@ -14,7 +15,7 @@ type Vehicle struct {
 	VehicleID              uint64         `json:"vehicle_id"`
 	Vin                    string         `json:"vin"`
 	Tokens                 []string       `json:"tokens"`
-	State                  string         `json:"state"`
+	State                  OnlineState    `json:"state"`
 	IDS                    string         `json:"id_s"`
 	RemoteStartEnabled     bool           `json:"remote_start_enabled"`
 	CalendarEnabled        bool           `json:"calendar_enabled"`
@@ -27,10 +28,15 @@ type Vehicle struct {
 	CommandSigning         string         `json:"command_signing"`
 	VehicleConfig          *VehicleConfig `json:"vehicle_config"`
 
+	// WakePolicy, if set, overrides the wake policy of the client for the vehicle
+	WakePolicy *WakePolicy `json:"-"`
+
 	c *Client
 }
 
 type VehicleConfig struct {
+	RawJSON
+
 	CanAcceptNavigationRequests bool      `json:"can_accept_navigation_requests"`
 	CanActuateTrunks            bool      `json:"can_actuate_trunks"`
 	CarSpecialType              string    `json:"car_special_type"`
@@ -72,8 +78,13 @@ type VehiclesResponse struct {
 
 // Fetches the vehicles associated to a Tesla account via the API
 func (c *Client) Vehicles() ([]*Vehicle, error) {
+	return c.VehiclesContext(context.Background())
+}
+
+// VehiclesContext is like Vehicles but uses ctx for the requests to the API
+func (c *Client) VehiclesContext(ctx context.Context) ([]*Vehicle, error) {
 	vehiclesResponse := &VehiclesResponse{}
-	if err := c.getJSON(c.BaseURL+"/vehicles", vehiclesResponse); err != nil {
+	if err := c.getJSON(ctx, c.baseURL()+"/vehicles", vehiclesResponse); err != nil {
 		return nil, err
 	}
 	for _, v := range vehiclesResponse.Response {
@@ -84,8 +95,13 @@ func (c *Client) Vehicles() ([]*Vehicle, error) {
 
 // Fetches the vehicle by ID associated to a Tesla account via the API
 func (c *Client) Vehicle(vehicleId int64) (*Vehicle, error) {
+	return c.VehicleContext(context.Background(), vehicleId)
+}
+
+// VehicleContext is like Vehicle but uses ctx for the requests to the API
+func (c *Client) VehicleContext(ctx context.Context, vehicleId int64) (*Vehicle, error) {
 	resp := &VehicleResponse{}
-	if err := c.getJSON(c.BaseURL+"/vehicles/"+strconv.FormatInt(vehicleId, 10), resp); err != nil {
+	if err := c.getJSON(ctx, c.baseURL()+"/vehicles/"+strconv.FormatInt(vehicleId, 10), resp); err != nil {
 		return nil, err
 	}
 	resp.Response.c = c
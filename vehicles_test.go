@@ -1,6 +1,8 @@
 package tesla
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -14,8 +16,6 @@ var (
 func TestVehiclesSpec(t *testing.T) {
 	ts := serveHTTP(t)
 	defer ts.Close()
-	previousAuthURL := AuthURL
-	AuthURL = ts.URL + "/oauth/token"
 
 	auth := &Auth{
 		GrantType:    "password",
@@ -24,8 +24,7 @@ func TestVehiclesSpec(t *testing.T) {
 		Email:        "elon@tesla.com",
 		Password:     "go",
 	}
-	client, _ := NewClient(auth)
-	client.BaseURL = ts.URL + "/api/1"
+	client, _ := NewClient(auth, testOptions(ts)...)
 
 	Convey("Should get vehicles", t, func() {
 		vehicles, err := client.Vehicles()
@@ -33,15 +32,11 @@ func TestVehiclesSpec(t *testing.T) {
 		So(vehicles[0].DisplayName, ShouldEqual, "Macak")
 		So(vehicles[0].CalendarEnabled, ShouldBeTrue)
 	})
-
-	AuthURL = previousAuthURL
 }
 
 func TestVehicle(t *testing.T) {
 	ts := serveHTTP(t)
 	defer ts.Close()
-	previousAuthURL := AuthURL
-	AuthURL = ts.URL + "/oauth/token"
 
 	auth := &Auth{
 		GrantType:    "password",
@@ -50,8 +45,7 @@ func TestVehicle(t *testing.T) {
 		Email:        "elon@tesla.com",
 		Password:     "go",
 	}
-	client, _ := NewClient(auth)
-	client.BaseURL = ts.URL + "/api/1"
+	client, _ := NewClient(auth, testOptions(ts)...)
 
 	Convey("Should get vehicle", t, func() {
 		vehicle, err := client.Vehicle(1234)
@@ -60,5 +54,10 @@ func TestVehicle(t *testing.T) {
 		So(vehicle.CalendarEnabled, ShouldBeTrue)
 	})
 
-	AuthURL = previousAuthURL
+	Convey("Should not get vehicle with a canceled context", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := client.VehicleContext(ctx, 1234)
+		So(errors.Is(err, context.Canceled), ShouldBeTrue)
+	})
 }
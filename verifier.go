@@ -0,0 +1,198 @@
+package tesla
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CommandVerifier is the vehicle side of the command protocol. It answers
+// session requests and authenticates the signed commands of paired keys, so
+// that tests and simulators can stand in for a vehicle.
+type CommandVerifier struct {
+	// VIN is the VIN of the vehicle, which personalizes the signatures
+	VIN string
+	// Execute runs an authenticated command, given by the name of its REST
+	// endpoint and the JSON body of the REST request. A CommandError reports
+	// its reason to the client.
+	Execute func(command string, params []byte) error
+	// Now returns the time of the vehicle, time.Now if nil
+	Now func() time.Time
+
+	key   *ecdsa.PrivateKey
+	epoch []byte
+	start time.Time
+
+	mu       sync.Mutex
+	counters map[string]uint32
+}
+
+// NewCommandVerifier returns a verifier for the vehicle with a new key pair
+func NewCommandVerifier(vin string) (*CommandVerifier, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &CommandVerifier{
+		VIN:      vin,
+		key:      key,
+		epoch:    randomBytes(),
+		start:    time.Now(),
+		counters: map[string]uint32{},
+	}, nil
+}
+
+// PublicKey returns the public key of the vehicle
+func (cv *CommandVerifier) PublicKey() *ecdsa.PublicKey {
+	return &cv.key.PublicKey
+}
+
+// PairKey pairs the public key of a client with the vehicle
+func (cv *CommandVerifier) PairKey(key *ecdsa.PublicKey) {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	id := hex.EncodeToString(PublicKeyBytes(key))
+	for _, d := range []domain{domainVehicleSecurity, domainInfotainment} {
+		if _, ok := cv.counters[id+"/"+strconv.Itoa(int(d))]; !ok {
+			cv.counters[id+"/"+strconv.Itoa(int(d))] = 0
+		}
+	}
+}
+
+// Returns the time of the vehicle
+func (cv *CommandVerifier) now() time.Time {
+	if cv.Now != nil {
+		return cv.Now()
+	}
+	return time.Now()
+}
+
+// Returns the clock of the vehicle, in seconds since the start of the epoch
+func (cv *CommandVerifier) clockTime() uint32 {
+	return uint32(cv.now().Sub(cv.start) / time.Second)
+}
+
+// Handle processes an encoded message from a client and returns the encoded
+// response of the vehicle
+func (cv *CommandVerifier) Handle(message []byte) ([]byte, error) {
+	req, err := decodeRoutableMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	res := &routableMessage{
+		toAddress:   req.fromAddress,
+		fromDomain:  req.toDomain,
+		requestUUID: req.uuid,
+		uuid:        randomBytes(),
+	}
+	if req.sessionInfoRequest != nil {
+		cv.attachSessionInfo(res, req.toDomain, req.sessionInfoRequest, req.uuid)
+		return res.encode(), nil
+	}
+	if fault := cv.authenticate(req); fault != 0 {
+		res.fault = fault
+		if fault.resync() {
+			cv.attachSessionInfo(res, req.toDomain, req.signerPublicKey, req.uuid)
+		}
+		return res.encode(), nil
+	}
+	name, params, err := decodeCommand(req.toDomain, req.payload)
+	if err != nil {
+		res.fault = MessageFaultDecoding
+		return res.encode(), nil
+	}
+	if cv.Execute != nil {
+		err = cv.Execute(name, params)
+	}
+	res.payload = encodeCommandResult(req.toDomain, err)
+	return res.encode(), nil
+}
+
+// Attaches the session info for the client key and the domain to the response
+func (cv *CommandVerifier) attachSessionInfo(res *routableMessage, d domain, clientKey []byte, challenge []byte) {
+	cv.mu.Lock()
+	counter, paired := cv.counters[hex.EncodeToString(clientKey)+"/"+strconv.Itoa(int(d))]
+	cv.mu.Unlock()
+	info := &sessionInfo{
+		counter:   counter,
+		publicKey: PublicKeyBytes(&cv.key.PublicKey),
+		epoch:     cv.epoch,
+		clockTime: cv.clockTime(),
+	}
+	if !paired {
+		info.status = sessionInfoKeyNotPaired
+	}
+	res.sessionInfo = info.encode()
+	shared, err := sharedKey(cv.key, clientKey)
+	if err != nil {
+		return
+	}
+	res.sessionInfoTag = sessionInfoMetadata(cv.VIN, challenge).tag(hmacSum(shared, []byte("session info")), res.sessionInfo)
+}
+
+// Authenticates a signed command, returning the fault if it is rejected
+func (cv *CommandVerifier) authenticate(req *routableMessage) MessageFault {
+	if req.signature == nil {
+		return MessageFaultInvalidSignature
+	}
+	if req.toDomain != domainVehicleSecurity && req.toDomain != domainInfotainment {
+		return MessageFaultInvalidDomains
+	}
+	id := hex.EncodeToString(req.signerPublicKey) + "/" + strconv.Itoa(int(req.toDomain))
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	counter, paired := cv.counters[id]
+	if !paired {
+		return MessageFaultUnknownKey
+	}
+	shared, err := sharedKey(cv.key, req.signerPublicKey)
+	if err != nil {
+		return MessageFaultUnknownKey
+	}
+	sig := req.signature
+	key := hmacSum(shared, []byte("authenticated command"))
+	expected := commandMetadata(req.toDomain, cv.VIN, sig.epoch, sig.expiresAt, sig.counter).tag(key, req.payload)
+	switch {
+	case !hmac.Equal(expected, sig.tag):
+		return MessageFaultInvalidSignature
+	case !hmac.Equal(sig.epoch, cv.epoch):
+		return MessageFaultIncorrectEpoch
+	case sig.expiresAt < cv.clockTime():
+		return MessageFaultTimeExpired
+	case sig.counter <= counter:
+		return MessageFaultInvalidTokenOrCounter
+	}
+	cv.counters[id] = sig.counter
+	return 0
+}
+
+// ServeHTTP serves the signed_command endpoint of the vehicle
+func (cv *CommandVerifier) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body := &struct {
+		RoutableMessage string `json:"routable_message"`
+	}{}
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	message, err := base64.StdEncoding.DecodeString(body.RoutableMessage)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res, err := cv.Handle(message)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"response": base64.StdEncoding.EncodeToString(res)})
+}
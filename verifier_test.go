@@ -0,0 +1,73 @@
+package tesla
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVerifierSpec(t *testing.T) {
+	verifier, err := NewCommandVerifier("abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := GenerateCommandKey()
+	verifier.PairKey(&key.PublicKey)
+
+	// Performs the handshake with the verifier
+	handshake := func(d domain) *commandSession {
+		request := &routableMessage{toDomain: d, fromAddress: randomBytes(), sessionInfoRequest: PublicKeyBytes(&key.PublicKey), uuid: randomBytes()}
+		res, err := verifier.Handle(request.encode())
+		So(err, ShouldBeNil)
+		message, err := decodeRoutableMessage(res)
+		So(err, ShouldBeNil)
+		session := &commandSession{}
+		So(session.sync(key, "abc123", request.uuid, message), ShouldBeNil)
+		return session
+	}
+
+	// Sends a signed command to the verifier and returns the fault
+	send := func(d domain, payload []byte, sig *hmacSignature) MessageFault {
+		request := &routableMessage{toDomain: d, payload: payload, signerPublicKey: PublicKeyBytes(&key.PublicKey), signature: sig}
+		res, err := verifier.Handle(request.encode())
+		So(err, ShouldBeNil)
+		message, err := decodeRoutableMessage(res)
+		So(err, ShouldBeNil)
+		return message.fault
+	}
+
+	Convey("Should accept a signed command", t, func() {
+		session := handshake(domainInfotainment)
+		d, payload, _ := encodeCommand("honk_horn", nil)
+		So(send(d, payload, session.sign(d, "abc123", payload)), ShouldEqual, 0)
+	})
+
+	Convey("Should reject tampered commands", t, func() {
+		session := handshake(domainInfotainment)
+		d, payload, _ := encodeCommand("honk_horn", nil)
+		sig := session.sign(d, "abc123", payload)
+		_, other, _ := encodeCommand("flash_lights", nil)
+		So(send(d, other, sig), ShouldEqual, MessageFaultInvalidSignature)
+	})
+
+	Convey("Should reject commands signed for another vehicle", t, func() {
+		session := handshake(domainInfotainment)
+		d, payload, _ := encodeCommand("honk_horn", nil)
+		So(send(d, payload, session.sign(d, "xyz789", payload)), ShouldEqual, MessageFaultInvalidSignature)
+	})
+
+	Convey("Should reject an incorrect epoch", t, func() {
+		session := handshake(domainInfotainment)
+		session.epoch = randomBytes()
+		d, payload, _ := encodeCommand("honk_horn", nil)
+		So(send(d, payload, session.sign(d, "abc123", payload)), ShouldEqual, MessageFaultIncorrectEpoch)
+	})
+
+	Convey("Should report unpaired keys", t, func() {
+		other, _ := GenerateCommandKey()
+		request := &routableMessage{toDomain: domainInfotainment, sessionInfoRequest: PublicKeyBytes(&other.PublicKey), uuid: randomBytes()}
+		res, _ := verifier.Handle(request.encode())
+		message, _ := decodeRoutableMessage(res)
+		So((&commandSession{}).sync(other, "abc123", request.uuid, message), ShouldEqual, ErrKeyNotPaired)
+	})
+}
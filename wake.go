@@ -0,0 +1,129 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// The delays between the polls of WaitForOnline
+var wakeBackoff = &RetryPolicy{
+	InitialBackoff: time.Second,
+	MaxBackoff:     10 * time.Second,
+	Multiplier:     1.5,
+	Jitter:         0.1,
+}
+
+// WakePolicy wakes vehicles which reject commands or state reads because they
+// are asleep, waits for them to come online and sends the request once more
+type WakePolicy struct {
+	// Timeout limits the wait for the vehicle to come online, or not if 0
+	Timeout time.Duration
+	// Allow, if set, is called before waking the vehicle for the request,
+	// e.g. "door_lock" or "charge_state". Returning false vetoes the wake-up,
+	// e.g. to spare the battery, and the request fails as it would without
+	// the policy.
+	Allow func(v *Vehicle, request string) bool
+}
+
+// DefaultWakePolicy returns a policy waking vehicles for every request and
+// waiting a minute for them to come online
+func DefaultWakePolicy() *WakePolicy {
+	return &WakePolicy{Timeout: time.Minute}
+}
+
+// Returns the wake policy of the vehicle, which overrides the one of the client
+func (v *Vehicle) wakePolicy() *WakePolicy {
+	if v.WakePolicy != nil {
+		return v.WakePolicy
+	}
+	return v.c.WakePolicy
+}
+
+// Calls send, and if the vehicle is asleep and the wake policy allows it,
+// wakes the vehicle and calls send once more
+func (v *Vehicle) withWake(ctx context.Context, request string, send func() error) error {
+	err := send()
+	policy := v.wakePolicy()
+	if policy == nil || request == "wake_up" || !errors.Is(err, ErrVehicleUnavailable) {
+		return err
+	}
+	if policy.Allow != nil && !policy.Allow(v, request) {
+		return err
+	}
+	v.c.logf("waking vehicle %d for %s", v.ID, request)
+	if _, err := v.WaitForOnline(ctx, policy.Timeout); err != nil {
+		return err
+	}
+	return send()
+}
+
+// WakeTimeoutError is returned by WaitForOnline when the vehicle does not
+// come online in time. It matches ErrVehicleUnavailable.
+type WakeTimeoutError struct {
+	VehicleID int64
+	// State is the last state of the vehicle observed, e.g. "asleep"
+	State   OnlineState
+	Timeout time.Duration
+}
+
+func (e *WakeTimeoutError) Error() string {
+	return fmt.Sprintf("vehicle %d not online after %s: %s", e.VehicleID, e.Timeout, e.State)
+}
+
+// Is reports whether the error is ErrVehicleUnavailable
+func (e *WakeTimeoutError) Is(target error) bool {
+	return target == ErrVehicleUnavailable
+}
+
+// The number of polls of WaitForOnline between wake-ups, which are sent again
+// in case the vehicle missed one
+const wakeEvery = 3
+
+// WaitForOnline wakes the vehicle and polls it until it is online, giving up
+// with a *WakeTimeoutError after the timeout, or never if it is 0. It returns
+// the online vehicle and sets the State of v, which must not be used by
+// other goroutines meanwhile. Wake-ups refused by the RateLimiter are left
+// out and the vehicle is only polled.
+func (v *Vehicle) WaitForOnline(ctx context.Context, timeout time.Duration) (*Vehicle, error) {
+	waitCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	state := v.State
+	vehicle, err := v.WakeupContext(waitCtx)
+	for attempt := 1; ; attempt++ {
+		if err == nil {
+			state = vehicle.State
+			if vehicle.State == StateOnline {
+				v.State = state
+				return vehicle, nil
+			}
+		} else if waitCtx.Err() == nil && !transientWakeError(err) {
+			return nil, err
+		}
+		if err := sleepContext(waitCtx, wakeBackoff.backoff(attempt)); err != nil || waitCtx.Err() != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, &WakeTimeoutError{VehicleID: v.ID, State: state, Timeout: timeout}
+		}
+		vehicle, err = v.c.VehicleContext(waitCtx, v.ID)
+		if err == nil && vehicle.State != StateOnline && attempt%wakeEvery == 0 && v.c.wakeAllowed(v.ID) {
+			if woken, wakeErr := v.WakeupContext(waitCtx); !errors.Is(wakeErr, ErrRateLimitExceeded) {
+				vehicle, err = woken, wakeErr
+			}
+		}
+	}
+}
+
+// Indicates whether polling a waking vehicle should go on after the error
+func transientWakeError(err error) bool {
+	var apiErr *APIError
+	return errors.Is(err, ErrVehicleUnavailable) || errors.Is(err, ErrRateLimitExceeded) ||
+		errors.As(err, &apiErr) && apiErr.StatusCode >= http.StatusInternalServerError
+}
@@ -0,0 +1,231 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWakeSpec(t *testing.T) {
+	var mu sync.Mutex
+	wakeups := map[string]int{}
+	requests := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		path := strings.TrimSuffix(req.URL.Path, "/wake_up")
+		requests[path]++
+		if req.Method == "POST" {
+			wakeups[path]++
+		}
+		state := "asleep"
+		switch {
+		case path == "/api/1/vehicles/1234" && wakeups[path] >= 3:
+			state = "online"
+		case (path == "/api/1/vehicles/777" || path == "/api/1/vehicles/778") && requests[path] >= 5:
+			state = "online"
+		case path == "/api/1/vehicles/500":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		case path == "/api/1/vehicles/404":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(200)
+		w.Write([]byte(strings.Replace(VehicleJSON, `"state":"online"`, `"state":"`+state+`"`, 1)))
+	}))
+	defer ts.Close()
+
+	wakeBackoff.InitialBackoff = time.Millisecond
+	wakeBackoff.MaxBackoff = 5 * time.Millisecond
+	defer func() {
+		wakeBackoff.InitialBackoff = time.Second
+		wakeBackoff.MaxBackoff = 10 * time.Second
+	}()
+	client := &Client{
+		HTTP:    &http.Client{},
+		Token:   &Token{AccessToken: "foo", Expires: 99999999999},
+		BaseURL: ts.URL + "/api/1",
+	}
+
+	Convey("Should return the woken vehicle wired to the client", t, func() {
+		vehicle := &Vehicle{ID: 1234, c: client}
+		woken, err := vehicle.Wakeup()
+		So(err, ShouldBeNil)
+		So(woken.State, ShouldEqual, "asleep")
+		_, err = woken.MobileEnabled()
+		So(err, ShouldNotBeNil)
+		So(woken.c, ShouldEqual, client)
+	})
+
+	Convey("Should wait for the vehicle to come online", t, func() {
+		vehicle := &Vehicle{ID: 1234, State: "asleep", c: client}
+		online, err := vehicle.WaitForOnline(context.Background(), time.Minute)
+		So(err, ShouldBeNil)
+		So(online.State, ShouldEqual, "online")
+		So(online.c, ShouldEqual, client)
+		So(vehicle.State, ShouldEqual, "online")
+		So(wakeups["/api/1/vehicles/1234"], ShouldEqual, 3)
+	})
+
+	Convey("Should keep polling when the rate limiter refuses wake-ups", t, func() {
+		for _, failFast := range []bool{true, false} {
+			id := int64(777)
+			if !failFast {
+				id = 778
+			}
+			limited := &Client{
+				HTTP:    &http.Client{},
+				Token:   &Token{AccessToken: "foo", Expires: 99999999999},
+				BaseURL: ts.URL + "/api/1",
+				RateLimiter: &RateLimiter{
+					Vehicle:  RateLimits{Wakeups: Every(time.Hour, 1)},
+					FailFast: failFast,
+				},
+			}
+			vehicle := &Vehicle{ID: id, State: "asleep", c: limited}
+			online, err := vehicle.WaitForOnline(context.Background(), time.Minute)
+			So(err, ShouldBeNil)
+			So(online.State, ShouldEqual, "online")
+			So(vehicle.State, ShouldEqual, "online")
+			So(wakeups[fmt.Sprintf("/api/1/vehicles/%d", id)], ShouldEqual, 1)
+		}
+	})
+
+	Convey("Should time out if the vehicle stays asleep", t, func() {
+		vehicle := &Vehicle{ID: 900, c: client}
+		_, err := vehicle.WaitForOnline(context.Background(), 50*time.Millisecond)
+		var timeoutErr *WakeTimeoutError
+		So(errors.As(err, &timeoutErr), ShouldBeTrue)
+		So(timeoutErr.State, ShouldEqual, "asleep")
+		So(timeoutErr.Timeout, ShouldEqual, 50*time.Millisecond)
+		So(errors.Is(err, ErrVehicleUnavailable), ShouldBeTrue)
+		So(err.Error(), ShouldEqual, "vehicle 900 not online after 50ms: asleep")
+	})
+
+	Convey("Should keep trying through server errors", t, func() {
+		vehicle := &Vehicle{ID: 500, c: client}
+		_, err := vehicle.WaitForOnline(context.Background(), 20*time.Millisecond)
+		var timeoutErr *WakeTimeoutError
+		So(errors.As(err, &timeoutErr), ShouldBeTrue)
+		So(requests["/api/1/vehicles/500"], ShouldBeGreaterThan, 1)
+	})
+
+	Convey("Should give up on other errors", t, func() {
+		vehicle := &Vehicle{ID: 404, c: client}
+		_, err := vehicle.WaitForOnline(context.Background(), time.Minute)
+		var apiErr *APIError
+		So(errors.As(err, &apiErr), ShouldBeTrue)
+		So(apiErr.StatusCode, ShouldEqual, 404)
+	})
+
+	Convey("Should return the error of a canceled context", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		vehicle := &Vehicle{ID: 900, c: client}
+		_, err := vehicle.WaitForOnline(ctx, time.Minute)
+		So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+		var timeoutErr *WakeTimeoutError
+		So(errors.As(err, &timeoutErr), ShouldBeFalse)
+	})
+}
+
+func TestWakePolicySpec(t *testing.T) {
+	var mu sync.Mutex
+	online := false
+	wakeups := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch req.URL.Path {
+		case "/api/1/vehicles/1234/wake_up":
+			wakeups++
+			online = true
+			w.Write([]byte(strings.Replace(VehicleJSON, `"state":"online"`, `"state":"asleep"`, 1)))
+		case "/api/1/vehicles/1234":
+			w.Write([]byte(VehicleJSON))
+		case "/api/1/vehicles/1234/data_request/charge_state":
+			if !online {
+				w.WriteHeader(http.StatusRequestTimeout)
+				w.Write([]byte(VehicleUnavailableJSON))
+				return
+			}
+			w.Write([]byte(ChargeStateJSON))
+		case "/api/1/vehicles/1234/command/door_lock":
+			if !online {
+				w.WriteHeader(http.StatusRequestTimeout)
+				w.Write([]byte(VehicleUnavailableJSON))
+				return
+			}
+			w.Write([]byte(CommandResponseJSON))
+		}
+	}))
+	defer ts.Close()
+
+	wakeBackoff.InitialBackoff = time.Millisecond
+	defer func() { wakeBackoff.InitialBackoff = time.Second }()
+	client := &Client{
+		HTTP:    &http.Client{},
+		Token:   &Token{AccessToken: "foo", Expires: 99999999999},
+		BaseURL: ts.URL + "/api/1",
+	}
+	asleep := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		online = false
+		wakeups = 0
+	}
+
+	Convey("Should not wake vehicles without a policy", t, func() {
+		asleep()
+		client.WakePolicy = nil
+		vehicle := &Vehicle{ID: 1234, c: client}
+		_, err := vehicle.ChargeState()
+		So(errors.Is(err, ErrVehicleUnavailable), ShouldBeTrue)
+		So(wakeups, ShouldEqual, 0)
+	})
+
+	Convey("Should wake vehicles for state reads and commands", t, func() {
+		client.WakePolicy = DefaultWakePolicy()
+		vehicle := &Vehicle{ID: 1234, State: "asleep", c: client}
+		asleep()
+		state, err := vehicle.ChargeState()
+		So(err, ShouldBeNil)
+		So(state.BatteryLevel, ShouldEqual, 90)
+		So(wakeups, ShouldEqual, 1)
+		asleep()
+		So(vehicle.LockDoors(), ShouldBeNil)
+		So(wakeups, ShouldEqual, 1)
+	})
+
+	Convey("Should let the hook veto wake-ups", t, func() {
+		asleep()
+		var requests []string
+		client.WakePolicy = &WakePolicy{Allow: func(v *Vehicle, request string) bool {
+			requests = append(requests, request)
+			return request != "charge_state"
+		}}
+		vehicle := &Vehicle{ID: 1234, c: client}
+		_, err := vehicle.ChargeState()
+		So(errors.Is(err, ErrVehicleUnavailable), ShouldBeTrue)
+		So(wakeups, ShouldEqual, 0)
+		So(vehicle.LockDoors(), ShouldBeNil)
+		So(requests, ShouldResemble, []string{"charge_state", "door_lock"})
+	})
+
+	Convey("Should prefer the policy of the vehicle", t, func() {
+		asleep()
+		client.WakePolicy = nil
+		vehicle := &Vehicle{ID: 1234, WakePolicy: DefaultWakePolicy(), c: client}
+		So(vehicle.LockDoors(), ShouldBeNil)
+		So(wakeups, ShouldEqual, 1)
+	})
+}